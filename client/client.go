@@ -17,13 +17,21 @@ type FinancesService interface {
 type financesService struct {
 	baseURL string
 	client  *http.Client
+	tokens  TokenSource
 }
 
 func NewFinancesService() FinancesService {
 	baseURL := os.Getenv("FINANCES_SERVICE_URL")
+	tokens := NewClientCredentialsTokenSource(
+		utils.GetOAuthTokenURL(),
+		os.Getenv("FINANCES_CLIENT_ID"),
+		os.Getenv("FINANCES_CLIENT_SECRET"),
+		os.Getenv("FINANCES_CLIENT_SCOPE"),
+	)
 	return &financesService{
 		baseURL: baseURL,
 		client:  &http.Client{},
+		tokens:  tokens,
 	}
 }
 
@@ -46,9 +54,9 @@ func (fs *financesService) CreateDefaultCategories(userID int64) error {
 
 	req.Header.Set("Content-Type", "application/json")
 
-	token, err := utils.GenerateServiceToken()
+	token, err := fs.tokens.Token()
 	if err != nil {
-		return fmt.Errorf("failed to generate service token: %w", err)
+		return fmt.Errorf("failed to obtain service token: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+token)
 
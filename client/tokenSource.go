@@ -0,0 +1,89 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// expiryMargin renews cached tokens slightly before they expire so a request
+// never leaves with a token that expires in flight.
+const expiryMargin = 30 * time.Second
+
+// TokenSource hands out access tokens for outgoing service calls.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// clientCredentialsTokenSource fetches tokens from the OAuth token endpoint
+// with the client credentials grant and caches them until they expire.
+type clientCredentialsTokenSource struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scope        string
+	client       *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func NewClientCredentialsTokenSource(tokenURL, clientID, clientSecret, scope string) TokenSource {
+	return &clientCredentialsTokenSource{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scope:        scope,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (ts *clientCredentialsTokenSource) Token() (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.token != "" && time.Now().Add(expiryMargin).Before(ts.expiresAt) {
+		return ts.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if ts.scope != "" {
+		form.Set("scope", ts.scope)
+	}
+
+	req, err := http.NewRequest("POST", ts.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(ts.clientID, ts.clientSecret)
+
+	resp, err := ts.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to call token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to obtain access token: status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	ts.token = body.AccessToken
+	ts.expiresAt = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+
+	return ts.token, nil
+}
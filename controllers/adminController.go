@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/services"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminController struct {
+	keyService           services.KeyService
+	oauthService         services.OAuthService
+	loginThrottleService services.LoginThrottleService
+}
+
+func NewAdminController(keys services.KeyService, oauth services.OAuthService, loginThrottle services.LoginThrottleService) *AdminController {
+	return &AdminController{
+		keyService:           keys,
+		oauthService:         oauth,
+		loginThrottleService: loginThrottle,
+	}
+}
+
+func (ac *AdminController) ListKeys(c *gin.Context) {
+	keys, err := ac.keyService.ListKeys()
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to list signing keys in controller method ListKeys: ", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+func (ac *AdminController) RotateKeys(c *gin.Context) {
+	key, err := ac.keyService.RotateKeys()
+	if err == entities.ErrKeyRotationUnsupported {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to rotate signing keys in controller method RotateKeys: ", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "signing key rotated", "key": key})
+}
+
+func (ac *AdminController) ListClients(c *gin.Context) {
+	clients, err := ac.oauthService.ListClients()
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to list clients in controller method ListClients: ", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"clients": clients})
+}
+
+func (ac *AdminController) RegisterClient(c *gin.Context) {
+	var client entities.OAuthClient
+	if err := c.ShouldBindJSON(&client); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method RegisterClient: ", err)
+
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	registered, secret, err := ac.oauthService.RegisterClient(client)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to register client in controller method RegisterClient: ", err)
+
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"client": registered, "clientSecret": secret})
+}
+
+// UnlockUser clears a login lockout and the failures that led to it.
+func (ac *AdminController) UnlockUser(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	err = ac.loginThrottleService.AdminUnlock(userID, clientInfo(c))
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to unlock user in controller method UnlockUser: ", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "account unlocked successfully"})
+}
+
+func (ac *AdminController) ListUserEvents(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	events, err := ac.loginThrottleService.ListEvents(userID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to list security events in controller method ListUserEvents: ", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
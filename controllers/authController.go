@@ -1,27 +1,108 @@
 package controllers
 
 import (
-	"fmt"
+	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/middlewares"
 	"github.com/Renan-Parise/auth/services"
 	"github.com/Renan-Parise/auth/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 type AuthController struct {
-	authService services.AuthService
+	authService          services.AuthService
+	loginThrottleService services.LoginThrottleService
 }
 
-func NewAuthController(service services.AuthService) *AuthController {
-	return &AuthController{authService: service}
+func NewAuthController(service services.AuthService, loginThrottle services.LoginThrottleService) *AuthController {
+	return &AuthController{
+		authService:          service,
+		loginThrottleService: loginThrottle,
+	}
+}
+
+// trustedDeviceCookie holds the token of a device the user chose to trust.
+// Clients that do not keep cookies send it in the X-Device-Token header.
+const trustedDeviceCookie = "trusted_device"
+
+func clientInfo(c *gin.Context) entities.ClientInfo {
+	deviceToken, err := c.Cookie(trustedDeviceCookie)
+	if err != nil {
+		deviceToken = c.GetHeader("X-Device-Token")
+	}
+
+	return entities.ClientInfo{
+		UserAgent:   c.Request.UserAgent(),
+		IPAddress:   middlewares.ClientIP(c),
+		DeviceToken: deviceToken,
+	}
+}
+
+// renderLinkConfirmation asks before using the token, so link prefetchers cannot.
+func renderLinkConfirmation(c *gin.Context, title, message, button string) {
+	renderPage(c, http.StatusOK, "confirm.html", gin.H{
+		"Title":   title,
+		"Message": message,
+		"Button":  button,
+		"Action":  c.Request.URL.Path,
+		"Token":   c.Query("token"),
+	})
+}
+
+// linkToken reads the token posted to a link, as a form by its confirmation
+// page or as JSON by other clients.
+func linkToken(c *gin.Context) string {
+	var request struct {
+		Token string `form:"token" json:"token"`
+	}
+	if err := c.ShouldBind(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind token in controller method linkToken: ", err)
+	}
+	return request.Token
+}
+
+// respondLinkResult answers the POST of a link with a page showing done when
+// its confirmation page sent it, and with JSON carrying message otherwise.
+func respondLinkResult(c *gin.Context, title, done, message string, err error) {
+	if c.ContentType() != binding.MIMEPOSTForm {
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": message})
+		return
+	}
+
+	if err != nil {
+		renderPage(c, http.StatusBadRequest, "message.html", gin.H{"Title": title, "Error": "This link is invalid or has expired."})
+		return
+	}
+	renderPage(c, http.StatusOK, "message.html", gin.H{"Title": title, "Message": done})
+}
+
+// setTrustedDeviceCookie stores a device token issued by a 2FA login in a
+// cookie scripts cannot read, for as long as the device stays trusted.
+func setTrustedDeviceCookie(c *gin.Context, tokens *entities.Tokens) {
+	if tokens.DeviceToken == "" {
+		return
+	}
+
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(trustedDeviceCookie, tokens.DeviceToken, int(utils.GetTrustedDeviceTTL().Seconds()), "/", "", true, true)
 }
 
 func (ac *AuthController) Login(c *gin.Context) {
 	var credentials struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Method   string `json:"method"`
 	}
 
 	if err := c.ShouldBindJSON(&credentials); err != nil {
@@ -31,10 +112,25 @@ func (ac *AuthController) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := ac.authService.Login(credentials.Email, credentials.Password)
+	tokens, err := ac.authService.Login(credentials.Email, credentials.Password, credentials.Method, clientInfo(c))
 	if err != nil {
-		if err == entities.ErrTwoFARequired {
-			c.JSON(http.StatusAccepted, gin.H{"message": "2FA code sent to email"})
+		if required, ok := err.(*entities.TwoFARequiredError); ok {
+			response := gin.H{"message": twoFAMessage(required.Method), "method": required.Method, "methods": required.Methods, "challenge": required.Challenge}
+			if required.Options != nil {
+				response["options"] = required.Options
+			}
+
+			c.Header("Cache-Control", "no-store")
+			c.JSON(http.StatusAccepted, response)
+			return
+		}
+		if throttled, ok := err.(*entities.LoginThrottledError); ok {
+			c.Header("Retry-After", retryAfterSeconds(throttled.RetryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": throttled.Error(), "locked": throttled.Locked})
+			return
+		}
+		if unverified, ok := err.(*entities.EmailNotVerifiedError); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": unverified.Error(), "emailVerified": false})
 			return
 		}
 		utils.GetLogger().WithError(err).Error("Failed to login in controller method Login: ", err)
@@ -43,7 +139,40 @@ func (ac *AuthController) Login(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, tokens)
+}
+
+// retryAfterSeconds formats a wait for the Retry-After header, rounded up
+// to whole seconds.
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+// respondValidationErrors answers 400 with every rule a request broke, such
+// as those of the password policy, and reports whether err was one.
+func respondValidationErrors(c *gin.Context, err error) bool {
+	failures, ok := err.(errors.ValidationErrors)
+	if !ok {
+		return false
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "validationErrors": failures})
+	return true
+}
+
+func twoFAMessage(method string) string {
+	switch method {
+	case entities.TwoFAMethodTOTP:
+		return "enter the code from your authenticator app"
+	case entities.TwoFAMethodWebAuthn:
+		return "confirm the login with your passkey"
+	case entities.TwoFAMethodSMS:
+		return "2FA code sent by text message"
+	case entities.TwoFAMethodVoice:
+		return "you will receive a call with your 2FA code"
+	default:
+		return "2FA code sent to email"
+	}
 }
 
 func (ac *AuthController) Register(c *gin.Context) {
@@ -56,6 +185,9 @@ func (ac *AuthController) Register(c *gin.Context) {
 	}
 
 	err := ac.authService.Register(user)
+	if respondValidationErrors(c, err) {
+		return
+	}
 	if err != nil {
 		utils.GetLogger().WithError(err).Error("Failed to register in controller method Register: ", err)
 
@@ -63,7 +195,48 @@ func (ac *AuthController) Register(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "registration successful"})
+	c.JSON(http.StatusOK, gin.H{"message": "registration successful. please check your email to verify your address"})
+}
+
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	var request struct {
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in VerifyEmail")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	err := ac.authService.VerifyEmail(request.Email, request.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email verified successfully"})
+}
+
+func (ac *AuthController) ResendEmailVerification(c *gin.Context) {
+	var request struct {
+		Email string `json:"email"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in ResendEmailVerification")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	err := ac.authService.ResendEmailVerification(request.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "verification email sent"})
 }
 
 func (ac *AuthController) Update(c *gin.Context) {
@@ -93,6 +266,39 @@ func (ac *AuthController) Update(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "update successful"})
 }
 
+// ChangePassword replaces the password of the signed in user, keeping only
+// the current session.
+func (ac *AuthController) ChangePassword(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method ChangePassword: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := ac.authService.ChangePassword(ID.(int), c.GetString("SessionID"), request.CurrentPassword, request.NewPassword)
+	if respondValidationErrors(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password changed successfully"})
+}
+
 func (ac *AuthController) Deactivate(c *gin.Context) {
 	ID, exists := c.Get("ID")
 	if !exists {
@@ -114,8 +320,12 @@ func (ac *AuthController) Deactivate(c *gin.Context) {
 
 func (ac *AuthController) ConfirmTwoFA(c *gin.Context) {
 	var request struct {
-		Email string `json:"email"`
-		Code  string `json:"code"`
+		Challenge      string          `json:"challenge"`
+		Code           string          `json:"code"`
+		Method         string          `json:"method"`
+		CeremonyID     string          `json:"ceremonyId"`
+		Credential     json.RawMessage `json:"credential"`
+		RememberDevice bool            `json:"rememberDevice"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -124,34 +334,31 @@ func (ac *AuthController) ConfirmTwoFA(c *gin.Context) {
 		return
 	}
 
-	token, err := ac.authService.VerifyTwoFACode(request.Email, request.Code)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"token": token})
-}
+	if request.Method == entities.TwoFAMethodWebAuthn {
+		tokens, err := ac.authService.VerifyPasskeyTwoFA(request.Challenge, request.CeremonyID, request.Credential, request.RememberDevice, clientInfo(c))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
 
-func (ac *AuthController) ToggleTwoFA(c *gin.Context) {
-	fmt.Println("ToggleTwoFA")
-	ID, exists := c.Get("ID")
-	if !exists {
-		utils.GetLogger().Error("User ID not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		setTrustedDeviceCookie(c, tokens)
+		c.JSON(http.StatusOK, tokens)
 		return
 	}
 
-	err := ac.authService.GenerateAndSendTwoFACodeByID(ID.(int))
+	tokens, err := ac.authService.VerifyTwoFACode(request.Challenge, request.Code, request.Method, request.RememberDevice, clientInfo(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send 2FA code"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusAccepted, gin.H{"message": "2FA code sent to email"})
+	setTrustedDeviceCookie(c, tokens)
+	c.JSON(http.StatusOK, tokens)
 }
 
-func (ac *AuthController) ConfirmToggleTwoFA(c *gin.Context) {
+// Reauthenticate returns fresh tokens for routes guarded by a step-up, after
+// the user entered their password or answered one of their factors again.
+func (ac *AuthController) Reauthenticate(c *gin.Context) {
 	ID, exists := c.Get("ID")
 	if !exists {
 		utils.GetLogger().Error("User ID not found in context")
@@ -160,27 +367,51 @@ func (ac *AuthController) ConfirmToggleTwoFA(c *gin.Context) {
 	}
 
 	var request struct {
-		Code string `json:"code"`
+		Password   string          `json:"password"`
+		Method     string          `json:"method"`
+		Code       string          `json:"code"`
+		CeremonyID string          `json:"ceremonyId"`
+		Credential json.RawMessage `json:"credential"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method ConfirmToggleTwoFA: ", err)
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method Reauthenticate: ", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	err := ac.authService.ToggleTwoFA(ID.(int), request.Code)
+	response := entities.FactorResponse{Code: request.Code, CeremonyID: request.CeremonyID, Credential: request.Credential}
+	tokens, err := ac.authService.Reauthenticate(ID.(int), c.GetString("SessionID"), request.Password, request.Method, response, clientInfo(c))
 	if err != nil {
+		if throttled, ok := err.(*entities.LoginThrottledError); ok {
+			c.Header("Retry-After", retryAfterSeconds(throttled.RetryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": throttled.Error(), "locked": throttled.Locked})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "2FA setting updated"})
+	c.JSON(http.StatusOK, tokens)
+}
+
+// ConfirmUnlock shows the page the link emailed to a locked out user opens,
+// which posts the token to Unlock.
+func (ac *AuthController) ConfirmUnlock(c *gin.Context) {
+	renderLinkConfirmation(c, "Unlock your account", "Your account was locked after too many failed sign in attempts. Unlock it if those attempts were yours.", "Unlock account")
+}
+
+// Unlock lifts a login lockout with the token from the link emailed to the
+// locked out user.
+func (ac *AuthController) Unlock(c *gin.Context) {
+	err := ac.loginThrottleService.Unlock(linkToken(c), clientInfo(c))
+	respondLinkResult(c, "Unlock your account", "Your account is unlocked. You can sign in again.", "account unlocked successfully", err)
 }
 
 func (ac *AuthController) InitiatePasswordRecovery(c *gin.Context) {
 	var request struct {
-		Email string `json:"email"`
+		Email   string `json:"email"`
+		Channel string `json:"channel"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -189,12 +420,17 @@ func (ac *AuthController) InitiatePasswordRecovery(c *gin.Context) {
 		return
 	}
 
-	err := ac.authService.InitiatePasswordRecovery(request.Email)
+	err := ac.authService.InitiatePasswordRecovery(request.Email, request.Channel)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if request.Channel == entities.OTPChannelSMS || request.Channel == entities.OTPChannelVoice {
+		c.JSON(http.StatusOK, gin.H{"message": "password recovery code sent to your phone"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "password recovery email sent"})
 }
 
@@ -212,6 +448,9 @@ func (ac *AuthController) ResetPassword(c *gin.Context) {
 	}
 
 	err := ac.authService.ResetPassword(request.Email, request.Code, request.NewPassword)
+	if respondValidationErrors(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
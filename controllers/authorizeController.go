@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/services"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// AuthorizeController serves the login and consent pages of the OAuth
+// authorization code flow.
+type AuthorizeController struct {
+	oauthService services.OAuthService
+	authService  services.AuthService
+}
+
+func NewAuthorizeController(oauth services.OAuthService, auth services.AuthService) *AuthorizeController {
+	return &AuthorizeController{
+		oauthService: oauth,
+		authService:  auth,
+	}
+}
+
+type authorizeForm struct {
+	ResponseType        string   `form:"response_type"`
+	ClientID            string   `form:"client_id"`
+	RedirectURI         string   `form:"redirect_uri"`
+	Scope               string   `form:"scope"`
+	State               string   `form:"state"`
+	CodeChallenge       string   `form:"code_challenge"`
+	CodeChallengeMethod string   `form:"code_challenge_method"`
+	Nonce               string   `form:"nonce"`
+	Action              string   `form:"action"`
+	Email               string   `form:"email"`
+	Password            string   `form:"password"`
+	Challenge           string   `form:"challenge"`
+	Code                string   `form:"code"`
+	Method              string   `form:"method"`
+	Methods             []string `form:"methods"`
+	CeremonyID          string   `form:"ceremony_id"`
+	Credential          string   `form:"credential"`
+}
+
+func (ac *AuthorizeController) Authorize(c *gin.Context) {
+	request, ok := ac.validate(c)
+	if !ok {
+		return
+	}
+
+	renderPage(c, http.StatusOK, "authorize.html", gin.H{"Title": "Sign in", "Request": request})
+}
+
+func (ac *AuthorizeController) Login(c *gin.Context) {
+	request, ok := ac.validate(c)
+	if !ok {
+		return
+	}
+
+	var form authorizeForm
+	_ = c.ShouldBind(&form)
+
+	if form.Action != "allow" {
+		redirectWithError(c, request, errors.NewOAuthError("access_denied", "the user denied the request"))
+		return
+	}
+
+	session, err := ac.authService.LoginSession(form.Email, form.Password, "", clientInfo(c))
+	if required, ok := err.(*entities.TwoFARequiredError); ok {
+		renderTwoFA(c, http.StatusOK, request, required, "")
+		return
+	}
+	if throttled, ok := err.(*entities.LoginThrottledError); ok {
+		c.Header("Retry-After", retryAfterSeconds(throttled.RetryAfter))
+		renderPage(c, http.StatusTooManyRequests, "authorize.html", gin.H{"Title": "Sign in", "Request": request, "Email": form.Email, "Error": "Too many failed attempts. Please try again later."})
+		return
+	}
+	if _, ok := err.(*entities.EmailNotVerifiedError); ok {
+		renderPage(c, http.StatusForbidden, "authorize.html", gin.H{"Title": "Sign in", "Request": request, "Email": form.Email, "Error": "Please verify your email address before signing in."})
+		return
+	}
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to login in controller method Login: ", err)
+
+		renderPage(c, http.StatusUnauthorized, "authorize.html", gin.H{"Title": "Sign in", "Request": request, "Email": form.Email, "Error": "Invalid email or password."})
+		return
+	}
+
+	ac.redirectWithCode(c, request, session)
+}
+
+func (ac *AuthorizeController) ConfirmTwoFA(c *gin.Context) {
+	request, ok := ac.validate(c)
+	if !ok {
+		return
+	}
+
+	var form authorizeForm
+	_ = c.ShouldBind(&form)
+
+	required := &entities.TwoFARequiredError{Method: form.Method, Challenge: form.Challenge, Methods: form.Methods}
+
+	// Switching to another factor sends its code or starts a passkey
+	// ceremony, as the login did for the first one.
+	if form.Action == "switch" {
+		options, err := ac.authService.ChallengeTwoFA(form.Challenge, form.Method, clientInfo(c))
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to challenge 2FA method in controller method ConfirmTwoFA: ", err)
+
+			renderTwoFA(c, http.StatusBadRequest, request, required, "This method is not available. Please sign in again.")
+			return
+		}
+
+		required.Options = options
+		renderTwoFA(c, http.StatusOK, request, required, "")
+		return
+	}
+
+	response := entities.FactorResponse{Code: form.Code, CeremonyID: form.CeremonyID, Credential: []byte(form.Credential)}
+	session, err := ac.authService.VerifyTwoFASession(form.Challenge, form.Method, response, clientInfo(c))
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to verify 2FA code in controller method ConfirmTwoFA: ", err)
+
+		// A passkey ceremony can only be answered once.
+		if form.Method == entities.TwoFAMethodWebAuthn {
+			required.Options, _ = ac.authService.ChallengeTwoFA(form.Challenge, form.Method, clientInfo(c))
+		}
+		renderTwoFA(c, http.StatusUnauthorized, request, required, "Invalid or expired code.")
+		return
+	}
+
+	ac.redirectWithCode(c, request, session)
+}
+
+func renderTwoFA(c *gin.Context, status int, request *entities.AuthorizationRequest, required *entities.TwoFARequiredError, message string) {
+	data := gin.H{"Title": "Two-factor authentication", "Request": request, "Challenge": required.Challenge, "Method": required.Method, "Methods": required.Methods, "Error": message}
+	if required.Method == entities.TwoFAMethodWebAuthn && required.Options != nil {
+		nonce, err := utils.GenerateSecureToken(16)
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to generate script nonce in controller method renderTwoFA: ", err)
+		} else {
+			data["Options"] = required.Options
+			data["ScriptNonce"] = nonce
+		}
+	}
+
+	renderPage(c, status, "twofa.html", data)
+}
+
+// validate checks the authorization parameters, which every step of the flow
+// carries again, and answers the request itself when they are invalid.
+func (ac *AuthorizeController) validate(c *gin.Context) (*entities.AuthorizationRequest, bool) {
+	var form authorizeForm
+	if err := c.ShouldBind(&form); err != nil {
+		renderPage(c, http.StatusBadRequest, "error.html", gin.H{"Title": "Authorization failed", "Error": "The authorization request is malformed."})
+		return nil, false
+	}
+
+	request, err := ac.oauthService.ValidateAuthorizationRequest(entities.AuthorizationRequest{
+		ClientID:            form.ClientID,
+		RedirectURI:         form.RedirectURI,
+		Scope:               form.Scope,
+		State:               form.State,
+		CodeChallenge:       form.CodeChallenge,
+		CodeChallengeMethod: form.CodeChallengeMethod,
+		Nonce:               form.Nonce,
+	}, form.ResponseType)
+	if err != nil {
+		if request == nil {
+			renderPage(c, http.StatusBadRequest, "error.html", gin.H{"Title": "Authorization failed", "Error": oauthErrorDescription(err)})
+			return nil, false
+		}
+		redirectWithError(c, request, err)
+		return nil, false
+	}
+
+	return request, true
+}
+
+func (ac *AuthorizeController) redirectWithCode(c *gin.Context, request *entities.AuthorizationRequest, session *entities.Session) {
+	code, err := ac.oauthService.CreateAuthorizationCode(request, session)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to create authorization code in controller method redirectWithCode: ", err)
+
+		redirectWithError(c, request, errors.NewOAuthError("server_error", "the request could not be processed"))
+		return
+	}
+
+	redirectToClient(c, request, url.Values{"code": {code}})
+}
+
+func redirectWithError(c *gin.Context, request *entities.AuthorizationRequest, err error) {
+	oauthErr, ok := err.(*errors.OAuthError)
+	if !ok {
+		oauthErr = errors.NewOAuthError("server_error", "the request could not be processed")
+	}
+
+	redirectToClient(c, request, url.Values{"error": {oauthErr.Code}, "error_description": {oauthErr.Description}})
+}
+
+// redirectToClient sends the browser back to the registered redirect URI
+// with params and the state of the request added to its query.
+func redirectToClient(c *gin.Context, request *entities.AuthorizationRequest, params url.Values) {
+	target, _ := url.Parse(request.RedirectURI)
+
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if request.State != "" {
+		query.Set("state", request.State)
+	}
+	target.RawQuery = query.Encode()
+
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, target.String())
+}
+
+// renderPage writes an HTML page that must never be framed or cached, since
+// it collects credentials. Scripts only run when data has a ScriptNonce.
+func renderPage(c *gin.Context, status int, name string, data gin.H) {
+	policy := "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'"
+	if nonce, ok := data["ScriptNonce"].(string); ok {
+		policy += "; script-src 'nonce-" + nonce + "'"
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", policy)
+	c.Header("Referrer-Policy", "no-referrer")
+	c.HTML(status, name, data)
+}
+
+func oauthErrorDescription(err error) string {
+	if oauthErr, ok := err.(*errors.OAuthError); ok {
+		return oauthErr.Description
+	}
+	return "the request could not be processed"
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/Renan-Parise/auth/services"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type EmailChangeController struct {
+	emailChangeService services.EmailChangeService
+}
+
+func NewEmailChangeController(service services.EmailChangeService) *EmailChangeController {
+	return &EmailChangeController{emailChangeService: service}
+}
+
+func (ec *EmailChangeController) RequestChange(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var request struct {
+		NewEmail string `json:"newEmail"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method RequestChange: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := ec.emailChangeService.RequestChange(ID.(int), request.NewEmail)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "confirmation code sent to your new email"})
+}
+
+func (ec *EmailChangeController) ConfirmChange(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method ConfirmChange: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := ec.emailChangeService.ConfirmChange(ID.(int), request.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email changed successfully. please log in again"})
+}
+
+// ConfirmCancelChange shows the page the link sent to the old address opens,
+// which posts the token to CancelChange.
+func (ec *EmailChangeController) ConfirmCancelChange(c *gin.Context) {
+	renderLinkConfirmation(c, "Cancel email change", "Someone asked to change the email address of your account. Cancel the change if it was not you.", "Cancel change")
+}
+
+// CancelChange drops a pending email change with the token from the link
+// sent to the old address.
+func (ec *EmailChangeController) CancelChange(c *gin.Context) {
+	err := ec.emailChangeService.CancelChange(linkToken(c))
+	respondLinkResult(c, "Cancel email change", "The email change is cancelled. Your email address stays the same.", "email change cancelled", err)
+}
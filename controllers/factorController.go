@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/services"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type FactorController struct {
+	factorService services.FactorService
+}
+
+func NewFactorController(service services.FactorService) *FactorController {
+	return &FactorController{factorService: service}
+}
+
+// factorRequest is the answer to a factor, sent to confirm a new factor or
+// to prove the user may remove one.
+type factorRequest struct {
+	Type       string          `json:"type"`
+	Method     string          `json:"method"`
+	Code       string          `json:"code"`
+	CeremonyID string          `json:"ceremonyId"`
+	Credential json.RawMessage `json:"credential"`
+	Name       string          `json:"name"`
+}
+
+func (r factorRequest) response() entities.FactorResponse {
+	return entities.FactorResponse{
+		Code:       r.Code,
+		CeremonyID: r.CeremonyID,
+		Credential: r.Credential,
+		Name:       r.Name,
+	}
+}
+
+func (fc *FactorController) ListFactors(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	factors, err := fc.factorService.ListFactors(ID.(int))
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to list factors in controller method ListFactors: ", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"factors": factors})
+}
+
+func (fc *FactorController) AddFactor(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var request factorRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method AddFactor: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	enrollment, err := fc.factorService.AddFactor(ID.(int), request.Type)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to add factor in controller method AddFactor: ", err)
+
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"type": request.Type, "enrollment": enrollment})
+}
+
+func (fc *FactorController) ConfirmFactor(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var request factorRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method ConfirmFactor: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recoveryCodes, err := fc.factorService.ConfirmFactor(ID.(int), request.Type, request.response())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if recoveryCodes != nil {
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{"message": "2FA method added", "recoveryCodes": recoveryCodes})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "2FA method added"})
+}
+
+// Challenge prepares one of the user's factors to be answered, for actions
+// that require the user to confirm their second factor again. For email it
+// sends a fresh code.
+func (fc *FactorController) Challenge(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var request factorRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method Challenge: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	options, err := fc.factorService.Challenge(ID.(int), request.Type)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if options == nil {
+		c.JSON(http.StatusAccepted, gin.H{"message": twoFAMessage(request.Type)})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, options)
+}
+
+func (fc *FactorController) SetDefault(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	factorID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 2FA method id"})
+		return
+	}
+
+	err = fc.factorService.SetDefault(ID.(int), factorID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "default 2FA method updated"})
+}
+
+func (fc *FactorController) RemoveFactor(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	factorID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 2FA method id"})
+		return
+	}
+
+	var request factorRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method RemoveFactor: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = fc.factorService.RemoveFactor(ID.(int), factorID, request.Method, request.response())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "2FA method removed"})
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/services"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type OAuthController struct {
+	oauthService         services.OAuthService
+	introspectionService services.IntrospectionService
+}
+
+func NewOAuthController(oauth services.OAuthService, introspection services.IntrospectionService) *OAuthController {
+	return &OAuthController{
+		oauthService:         oauth,
+		introspectionService: introspection,
+	}
+}
+
+func (oc *OAuthController) Token(c *gin.Context) {
+	var request struct {
+		GrantType    string `form:"grant_type"`
+		Scope        string `form:"scope"`
+		ClientID     string `form:"client_id"`
+		ClientSecret string `form:"client_secret"`
+		Code         string `form:"code"`
+		RedirectURI  string `form:"redirect_uri"`
+		CodeVerifier string `form:"code_verifier"`
+		RefreshToken string `form:"refresh_token"`
+	}
+
+	if err := c.ShouldBind(&request); err != nil {
+		respondOAuthError(c, errors.NewOAuthError("invalid_request", "malformed token request"))
+		return
+	}
+
+	clientID, clientSecret := request.ClientID, request.ClientSecret
+	if basicID, basicSecret, ok := c.Request.BasicAuth(); ok {
+		clientID, clientSecret = basicID, basicSecret
+	}
+
+	var response *entities.OAuthTokenResponse
+	var err error
+
+	switch request.GrantType {
+	case entities.GrantTypeClientCredentials:
+		response, err = oc.oauthService.ClientCredentialsGrant(clientID, clientSecret, request.Scope)
+	case entities.GrantTypeAuthorizationCode:
+		response, err = oc.oauthService.AuthorizationCodeGrant(clientID, clientSecret, request.Code, request.RedirectURI, request.CodeVerifier)
+	case entities.GrantTypeRefreshToken:
+		response, err = oc.oauthService.RefreshTokenGrant(clientID, clientSecret, request.RefreshToken)
+	default:
+		err = errors.NewOAuthError("unsupported_grant_type", "grant type is not supported")
+	}
+
+	if err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+func (oc *OAuthController) Introspect(c *gin.Context) {
+	var request struct {
+		Token         string `form:"token"`
+		TokenTypeHint string `form:"token_type_hint"`
+	}
+
+	if err := c.ShouldBind(&request); err != nil || request.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+		return
+	}
+
+	result := oc.introspectionService.Introspect(request.Token, request.TokenTypeHint)
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, result)
+}
+
+// UserInfo serves the OpenID Connect claims of the user the access token was
+// issued to. Errors follow RFC 6750, as for any bearer protected resource.
+func (oc *OAuthController) UserInfo(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	claims := c.MustGet("Claims").(*utils.Claims)
+
+	info, err := oc.oauthService.UserInfo(ID.(int), claims.Scope)
+	if err != nil {
+		oauthErr, ok := err.(*errors.OAuthError)
+		if !ok {
+			respondOAuthError(c, err)
+			return
+		}
+
+		status := http.StatusUnauthorized
+		if oauthErr.Code == "insufficient_scope" {
+			status = http.StatusForbidden
+		}
+
+		c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="%s", error_description="%s"`, oauthErr.Code, oauthErr.Description))
+		c.JSON(status, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, info)
+}
+
+// respondOAuthError writes an RFC 6749 error response. Errors that are not
+// OAuth errors are reported as server_error without leaking their details.
+func respondOAuthError(c *gin.Context, err error) {
+	oauthErr, ok := err.(*errors.OAuthError)
+	if !ok {
+		utils.GetLogger().WithError(err).Error("Unexpected error in OAuth endpoint: ", err)
+		oauthErr = errors.NewOAuthError("server_error", "the request could not be processed")
+	}
+
+	status := http.StatusBadRequest
+	switch oauthErr.Code {
+	case "invalid_client":
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="auth"`)
+	case "server_error":
+		status = http.StatusInternalServerError
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/Renan-Parise/auth/services"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type PhoneController struct {
+	phoneService services.PhoneService
+}
+
+func NewPhoneController(service services.PhoneService) *PhoneController {
+	return &PhoneController{phoneService: service}
+}
+
+func (pc *PhoneController) SetPhoneNumber(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var request struct {
+		PhoneNumber string `json:"phoneNumber"`
+		Channel     string `json:"channel"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method SetPhoneNumber: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := pc.phoneService.SetPhoneNumber(ID.(int), request.PhoneNumber, request.Channel)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "verification code sent to your phone"})
+}
+
+func (pc *PhoneController) VerifyPhoneNumber(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method VerifyPhoneNumber: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := pc.phoneService.VerifyPhoneNumber(ID.(int), request.Code)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "phone number verified successfully"})
+}
+
+func (pc *PhoneController) RemovePhoneNumber(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	err := pc.phoneService.RemovePhoneNumber(ID.(int))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "phone number removed successfully"})
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/Renan-Parise/auth/services"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type RecoveryCodeController struct {
+	authService         services.AuthService
+	recoveryCodeService services.RecoveryCodeService
+}
+
+func NewRecoveryCodeController(auth services.AuthService, recoveryCodes services.RecoveryCodeService) *RecoveryCodeController {
+	return &RecoveryCodeController{
+		authService:         auth,
+		recoveryCodeService: recoveryCodes,
+	}
+}
+
+func (rc *RecoveryCodeController) Remaining(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	remaining, err := rc.recoveryCodeService.Remaining(ID.(int))
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to count recovery codes in controller method Remaining: ", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"remaining": remaining})
+}
+
+func (rc *RecoveryCodeController) Regenerate(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var request factorRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method Regenerate: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recoveryCodes, err := rc.authService.RegenerateRecoveryCodes(ID.(int), request.Method, request.response())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": recoveryCodes})
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/Renan-Parise/auth/services"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type SessionController struct {
+	sessionService services.SessionService
+}
+
+func NewSessionController(service services.SessionService) *SessionController {
+	return &SessionController{sessionService: service}
+}
+
+func (sc *SessionController) ListSessions(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	sessions, err := sc.sessionService.ListSessions(ID.(int), c.GetString("SessionID"))
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to list sessions in controller method ListSessions: ", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (sc *SessionController) RevokeSession(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	err := sc.sessionService.RevokeSession(ID.(int), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked successfully"})
+}
+
+func (sc *SessionController) Logout(c *gin.Context) {
+	sessionID, exists := c.Get("SessionID")
+	if !exists {
+		utils.GetLogger().Error("Session ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	err := sc.sessionService.Logout(sessionID.(string))
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to logout in controller method Logout: ", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out successfully"})
+}
+
+func (sc *SessionController) LogoutAll(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	err := sc.sessionService.LogoutAll(ID.(int))
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to logout everywhere in controller method LogoutAll: ", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out of all sessions successfully"})
+}
@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/Renan-Parise/auth/services"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type TokenController struct {
+	tokenService services.TokenService
+}
+
+func NewTokenController(service services.TokenService) *TokenController {
+	return &TokenController{tokenService: service}
+}
+
+func (tc *TokenController) Refresh(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil || request.RefreshToken == "" {
+		utils.GetLogger().Error("Failed to bind JSON in controller method Refresh")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	tokens, err := tc.tokenService.Refresh(request.RefreshToken, "")
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Renan-Parise/auth/services"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type TrustedDeviceController struct {
+	trustedDeviceService services.TrustedDeviceService
+}
+
+func NewTrustedDeviceController(service services.TrustedDeviceService) *TrustedDeviceController {
+	return &TrustedDeviceController{trustedDeviceService: service}
+}
+
+func (tc *TrustedDeviceController) ListDevices(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	devices, err := tc.trustedDeviceService.ListDevices(ID.(int), clientInfo(c))
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to list trusted devices in controller method ListDevices: ", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": devices})
+}
+
+func (tc *TrustedDeviceController) RevokeDevice(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	deviceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+		return
+	}
+
+	err = tc.trustedDeviceService.RevokeDevice(ID.(int), deviceID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "trusted device revoked successfully"})
+}
+
+func (tc *TrustedDeviceController) RevokeAll(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	err := tc.trustedDeviceService.RevokeAll(ID.(int))
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to revoke trusted devices in controller method RevokeAll: ", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "all trusted devices revoked successfully"})
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/services"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type WebAuthnController struct {
+	webauthnService services.WebAuthnService
+	authService     services.AuthService
+}
+
+func NewWebAuthnController(webauthn services.WebAuthnService, auth services.AuthService) *WebAuthnController {
+	return &WebAuthnController{webauthnService: webauthn, authService: auth}
+}
+
+func (wc *WebAuthnController) RegistrationOptions(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	challenge, err := wc.webauthnService.BeginRegistration(ID.(int))
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to start passkey registration in controller method RegistrationOptions: ", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, challenge)
+}
+
+func (wc *WebAuthnController) Register(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var request struct {
+		CeremonyID string          `json:"ceremonyId"`
+		Name       string          `json:"name"`
+		Credential json.RawMessage `json:"credential"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method Register: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	credential, err := wc.webauthnService.FinishRegistration(ID.(int), request.CeremonyID, request.Name, request.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, credential)
+}
+
+// LoginOptions starts a passwordless login, in which the browser lets the
+// user pick any passkey they registered for this site.
+func (wc *WebAuthnController) LoginOptions(c *gin.Context) {
+	challenge, err := wc.webauthnService.BeginLogin(0)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to start passkey login in controller method LoginOptions: ", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, challenge)
+}
+
+func (wc *WebAuthnController) Login(c *gin.Context) {
+	var request struct {
+		CeremonyID string          `json:"ceremonyId"`
+		Credential json.RawMessage `json:"credential"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method Login: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := wc.authService.PasskeyLogin(request.CeremonyID, request.Credential, clientInfo(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// TwoFAOptions returns the passkey options for a login that answered 202
+// with the webauthn method. The assertion is then sent to /auth/fa/confirm.
+func (wc *WebAuthnController) TwoFAOptions(c *gin.Context) {
+	var request struct {
+		Challenge string `json:"challenge"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to bind JSON in controller method TwoFAOptions: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	challenge, err := wc.authService.ChallengeTwoFA(request.Challenge, entities.TwoFAMethodWebAuthn, clientInfo(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, challenge)
+}
+
+func (wc *WebAuthnController) ListCredentials(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	credentials, err := wc.webauthnService.ListCredentials(ID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, credentials)
+}
+
+func (wc *WebAuthnController) DeleteCredential(c *gin.Context) {
+	ID, exists := c.Get("ID")
+	if !exists {
+		utils.GetLogger().Error("User ID not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	credentialID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid passkey id"})
+		return
+	}
+
+	err = wc.webauthnService.DeleteCredential(ID.(int), credentialID)
+	if err == entities.ErrLastPasskey {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "passkey removed"})
+}
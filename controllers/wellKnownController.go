@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type WellKnownController struct{}
+
+func NewWellKnownController() *WellKnownController {
+	return &WellKnownController{}
+}
+
+func (wc *WellKnownController) JWKS(c *gin.Context) {
+	set, err := utils.PublicJWKS()
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to build JWKS in controller method JWKS: ", err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load signing keys"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
+
+// OpenIDConfiguration serves the OpenID Connect discovery document. Endpoint
+// URLs are derived from the issuer, which must therefore be the public base
+// URL of the service.
+func (wc *WellKnownController) OpenIDConfiguration(c *gin.Context) {
+	issuer := utils.GetJWTIssuer()
+	baseURL := strings.TrimSuffix(issuer, "/")
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, entities.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             baseURL + "/oauth/authorize",
+		TokenEndpoint:                     baseURL + "/oauth/token",
+		UserInfoEndpoint:                  baseURL + "/oauth/userinfo",
+		JWKSURI:                           baseURL + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             baseURL + "/oauth/introspect",
+		ScopesSupported:                   []string{entities.ScopeOpenID, entities.ScopeProfile, entities.ScopeEmail},
+		ResponseTypesSupported:            []string{"code"},
+		ResponseModesSupported:            []string{"query"},
+		GrantTypesSupported:               []string{entities.GrantTypeAuthorizationCode, entities.GrantTypeRefreshToken, entities.GrantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{utils.GetJWTSigningAlgorithm()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{entities.CodeChallengeMethodS256},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "amr", "preferred_username", "email", "email_verified"},
+	})
+}
@@ -0,0 +1,13 @@
+CREATE TABLE refresh_tokens (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    userID INT NOT NULL,
+    familyID VARCHAR(64) NOT NULL,
+    tokenHash CHAR(64) NOT NULL,
+    expiresAt DATETIME NOT NULL,
+    usedAt DATETIME NULL,
+    revokedAt DATETIME NULL,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_refresh_tokens_hash (tokenHash),
+    KEY idx_refresh_tokens_family (familyID),
+    CONSTRAINT fk_refresh_tokens_user FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,20 @@
+CREATE TABLE sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    userID INT NOT NULL,
+    userAgent VARCHAR(512) NOT NULL DEFAULT '',
+    ipAddress VARCHAR(45) NOT NULL DEFAULT '',
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lastSeenAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expiresAt DATETIME NOT NULL,
+    revokedAt DATETIME NULL,
+    KEY idx_sessions_user (userID),
+    CONSTRAINT fk_sessions_user FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- Refresh tokens issued before sessions existed cannot be tied to one.
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN sessionID VARCHAR(64) NOT NULL AFTER userID,
+    ADD KEY idx_refresh_tokens_session (sessionID),
+    ADD CONSTRAINT fk_refresh_tokens_session FOREIGN KEY (sessionID) REFERENCES sessions (id) ON DELETE CASCADE;
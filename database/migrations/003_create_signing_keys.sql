@@ -0,0 +1,9 @@
+CREATE TABLE signing_keys (
+    kid VARCHAR(64) PRIMARY KEY,
+    algorithm VARCHAR(16) NOT NULL,
+    privateKey TEXT NOT NULL,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    activatesAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    retiredAt DATETIME NULL,
+    expiresAt DATETIME NULL
+);
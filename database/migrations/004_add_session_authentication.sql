@@ -0,0 +1,5 @@
+ALTER TABLE sessions
+    ADD COLUMN authTime DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER ipAddress,
+    ADD COLUMN amr VARCHAR(255) NOT NULL DEFAULT 'pwd' AFTER authTime;
+
+UPDATE sessions SET authTime = createdAt;
@@ -0,0 +1,10 @@
+CREATE TABLE oauth_clients (
+    clientID VARCHAR(64) PRIMARY KEY,
+    secretHash VARCHAR(255) NULL,
+    name VARCHAR(255) NOT NULL,
+    scopes VARCHAR(1024) NOT NULL DEFAULT '',
+    grantTypes VARCHAR(255) NOT NULL DEFAULT '',
+    audiences VARCHAR(1024) NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
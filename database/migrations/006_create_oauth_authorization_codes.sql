@@ -0,0 +1,23 @@
+ALTER TABLE oauth_clients
+    ADD COLUMN redirectURIs TEXT NULL AFTER audiences;
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN clientID VARCHAR(64) NOT NULL DEFAULT '' AFTER sessionID,
+    ADD COLUMN scope VARCHAR(1024) NOT NULL DEFAULT '' AFTER clientID;
+
+CREATE TABLE oauth_authorization_codes (
+    codeHash CHAR(64) PRIMARY KEY,
+    clientID VARCHAR(64) NOT NULL,
+    userID INT NOT NULL,
+    sessionID VARCHAR(64) NOT NULL,
+    redirectURI VARCHAR(2048) NOT NULL,
+    scope VARCHAR(1024) NOT NULL DEFAULT '',
+    codeChallenge VARCHAR(128) NOT NULL,
+    codeChallengeMethod VARCHAR(16) NOT NULL,
+    expiresAt DATETIME NOT NULL,
+    usedAt DATETIME NULL,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_oauth_authorization_codes_session (sessionID),
+    CONSTRAINT fk_oauth_authorization_codes_client FOREIGN KEY (clientID) REFERENCES oauth_clients (clientID) ON DELETE CASCADE,
+    CONSTRAINT fk_oauth_authorization_codes_session FOREIGN KEY (sessionID) REFERENCES sessions (id) ON DELETE CASCADE
+);
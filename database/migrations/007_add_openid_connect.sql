@@ -0,0 +1,10 @@
+-- Existing accounts predate email verification and count as verified, while
+-- accounts registered from now on start unverified.
+ALTER TABLE users
+    ADD COLUMN emailVerified BOOLEAN NOT NULL DEFAULT TRUE AFTER email;
+
+ALTER TABLE users
+    ALTER COLUMN emailVerified SET DEFAULT FALSE;
+
+ALTER TABLE oauth_authorization_codes
+    ADD COLUMN nonce VARCHAR(255) NOT NULL DEFAULT '' AFTER codeChallengeMethod;
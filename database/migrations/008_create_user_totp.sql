@@ -0,0 +1,8 @@
+CREATE TABLE user_totp (
+    userID INT PRIMARY KEY,
+    secret VARCHAR(64) NOT NULL,
+    confirmedAt DATETIME NULL,
+    lastUsedStep BIGINT NULL,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_user_totp_user FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+CREATE TABLE recovery_codes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    userID INT NOT NULL,
+    codeHash CHAR(64) NOT NULL,
+    usedAt DATETIME NULL,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_recovery_codes_user_code (userID, codeHash),
+    CONSTRAINT fk_recovery_codes_user FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,28 @@
+CREATE TABLE webauthn_credentials (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    userID INT NOT NULL,
+    credentialID VARBINARY(1023) NOT NULL,
+    publicKey BLOB NOT NULL,
+    attestationType VARCHAR(32) NOT NULL DEFAULT '',
+    transports VARCHAR(255) NOT NULL DEFAULT '',
+    aaguid VARBINARY(16) NULL,
+    signCount BIGINT NOT NULL DEFAULT 0,
+    backupEligible BOOLEAN NOT NULL DEFAULT FALSE,
+    backupState BOOLEAN NOT NULL DEFAULT FALSE,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lastUsedAt DATETIME NULL,
+    UNIQUE KEY uq_webauthn_credentials_credential (credentialID),
+    KEY idx_webauthn_credentials_user (userID),
+    CONSTRAINT fk_webauthn_credentials_user FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE webauthn_ceremonies (
+    id VARCHAR(64) PRIMARY KEY,
+    userID INT NULL,
+    type VARCHAR(16) NOT NULL,
+    sessionData TEXT NOT NULL,
+    expiresAt DATETIME NOT NULL,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_webauthn_ceremonies_user FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+CREATE TABLE twofa_challenges (
+    id VARCHAR(64) PRIMARY KEY,
+    userID INT NOT NULL,
+    method VARCHAR(16) NOT NULL,
+    userAgent VARCHAR(512) NOT NULL DEFAULT '',
+    ipAddress VARCHAR(45) NOT NULL DEFAULT '',
+    attempts INT NOT NULL DEFAULT 0,
+    expiresAt DATETIME NOT NULL,
+    usedAt DATETIME NULL,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_twofa_challenges_user (userID),
+    CONSTRAINT fk_twofa_challenges_user FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+CREATE TABLE trusted_devices (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    userID INT NOT NULL,
+    tokenHash CHAR(64) NOT NULL,
+    userAgent VARCHAR(512) NOT NULL DEFAULT '',
+    ipAddress VARCHAR(45) NOT NULL DEFAULT '',
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lastUsedAt DATETIME NULL,
+    expiresAt DATETIME NOT NULL,
+    UNIQUE KEY uq_trusted_devices_token (tokenHash),
+    KEY idx_trusted_devices_user (userID),
+    CONSTRAINT fk_trusted_devices_user FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
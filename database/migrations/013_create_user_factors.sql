@@ -0,0 +1,24 @@
+CREATE TABLE user_factors (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    userID INT NOT NULL,
+    type VARCHAR(32) NOT NULL,
+    isDefault BOOLEAN NOT NULL DEFAULT FALSE,
+    codeHash CHAR(64) NULL,
+    codeExpiresAt DATETIME NULL,
+    confirmedAt DATETIME NULL,
+    lastUsedAt DATETIME NULL,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_user_factors_user_type (userID, type),
+    CONSTRAINT fk_user_factors_user FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
+
+INSERT INTO user_factors (userID, type, isDefault, confirmedAt)
+SELECT userID, 'totp', TRUE, confirmedAt FROM user_totp WHERE confirmedAt IS NOT NULL;
+
+INSERT INTO user_factors (userID, type, isDefault, confirmedAt)
+SELECT id, 'email', id NOT IN (SELECT userID FROM user_totp WHERE confirmedAt IS NOT NULL), NOW() FROM users WHERE isTwoFAEnabled = TRUE;
+
+INSERT INTO user_factors (userID, type, isDefault, confirmedAt)
+SELECT DISTINCT c.userID, 'webauthn', FALSE, NOW() FROM webauthn_credentials c JOIN users u ON u.id = c.userID WHERE u.isTwoFAEnabled = TRUE;
+
+ALTER TABLE users DROP COLUMN twoFACode, DROP COLUMN twoFACodeExpiration;
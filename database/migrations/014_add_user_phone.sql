@@ -0,0 +1,6 @@
+ALTER TABLE users
+    ADD COLUMN phoneNumber VARCHAR(16) NULL,
+    ADD COLUMN phoneVerified BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN phoneCodeHash CHAR(64) NULL,
+    ADD COLUMN phoneCodeExpiration DATETIME NULL,
+    ADD COLUMN recoveryCodeChannel VARCHAR(8) NULL;
@@ -0,0 +1,22 @@
+CREATE TABLE verification_codes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    userID INT NOT NULL,
+    purpose VARCHAR(32) NOT NULL,
+    channel VARCHAR(8) NOT NULL,
+    codeHash CHAR(64) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expiresAt DATETIME NOT NULL,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_verification_codes_user_purpose (userID, purpose),
+    KEY idx_verification_codes_expires_at (expiresAt),
+    CONSTRAINT fk_verification_codes_user FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
+
+ALTER TABLE user_factors DROP COLUMN codeHash, DROP COLUMN codeExpiresAt;
+
+ALTER TABLE users
+    DROP COLUMN passwordRecoveryCode,
+    DROP COLUMN recoveryCodeExpiration,
+    DROP COLUMN recoveryCodeChannel,
+    DROP COLUMN phoneCodeHash,
+    DROP COLUMN phoneCodeExpiration;
@@ -0,0 +1,23 @@
+CREATE TABLE login_throttles (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    subjectType VARCHAR(8) NOT NULL,
+    subject VARCHAR(64) NOT NULL,
+    failures INT NOT NULL DEFAULT 0,
+    lastFailureAt DATETIME NOT NULL,
+    lockedUntil DATETIME NULL,
+    unlockTokenHash CHAR(64) NULL,
+    UNIQUE KEY uq_login_throttles_subject (subjectType, subject),
+    UNIQUE KEY uq_login_throttles_unlock_token (unlockTokenHash)
+);
+
+CREATE TABLE security_events (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    userID INT NULL,
+    type VARCHAR(32) NOT NULL,
+    ipAddress VARCHAR(45) NOT NULL DEFAULT '',
+    userAgent VARCHAR(512) NOT NULL DEFAULT '',
+    details VARCHAR(255) NOT NULL DEFAULT '',
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_security_events_user (userID, createdAt),
+    CONSTRAINT fk_security_events_user FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
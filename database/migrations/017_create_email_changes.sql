@@ -0,0 +1,12 @@
+CREATE TABLE email_changes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    userID INT NOT NULL,
+    newEmail VARCHAR(255) NOT NULL,
+    cancelTokenHash CHAR(64) NOT NULL,
+    expiresAt DATETIME NOT NULL,
+    createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_email_changes_user (userID),
+    UNIQUE KEY uq_email_changes_cancel_token (cancelTokenHash),
+    KEY idx_email_changes_expires_at (expiresAt),
+    CONSTRAINT fk_email_changes_user FOREIGN KEY (userID) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,35 @@
+package entities
+
+import "time"
+
+const CodeChallengeMethodS256 = "S256"
+
+// AuthorizationRequest holds the parameters of an /oauth/authorize request
+// once they have been checked against the client registration.
+type AuthorizationRequest struct {
+	ClientID            string
+	ClientName          string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+// AuthorizationCode is issued at the end of the authorization flow and
+// exchanged once at the token endpoint. Only the hash of the code is stored.
+type AuthorizationCode struct {
+	CodeHash            string
+	ClientID            string
+	UserID              int
+	SessionID           string
+	RedirectURI         string
+	Scope               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	ExpiresAt           time.Time
+	UsedAt              *time.Time
+	CreatedAt           time.Time
+}
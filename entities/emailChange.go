@@ -0,0 +1,15 @@
+package entities
+
+import "time"
+
+// EmailChange is a change of a user's email address waiting for the code
+// sent to the new address. The old address is sent a link to cancel it,
+// whose token is only stored hashed. A user has at most one pending change.
+type EmailChange struct {
+	ID              int
+	UserID          int
+	NewEmail        string
+	CancelTokenHash string
+	ExpiresAt       time.Time
+	CreatedAt       time.Time
+}
@@ -0,0 +1,28 @@
+package entities
+
+import "time"
+
+// UserFactor is a second factor a user has added, of one of the TwoFAMethod
+// types other than recovery. It counts once ConfirmedAt is set, after the
+// user answered it for the first time. Codes sent by email, SMS or voice call
+// are VerificationCodes; the other factors keep their secrets in their own
+// tables.
+type UserFactor struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"-"`
+	Type        string     `json:"type"`
+	IsDefault   bool       `json:"isDefault"`
+	ConfirmedAt *time.Time `json:"confirmedAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// FactorResponse is the user's answer to a factor: a code, or the
+// credential returned by the browser for a WebAuthn ceremony. Name labels a
+// passkey that is being registered.
+type FactorResponse struct {
+	Code       string
+	CeremonyID string
+	Credential []byte
+	Name       string
+}
@@ -0,0 +1,26 @@
+package entities
+
+const (
+	SessionStatusActive  = "active"
+	SessionStatusRevoked = "revoked"
+	SessionStatusExpired = "expired"
+)
+
+// Introspection is the RFC 7662 token introspection response. SessionStatus
+// is an extension telling resource servers what happened to the session a
+// user token belongs to.
+type Introspection struct {
+	Active        bool     `json:"active"`
+	Scope         string   `json:"scope,omitempty"`
+	ClientID      string   `json:"client_id,omitempty"`
+	TokenType     string   `json:"token_type,omitempty"`
+	Subject       string   `json:"sub,omitempty"`
+	Audience      []string `json:"aud,omitempty"`
+	Issuer        string   `json:"iss,omitempty"`
+	ExpiresAt     int64    `json:"exp,omitempty"`
+	IssuedAt      int64    `json:"iat,omitempty"`
+	NotBefore     int64    `json:"nbf,omitempty"`
+	ID            string   `json:"jti,omitempty"`
+	AuthTime      int64    `json:"auth_time,omitempty"`
+	SessionStatus string   `json:"session_status,omitempty"`
+}
@@ -0,0 +1,46 @@
+package entities
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	LoginThrottleUser = "user"
+	LoginThrottleIP   = "ip"
+)
+
+// LoginThrottle counts the failed logins of one account or IP address.
+// Failures older than the failure window no longer count. While LockedUntil
+// is in the future no login is attempted, and a locked account can also be
+// unlocked with the link emailed to its owner, whose token is only stored
+// hashed.
+type LoginThrottle struct {
+	ID              int
+	SubjectType     string
+	Subject         string
+	Failures        int
+	LastFailureAt   time.Time
+	LockedUntil     *time.Time
+	UnlockTokenHash *string
+}
+
+// UserSubject is the subject of the throttle of a user account.
+func UserSubject(userID int) string {
+	return strconv.Itoa(userID)
+}
+
+// LoginThrottledError is returned by a login that was not attempted because
+// of earlier failures. RetryAfter is how long the client has to wait, and
+// Locked tells a temporary lockout from a progressive delay.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return "too many failed login attempts, the account is temporarily locked"
+	}
+	return "too many failed login attempts, please wait before trying again"
+}
@@ -0,0 +1,64 @@
+package entities
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+)
+
+// OAuthClient is an application registered with the authorization server.
+// Public clients, such as single page and mobile apps, cannot keep a secret
+// and are registered without one; they must use PKCE instead.
+type OAuthClient struct {
+	ClientID     string    `json:"clientId"`
+	SecretHash   string    `json:"-"`
+	Name         string    `json:"name"`
+	Public       bool      `json:"public"`
+	Scopes       []string  `json:"scopes"`
+	GrantTypes   []string  `json:"grantTypes"`
+	Audiences    []string  `json:"audiences"`
+	RedirectURIs []string  `json:"redirectUris"`
+	Active       bool      `json:"active"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func (c *OAuthClient) AllowsGrantType(grantType string) bool {
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+// AllowsRedirectURI reports whether uri is one of the registered redirect
+// URIs. Only exact matches are accepted.
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// GrantScopes resolves a space separated scope request against the scopes
+// the client is registered for. An empty request grants every allowed scope.
+func (c *OAuthClient) GrantScopes(requested string) ([]string, bool) {
+	if strings.TrimSpace(requested) == "" {
+		return c.Scopes, true
+	}
+
+	scopes := strings.Fields(requested)
+	for _, scope := range scopes {
+		if !slices.Contains(c.Scopes, scope) {
+			return nil, false
+		}
+	}
+	return scopes, true
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
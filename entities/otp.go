@@ -0,0 +1,47 @@
+package entities
+
+import (
+	"regexp"
+
+	"github.com/Renan-Parise/auth/errors"
+)
+
+const (
+	OTPChannelSMS   = "sms"
+	OTPChannelVoice = "voice"
+)
+
+var phoneNumberPattern = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// OTPMessage is a one-time code sent to a phone number, as a text message or
+// read out in a voice call. Code is sent apart from Body for providers that
+// word the message themselves.
+type OTPMessage struct {
+	PhoneNumber string `json:"phoneNumber"`
+	Channel     string `json:"channel"`
+	Code        string `json:"code"`
+	Body        string `json:"body"`
+}
+
+// ValidatePhoneNumber accepts numbers in E.164 format, such as +5511999990000.
+func ValidatePhoneNumber(phoneNumber string) error {
+	if phoneNumber == "" {
+		return errors.NewValidationError("phoneNumber", "phone number is required. please provide a valid phone number")
+	}
+
+	if !phoneNumberPattern.MatchString(phoneNumber) {
+		return errors.NewValidationError("phoneNumber", "phone number is invalid. please provide it in E.164 format, such as +5511999990000")
+	}
+
+	return nil
+}
+
+// ValidateOTPChannel accepts the channels a code can be sent to a phone
+// number through.
+func ValidateOTPChannel(channel string) error {
+	if channel != OTPChannelSMS && channel != OTPChannelVoice {
+		return errors.NewValidationError("channel", "channel is invalid. please use sms or voice")
+	}
+
+	return nil
+}
@@ -0,0 +1,385 @@
+package entities
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Renan-Parise/auth/errors"
+)
+
+// commonPasswordList holds frequently used passwords, most common first, one
+// per line.
+//
+//go:embed commonPasswords.txt
+var commonPasswordList string
+
+// commonPasswords maps each common password to its rank in the list.
+var commonPasswords = loadCommonPasswords()
+
+func loadCommonPasswords() map[string]int {
+	ranks := make(map[string]int)
+	for _, line := range strings.Split(commonPasswordList, "\n") {
+		password := strings.ToLower(strings.TrimSpace(line))
+		if _, exists := ranks[password]; password != "" && !exists {
+			ranks[password] = len(ranks) + 1
+		}
+	}
+	return ranks
+}
+
+// bcryptMaxBytes is the longest password bcrypt hashes.
+const bcryptMaxBytes = 72
+
+// PasswordPolicy decides which passwords users may choose. A zero MinLength,
+// MaxLength or MinStrength disables its rule. MinStrength is a score from 0
+// to 4 as computed by PasswordStrength.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	BlockCommon   bool
+	RejectSimilar bool
+	MinStrength   int
+}
+
+// Check returns ValidationErrors listing every rule the password breaks, or
+// nil when it follows the policy. userInputs are what the user is known by,
+// such as their username and email address, which the password must not
+// resemble.
+func (p PasswordPolicy) Check(password string, userInputs ...string) error {
+	if password == "" {
+		return errors.ValidationErrors{errors.NewRuleValidationError("password", "password_required", "password is required. please provide a valid password")}
+	}
+
+	var failures errors.ValidationErrors
+
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		failures = append(failures, errors.NewRuleValidationError("password", "password_too_short", fmt.Sprintf("password must be at least %d characters long", p.MinLength)))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		failures = append(failures, errors.NewRuleValidationError("password", "password_too_long", fmt.Sprintf("password must be at most %d characters long", p.MaxLength)))
+	} else if len(password) > bcryptMaxBytes {
+		failures = append(failures, errors.NewRuleValidationError("password", "password_too_long", fmt.Sprintf("password must be at most %d bytes long", bcryptMaxBytes)))
+	}
+
+	lowered := strings.ToLower(password)
+	if p.BlockCommon && isCommonPassword(lowered) {
+		failures = append(failures, errors.NewRuleValidationError("password", "password_common", "password is too common. please choose one that is harder to guess"))
+	}
+	if p.RejectSimilar && resemblesUserInputs(lowered, userInputs) {
+		failures = append(failures, errors.NewRuleValidationError("password", "password_similar", "password is too similar to your username or email"))
+	}
+	if p.MinStrength > 0 && PasswordStrength(password, userInputs...) < p.MinStrength {
+		failures = append(failures, errors.NewRuleValidationError("password", "password_weak", "password is too weak. please use a longer password with less predictable words"))
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+	return failures
+}
+
+// isCommonPassword reports whether the password, or what is left of it
+// without the digits and symbols around it, is on the common password list.
+func isCommonPassword(lowered string) bool {
+	if _, exists := commonPasswords[lowered]; exists {
+		return true
+	}
+
+	core := strings.TrimFunc(lowered, func(r rune) bool { return !unicode.IsLetter(r) })
+	_, exists := commonPasswords[core]
+	return utf8.RuneCountInString(core) >= 4 && exists
+}
+
+// userInputTokens splits the user inputs into the lowercase values the
+// password is compared against, adding the local part of email addresses.
+func userInputTokens(userInputs []string) []string {
+	tokens := []string{}
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if utf8.RuneCountInString(input) < 3 {
+			continue
+		}
+		tokens = append(tokens, input)
+
+		if local, _, found := strings.Cut(input, "@"); found && utf8.RuneCountInString(local) >= 3 {
+			tokens = append(tokens, local)
+		}
+	}
+	return tokens
+}
+
+// resemblesUserInputs reports whether the password is a few edits away from
+// one of the user inputs, or is one of them with a few characters around it.
+func resemblesUserInputs(lowered string, userInputs []string) bool {
+	plain := unleet(lowered)
+
+	for _, token := range userInputTokens(userInputs) {
+		if levenshtein(plain, token) <= utf8.RuneCountInString(token)/4+1 {
+			return true
+		}
+
+		for _, candidate := range []string{lowered, plain} {
+			if utf8.RuneCountInString(token) >= 4 && strings.Contains(candidate, token) {
+				rest := utf8.RuneCountInString(candidate) - utf8.RuneCountInString(token)
+				if rest < 6 {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// PasswordStrength estimates on a scale from 0 to 4 how hard a password is to guess, like zxcvbn.
+func PasswordStrength(password string, userInputs ...string) int {
+	guesses := estimateGuesses(password, userInputTokens(userInputs))
+
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func estimateGuesses(password string, userTokens []string) float64 {
+	runes := []rune(password)
+	lowered := []rune(strings.ToLower(password))
+	plain := []rune(unleet(string(lowered)))
+
+	total := 0.0
+	var bruteForce []rune
+
+	flush := func() {
+		if len(bruteForce) > 0 {
+			total += float64(len(bruteForce)) * math.Log10(float64(charsetSize(bruteForce)))
+			bruteForce = nil
+		}
+	}
+
+	for i := 0; i < len(runes); {
+		length, guesses := matchPattern(runes, lowered, plain, i, userTokens)
+		if length == 0 {
+			bruteForce = append(bruteForce, runes[i])
+			i++
+			continue
+		}
+
+		flush()
+		total += math.Log10(guesses)
+		i += length
+	}
+	flush()
+
+	return total
+}
+
+// matchPattern finds the longest pattern starting at i and returns its length
+// and how many guesses it takes, or zero when none starts there.
+func matchPattern(runes, lowered, plain []rune, i int, userTokens []string) (int, float64) {
+	bestLength, bestGuesses := 0, 0.0
+	consider := func(length int, guesses float64) {
+		if length > bestLength || (length == bestLength && guesses < bestGuesses) {
+			bestLength, bestGuesses = length, guesses
+		}
+	}
+
+	for j := len(runes); j >= i+3; j-- {
+		rank := dictionaryRank(string(lowered[i:j]), string(plain[i:j]), userTokens)
+		if rank > 0 {
+			guesses := float64(rank) * caseVariations(runes[i:j])
+			if string(lowered[i:j]) != string(plain[i:j]) {
+				guesses *= 2
+			}
+			consider(j-i, guesses)
+			break
+		}
+	}
+
+	if length := repeatLength(lowered, i); length >= 3 {
+		consider(length, float64(charsetSize(runes[i:i+1])*length))
+	}
+
+	if length, base := sequenceLength(lowered, i); length >= 3 {
+		consider(length, float64(base*length))
+	}
+
+	if i+4 <= len(runes) {
+		if year, err := strconv.Atoi(string(runes[i : i+4])); err == nil && year >= 1900 && year <= 2099 {
+			consider(4, 200)
+		}
+	}
+
+	return bestLength, bestGuesses
+}
+
+// dictionaryRank returns the rank of a word on the common password list or
+// among the user inputs, which rank first, or zero when it is on neither.
+func dictionaryRank(lowered, plain string, userTokens []string) int {
+	for i, token := range userTokens {
+		if token == lowered || token == plain {
+			return i + 1
+		}
+	}
+
+	if utf8.RuneCountInString(lowered) < 4 {
+		return 0
+	}
+	if rank, exists := commonPasswords[lowered]; exists {
+		return rank
+	}
+	return commonPasswords[plain]
+}
+
+func caseVariations(word []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			upper++
+		} else if unicode.IsLower(r) {
+			lower++
+		}
+	}
+
+	switch {
+	case upper == 0:
+		return 1
+	case lower == 0 || (upper == 1 && unicode.IsUpper(word[0])):
+		return 2
+	default:
+		return math.Pow(2, float64(min(upper, lower)+1))
+	}
+}
+
+func repeatLength(lowered []rune, i int) int {
+	length := 1
+	for i+length < len(lowered) && lowered[i+length] == lowered[i] {
+		length++
+	}
+	return length
+}
+
+// keyboardRows are typed in order often enough to count as sequences. They
+// are ASCII, so byte and rune positions match.
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+func sequenceLength(lowered []rune, i int) (int, int) {
+	bestLength, bestBase := 1, 0
+
+	for _, delta := range []int{1, -1} {
+		length := 1
+		for i+length < len(lowered) && int(lowered[i+length])-int(lowered[i+length-1]) == delta &&
+			(unicode.IsDigit(lowered[i+length]) || unicode.IsLetter(lowered[i+length])) {
+			length++
+		}
+		if length > bestLength {
+			bestLength, bestBase = length, 26
+			if unicode.IsDigit(lowered[i]) {
+				bestBase = 10
+			}
+		}
+	}
+
+	for _, row := range keyboardRows {
+		for _, keys := range []string{row, reverseString(row)} {
+			start := strings.IndexRune(keys, lowered[i])
+			if start < 0 {
+				continue
+			}
+
+			length := 1
+			for i+length < len(lowered) && start+length < len(keys) && lowered[i+length] == rune(keys[start+length]) {
+				length++
+			}
+			if length > bestLength {
+				bestLength, bestBase = length, 2*len(keys)*len(keyboardRows)
+			}
+		}
+	}
+
+	return bestLength, bestBase
+}
+
+func reverseString(value string) string {
+	runes := []rune(value)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// charsetSize is the number of characters an attacker tries for each
+// character, from the kinds of characters the run contains.
+func charsetSize(run []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range run {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < utf8.RuneSelf:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			size += class.size
+		}
+	}
+	return size
+}
+
+// leetSubstitutions undoes the usual l33t spellings, such as p@ssw0rd.
+var leetSubstitutions = strings.NewReplacer("4", "a", "@", "a", "8", "b", "3", "e", "6", "g", "1", "i", "!", "i", "0", "o", "5", "s", "$", "s", "7", "t", "2", "z")
+
+// unleet replaces l33t characters one for one, so positions keep matching.
+func unleet(lowered string) string {
+	return leetSubstitutions.Replace(lowered)
+}
+
+// levenshtein is the number of single character edits between a and b.
+func levenshtein(a, b string) int {
+	first, second := []rune(a), []rune(b)
+	previous := make([]int, len(second)+1)
+	current := make([]int, len(second)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(first); i++ {
+		current[0] = i
+		for j := 1; j <= len(second); j++ {
+			cost := 1
+			if first[i-1] == second[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(second)]
+}
@@ -0,0 +1,23 @@
+package entities
+
+import "time"
+
+const (
+	SecurityEventLoginFailed     = "login_failed"
+	SecurityEventAccountLocked   = "account_locked"
+	SecurityEventIPLocked        = "ip_locked"
+	SecurityEventAccountUnlocked = "account_unlocked"
+)
+
+// SecurityEvent records something that happened to an account, such as a
+// failed login or a lockout. UserID is nil for events that could not be tied
+// to an account, such as logins for an unknown email address.
+type SecurityEvent struct {
+	ID        int       `json:"id"`
+	UserID    *int      `json:"userId"`
+	Type      string    `json:"type"`
+	IPAddress string    `json:"ipAddress"`
+	UserAgent string    `json:"userAgent"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,38 @@
+package entities
+
+import "time"
+
+// Authentication method references (RFC 8176) recorded on sessions and
+// carried in the amr claim.
+const (
+	AuthMethodPassword = "pwd"
+	AuthMethodOTP      = "otp"
+	AuthMethodMFA      = "mfa"
+	AuthMethodHardware = "hwk"
+)
+
+// ClientInfo describes the client a request comes from. DeviceToken is set
+// when the client presents the token of a trusted device.
+type ClientInfo struct {
+	UserAgent   string
+	IPAddress   string
+	DeviceToken string
+}
+
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"-"`
+	UserAgent  string     `json:"userAgent"`
+	IPAddress  string     `json:"ipAddress"`
+	AuthTime   time.Time  `json:"authTime"`
+	AMR        []string   `json:"amr"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"-"`
+	Current    bool       `json:"current"`
+}
+
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
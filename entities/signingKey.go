@@ -0,0 +1,22 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/Renan-Parise/auth/errors"
+)
+
+var ErrKeyRotationUnsupported = errors.NewServiceError("signing keys can only be rotated with an asymmetric JWT_SIGNING_ALG")
+
+// SigningKey is a rotated key. It is published from CreatedAt on but only
+// signs tokens from ActivatesAt, so that every instance and JWKS consumer
+// knows it by then.
+type SigningKey struct {
+	KeyID       string     `json:"kid"`
+	Algorithm   string     `json:"alg"`
+	PrivateKey  string     `json:"-"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ActivatesAt time.Time  `json:"activatesAt"`
+	RetiredAt   *time.Time `json:"retiredAt"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,34 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/Renan-Parise/auth/errors"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.NewServiceError("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.NewServiceError("refresh token reuse detected. all tokens of this login were revoked")
+)
+
+type Tokens struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"`
+	DeviceToken  string `json:"deviceToken,omitempty"`
+	Scope        string `json:"-"`
+}
+
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	SessionID string
+	ClientID  string
+	Scope     string
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,30 @@
+package entities
+
+import "time"
+
+const (
+	TwoFAMethodEmail    = "email"
+	TwoFAMethodTOTP     = "totp"
+	TwoFAMethodRecovery = "recovery"
+	TwoFAMethodWebAuthn = "webauthn"
+	TwoFAMethodSMS      = "sms"
+	TwoFAMethodVoice    = "voice"
+)
+
+// TOTP is a user's authenticator app enrollment. It only counts as a second
+// factor once ConfirmedAt is set, after the user entered a first code.
+type TOTP struct {
+	UserID       int        `json:"-"`
+	Secret       string     `json:"-"`
+	ConfirmedAt  *time.Time `json:"confirmedAt"`
+	LastUsedStep *int64     `json:"-"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// TOTPEnrollment is returned when enrollment starts. The secret is shown
+// only once, as text, as an otpauth:// URI and as a QR code PNG.
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+	QRCode          []byte `json:"qrCode"`
+}
@@ -0,0 +1,18 @@
+package entities
+
+import "time"
+
+// TrustedDevice is a device on which the user chose to skip 2FA until
+// ExpiresAt. The device proves itself with a token that is only stored
+// hashed, and only together with the browser it was issued to.
+type TrustedDevice struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	TokenHash  string     `json:"-"`
+	UserAgent  string     `json:"userAgent"`
+	IPAddress  string     `json:"ipAddress"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	Current    bool       `json:"current"`
+}
@@ -0,0 +1,38 @@
+package entities
+
+import "time"
+
+// TwoFAChallengeMaxAttempts is how many second factor attempts one login may
+// make before the user has to enter the password again.
+const TwoFAChallengeMaxAttempts = 5
+
+// TwoFAChallenge is a login waiting for its second factor. It remembers the
+// client the password was entered from, and the session started once the
+// second factor is confirmed is recorded for that client.
+type TwoFAChallenge struct {
+	ID        string
+	UserID    int
+	Method    string
+	UserAgent string
+	IPAddress string
+	Attempts  int
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// TwoFARequiredError is returned by a login that must be completed with a
+// second factor. Challenge is the signed token /auth/fa/confirm requires, and
+// Method tells the client where the user finds the code. Options holds what
+// the factor needs to be answered, such as WebAuthn options, if anything.
+// Methods lists every factor of the user, any of which may answer instead.
+type TwoFARequiredError struct {
+	Method    string
+	Challenge string
+	Options   interface{}
+	Methods   []string
+}
+
+func (e *TwoFARequiredError) Error() string {
+	return "2FA required"
+}
@@ -7,20 +7,17 @@ import (
 	"github.com/Renan-Parise/auth/errors"
 )
 
-var ErrTwoFARequired = errors.NewServiceError("2FA required")
-
 type User struct {
-	ID                    int        `json:"id"`
-	Username              string     `json:"username"`
-	Email                 string     `json:"email"`
-	Password              string     `json:"password"`
-	Active                bool       `json:"active"`
-	DeactivatedAt         *time.Time `json:"deactivatedAt"`
-	Is2FAEnabled          bool       `json:"is2FAEnabled"`
-	TwoFACode             *string    `json:"-"`
-	TwoFACodeExpiresAt    *time.Time `json:"-"`
-	PasswordRecoveryCode  *string    `json:"-"`
-	RecoveryCodeExpiresAt *time.Time `json:"-"`
+	ID            int        `json:"id"`
+	Username      string     `json:"username"`
+	Email         string     `json:"email"`
+	EmailVerified bool       `json:"emailVerified"`
+	Password      string     `json:"password"`
+	Active        bool       `json:"active"`
+	DeactivatedAt *time.Time `json:"deactivatedAt"`
+	PhoneNumber   *string    `json:"phoneNumber"`
+	PhoneVerified bool       `json:"phoneVerified"`
+	Is2FAEnabled  bool       `json:"is2FAEnabled"`
 }
 
 func (u *User) Validate() error {
@@ -32,13 +29,41 @@ func (u *User) Validate() error {
 		return errors.NewValidationError("email", "email is required. please provide a valid email")
 	}
 
-	if !regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`).MatchString(u.Email) {
-		return errors.NewValidationError("email", "email is invalid. please provide a valid email")
+	if err := ValidateEmail(u.Email); err != nil {
+		return err
 	}
 
-	if u.Password == "" {
+	if err := ValidatePassword(u.Password); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func ValidatePassword(password string) error {
+	if password == "" {
 		return errors.NewValidationError("password", "password is required. please provide a valid password")
 	}
 
 	return nil
 }
+
+var emailPattern = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+func ValidateEmail(email string) error {
+	if !emailPattern.MatchString(email) {
+		return errors.NewValidationError("email", "email is invalid. please provide a valid email")
+	}
+
+	return nil
+}
+
+// EmailNotVerifiedError is returned by logins of users who have not verified
+// their email address yet, when LOGIN_REQUIRES_VERIFIED_EMAIL is set.
+type EmailNotVerifiedError struct {
+	Email string
+}
+
+func (e *EmailNotVerifiedError) Error() string {
+	return "email address is not verified. please check your inbox or request a new verification email"
+}
@@ -0,0 +1,35 @@
+package entities
+
+import "time"
+
+// VerificationCodeMaxAttempts is how many wrong guesses a verification code
+// survives before a new one has to be requested.
+const VerificationCodeMaxAttempts = 5
+
+const (
+	VerificationPurposePasswordRecovery = "password_recovery"
+	VerificationPurposePhone            = "phone"
+	VerificationPurposeEmail            = "email"
+	VerificationPurposeEmailChange      = "email_change"
+)
+
+// VerificationPurposeFactor is the purpose of the codes that answer a factor
+// of the given type.
+func VerificationPurposeFactor(factorType string) string {
+	return "factor:" + factorType
+}
+
+// VerificationCode is a short code sent to a user by email, text message or
+// voice call. A user has at most one per purpose, issuing another replaces
+// it, and only an HMAC of the code is stored. Channel records where it was
+// sent.
+type VerificationCode struct {
+	ID        int
+	UserID    int
+	Purpose   string
+	Channel   string
+	CodeHash  string
+	Attempts  int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
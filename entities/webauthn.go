@@ -0,0 +1,55 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/Renan-Parise/auth/errors"
+)
+
+var ErrLastPasskey = errors.NewServiceError("remove the passkey 2FA method before your last passkey")
+
+// WebAuthn ceremony types. Login ceremonies without a user are passwordless
+// and accept any of the user's discoverable credentials.
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonyLogin        = "login"
+)
+
+// WebAuthnCredential is a registered passkey or security key. SignCount is
+// the last signature counter seen from the authenticator and is used to
+// detect cloned keys.
+type WebAuthnCredential struct {
+	ID              int        `json:"id"`
+	UserID          int        `json:"-"`
+	CredentialID    []byte     `json:"-"`
+	PublicKey       []byte     `json:"-"`
+	AttestationType string     `json:"-"`
+	Transports      []string   `json:"transports"`
+	AAGUID          []byte     `json:"-"`
+	SignCount       uint32     `json:"-"`
+	BackupEligible  bool       `json:"backupEligible"`
+	BackupState     bool       `json:"backupState"`
+	Name            string     `json:"name"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	LastUsedAt      *time.Time `json:"lastUsedAt"`
+}
+
+// WebAuthnCeremony holds the server side state of a registration or login
+// between the options and the authenticator response. It can be completed
+// only once.
+type WebAuthnCeremony struct {
+	ID          string
+	UserID      int
+	Type        string
+	SessionData []byte
+	ExpiresAt   time.Time
+	CreatedAt   time.Time
+}
+
+// WebAuthnChallenge is handed to the browser, which passes Options to
+// navigator.credentials.create or get and sends the result back together
+// with CeremonyID.
+type WebAuthnChallenge struct {
+	CeremonyID string      `json:"ceremonyId"`
+	Options    interface{} `json:"options"`
+}
@@ -7,9 +7,10 @@ import (
 )
 
 type ValidationError struct {
-	Field   string
-	Message string
-	Method  string
+	Field   string `json:"field"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	Method  string `json:"-"`
 }
 
 func (e *ValidationError) Error() string {
@@ -20,6 +21,24 @@ func NewValidationError(field, message string) *ValidationError {
 	return &ValidationError{Field: field, Message: message, Method: getCallerMethodName()}
 }
 
+// NewRuleValidationError is a ValidationError that also names the rule that
+// failed with a code clients can rely on, such as password_too_short.
+func NewRuleValidationError(field, code, message string) *ValidationError {
+	return &ValidationError{Field: field, Code: code, Message: message, Method: getCallerMethodName()}
+}
+
+// ValidationErrors collects every rule a value breaks, so that clients can
+// show them all at once.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = fmt.Sprintf("field '%s': %s", err.Field, err.Message)
+	}
+	return "Error while validating: " + strings.Join(messages, "; ") + "."
+}
+
 type QueryError struct {
 	Reason string
 	Method string
@@ -59,6 +78,22 @@ func NewServiceError(reason string) *ServiceError {
 	return &ServiceError{Reason: reason, Method: getCallerMethodName()}
 }
 
+// OAuthError carries one of the error codes defined by RFC 6749 so that OAuth
+// endpoints can report it to clients unchanged.
+type OAuthError struct {
+	Code        string
+	Description string
+	Method      string
+}
+
+func (e *OAuthError) Error() string {
+	return fmt.Sprintf("OAuth error: %s: %s. Event occurred in method: %s.", e.Code, e.Description, e.Method)
+}
+
+func NewOAuthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description, Method: getCallerMethodName()}
+}
+
 func getCallerMethodName() string {
 	pc, _, _, ok := runtime.Caller(2)
 	if !ok {
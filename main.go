@@ -2,10 +2,12 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"github.com/Renan-Parise/auth/database"
 	"github.com/Renan-Parise/auth/repositories"
 	"github.com/Renan-Parise/auth/routes"
+	"github.com/Renan-Parise/auth/services"
 	"github.com/Renan-Parise/auth/utils"
 	"github.com/joho/godotenv"
 	"github.com/robfig/cron/v3"
@@ -20,9 +22,49 @@ func main() {
 	utils.InitLogger()
 	utils.InitElasticAPM()
 
+	err = utils.CheckEmailLinks()
+	if err != nil {
+		log.Fatal("Error in email link configuration: ", err)
+	}
+
+	err = utils.LoadSigningKey()
+	if err != nil {
+		log.Fatal("Error loading JWT signing key: ", err)
+	}
+
+	if utils.GetKeyRotationInterval() > 0 && !utils.SupportsKeyRotation(utils.GetJWTSigningAlgorithm()) {
+		log.Fatal("JWT_KEY_ROTATION_INTERVAL requires an asymmetric JWT_SIGNING_ALG")
+	}
+
 	database.GetDBInstance()
 
+	keyService := services.NewKeyService(repositories.NewSigningKeyRepository())
+	err = keyService.LoadKeys()
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to load signing keys: ", err)
+	}
+
 	c := cron.New()
+	_, err = c.AddFunc("@every 1m", func() {
+		err := keyService.LoadKeys()
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to reload signing keys in cron job: ", err)
+		}
+	})
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to schedule cron job: ", err)
+	}
+	if interval := utils.GetKeyRotationInterval(); interval > 0 {
+		_, err = c.AddFunc("@every "+interval.String(), func() {
+			_, err := keyService.RotateKeys()
+			if err != nil {
+				utils.GetLogger().WithError(err).Error("Failed to rotate signing keys in cron job: ", err)
+			}
+		})
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to schedule cron job: ", err)
+		}
+	}
 	_, err = c.AddFunc("@weekly", func() {
 		userRepo := repositories.NewUserRepository()
 		err := userRepo.DeleteInactiveUsers()
@@ -33,6 +75,70 @@ func main() {
 	if err != nil {
 		utils.GetLogger().WithError(err).Error("Failed to schedule cron job: ", err)
 	}
+	_, err = c.AddFunc("@daily", func() {
+		refreshTokenRepo := repositories.NewRefreshTokenRepository()
+		err := refreshTokenRepo.DeleteExpired()
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to delete expired refresh tokens in cron job: ", err)
+		}
+
+		sessionRepo := repositories.NewSessionRepository()
+		err = sessionRepo.DeleteExpired()
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to delete expired sessions in cron job: ", err)
+		}
+
+		signingKeyRepo := repositories.NewSigningKeyRepository()
+		err = signingKeyRepo.DeleteExpired()
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to delete expired signing keys in cron job: ", err)
+		}
+
+		authorizationCodeRepo := repositories.NewAuthorizationCodeRepository()
+		err = authorizationCodeRepo.DeleteExpired()
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to delete expired authorization codes in cron job: ", err)
+		}
+
+		webauthnCeremonyRepo := repositories.NewWebAuthnCeremonyRepository()
+		err = webauthnCeremonyRepo.DeleteExpired()
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to delete expired WebAuthn ceremonies in cron job: ", err)
+		}
+
+		twoFAChallengeRepo := repositories.NewTwoFAChallengeRepository()
+		err = twoFAChallengeRepo.DeleteExpired()
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to delete expired 2FA challenges in cron job: ", err)
+		}
+
+		trustedDeviceRepo := repositories.NewTrustedDeviceRepository()
+		err = trustedDeviceRepo.DeleteExpired()
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to delete expired trusted devices in cron job: ", err)
+		}
+
+		verificationCodeRepo := repositories.NewVerificationCodeRepository()
+		err = verificationCodeRepo.DeleteExpired()
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to delete expired verification codes in cron job: ", err)
+		}
+
+		loginThrottleRepo := repositories.NewLoginThrottleRepository()
+		err = loginThrottleRepo.DeleteExpired(time.Now().Add(-utils.GetLoginFailureWindow()))
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to delete expired login throttles in cron job: ", err)
+		}
+
+		emailChangeRepo := repositories.NewEmailChangeRepository()
+		err = emailChangeRepo.DeleteExpired()
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to delete expired email changes in cron job: ", err)
+		}
+	})
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to schedule cron job: ", err)
+	}
 	c.Start()
 	defer c.Stop()
 
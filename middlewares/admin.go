@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminMiddleware guards operational endpoints with the ADMIN_API_KEY shared
+// secret, sent in the X-Admin-Key header. The endpoints are disabled while no
+// key is configured.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminKey := utils.GetAdminAPIKey()
+		if adminKey == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin endpoints are disabled"})
+			return
+		}
+
+		providedKey := c.GetHeader("X-Admin-Key")
+		if subtle.ConstantTimeCompare([]byte(providedKey), []byte(adminKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin key"})
+			return
+		}
+
+		c.Next()
+	}
+}
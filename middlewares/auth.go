@@ -3,13 +3,31 @@ package middlewares
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/Renan-Parise/auth/repositories"
 	"github.com/Renan-Parise/auth/utils"
 	"github.com/gin-gonic/gin"
 )
 
+// lastSeenResolution bounds how often a session's last-seen time is written,
+// so that busy clients do not cause a database write per request.
+const lastSeenResolution = time.Minute
+
+// AuthMiddleware accepts the user access tokens this service issues to its own
+// apps. Tokens issued to OAuth clients are refused, as they only act for the
+// user within the scopes they were granted, which these routes do not check.
 func AuthMiddleware() gin.HandlerFunc {
+	return authenticate(false)
+}
+
+// ClientAuthMiddleware also accepts user access tokens issued to OAuth
+// clients, for routes such as userinfo that check the granted scope.
+func ClientAuthMiddleware() gin.HandlerFunc {
+	return authenticate(true)
+}
+
+func authenticate(allowClients bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -25,18 +43,30 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		tokenString := tokenParts[1]
 
-		claims, err := utils.ValidateToken(tokenString)
+		claims, err := utils.ValidateToken(tokenString, utils.GetJWTAudience())
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid authentication token: " + err.Error()})
 			return
 		}
 
-		IDFloat, ok := claims["user_id"].(float64)
-		if !ok {
+		if claims.ClientID != "" && !allowClients {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "tokens issued to OAuth clients cannot be used here"})
+			return
+		}
+
+		ID, err := claims.UserID()
+		if err != nil || claims.ID == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid authentication token"})
 			return
 		}
-		ID := int(IDFloat)
+		sessionID := claims.ID
+
+		sessionRepo := repositories.NewSessionRepository()
+		session, err := sessionRepo.FindByID(sessionID)
+		if err != nil || session.UserID != ID || !session.IsActive() {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session has expired or was revoked"})
+			return
+		}
 
 		userRepo := repositories.NewUserRepository()
 		user, err := userRepo.FindByID(ID)
@@ -49,7 +79,16 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if time.Since(session.LastSeenAt) > lastSeenResolution {
+			err = sessionRepo.Touch(sessionID, time.Now())
+			if err != nil {
+				utils.GetLogger().WithError(err).Warn("Failed to update session last seen time")
+			}
+		}
+
 		c.Set("ID", ID)
+		c.Set("SessionID", sessionID)
+		c.Set("Claims", claims)
 		c.Next()
 	}
 }
@@ -0,0 +1,112 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitKey picks what a policy counts requests by. Requests for which it
+// returns an empty key are not limited.
+type RateLimitKey func(c *gin.Context) string
+
+// ClientIP only trusts forwarded addresses from TRUSTED_PROXIES.
+func ClientIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+func RateLimitByIP(c *gin.Context) string {
+	return "ip:" + ClientIP(c)
+}
+
+// RateLimitByEmail counts requests by the email field of the JSON body, which
+// is put back for the handler to bind.
+func RateLimitByEmail(c *gin.Context) string {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return ""
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var request struct {
+		Email string `json:"email"`
+	}
+	if json.Unmarshal(body, &request) != nil {
+		return ""
+	}
+
+	email := strings.ToLower(strings.TrimSpace(request.Email))
+	if email == "" {
+		return ""
+	}
+	return "email:" + email
+}
+
+// RateLimitByUser counts requests by the authenticated user, so it runs after
+// AuthMiddleware.
+func RateLimitByUser(c *gin.Context) string {
+	ID, exists := c.Get("ID")
+	if !exists {
+		return ""
+	}
+	return fmt.Sprintf("user:%v", ID)
+}
+
+// RateLimitMiddleware lets requests through when the store fails.
+func RateLimitMiddleware(limiter *utils.RateLimiter, policy utils.RateLimitPolicy, key RateLimitKey) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if policy.Limit == 0 {
+			c.Next()
+			return
+		}
+
+		subject := key(c)
+		if subject == "" {
+			c.Next()
+			return
+		}
+
+		result, err := limiter.Allow(policy, subject)
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to check rate limit in middleware RateLimitMiddleware: ", err)
+			c.Next()
+			return
+		}
+
+		setRateLimitHeaders(c, policy, result)
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many requests, please try again later"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func setRateLimitHeaders(c *gin.Context, policy utils.RateLimitPolicy, result utils.RateLimitResult) {
+	if previous := c.Writer.Header().Get("RateLimit-Remaining"); previous != "" {
+		if remaining, err := strconv.Atoi(previous); err == nil && remaining <= result.Remaining {
+			return
+		}
+	}
+
+	c.Header("RateLimit-Limit", strconv.Itoa(policy.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, ceilSeconds(policy.Window)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
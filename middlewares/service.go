@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/Renan-Parise/auth/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ServiceAuthMiddleware authenticates calls from other services with the HTTP
+// Basic credentials of a registered OAuth client that holds scope.
+func ServiceAuthMiddleware(oauthService services.OAuthService, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, secret, ok := c.Request.BasicAuth()
+		if !ok {
+			c.Header("WWW-Authenticate", `Basic realm="auth"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+			return
+		}
+
+		client, err := oauthService.AuthenticateClient(clientID, secret)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Basic realm="auth"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+			return
+		}
+
+		if !slices.Contains(client.Scopes, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient_scope"})
+			return
+		}
+
+		c.Set("ClientID", client.ClientID)
+		c.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/repositories"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// StepUpMiddleware requires a recent auth_time, and mfa for users with 2FA.
+func StepUpMiddleware(userRepo repositories.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.MustGet("Claims").(*utils.Claims)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		user, err := userRepo.FindByID(c.GetInt("ID"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		maxAge := utils.GetStepUpMaxAge()
+		recent := claims.AuthTime != 0 && time.Since(time.Unix(claims.AuthTime, 0)) <= maxAge
+		mfa := !user.Is2FAEnabled || slices.Contains(claims.AMR, entities.AuthMethodMFA)
+
+		if !recent || !mfa {
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_user_authentication", error_description="recent authentication required", max_age=%d`, int(maxAge.Seconds())))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":       "step_up_required",
+				"message":     "please confirm it is you at /auth/reauthenticate to continue",
+				"maxAge":      int(maxAge.Seconds()),
+				"authTime":    claims.AuthTime,
+				"mfaRequired": user.Is2FAEnabled,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type AuthorizationCodeRepository interface {
+	Create(code entities.AuthorizationCode) error
+	FindByHash(hash string) (*entities.AuthorizationCode, error)
+	MarkUsed(hash string) (bool, error)
+	DeleteExpired() error
+}
+
+type authorizationCodeRepository struct{}
+
+func NewAuthorizationCodeRepository() AuthorizationCodeRepository {
+	return &authorizationCodeRepository{}
+}
+
+func (r *authorizationCodeRepository) Create(code entities.AuthorizationCode) error {
+	db := database.GetDBInstance()
+	query := "INSERT INTO oauth_authorization_codes (codeHash, clientID, userID, sessionID, redirectURI, scope, codeChallenge, codeChallengeMethod, nonce, expiresAt) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err := db.Exec(query,
+		code.CodeHash,
+		code.ClientID,
+		code.UserID,
+		code.SessionID,
+		code.RedirectURI,
+		code.Scope,
+		code.CodeChallenge,
+		code.CodeChallengeMethod,
+		code.Nonce,
+		code.ExpiresAt,
+	)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to create authorization code in repository method Create: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *authorizationCodeRepository) FindByHash(hash string) (*entities.AuthorizationCode, error) {
+	db := database.GetDBInstance()
+	code := &entities.AuthorizationCode{}
+	query := "SELECT codeHash, clientID, userID, sessionID, redirectURI, scope, codeChallenge, codeChallengeMethod, nonce, expiresAt, usedAt, createdAt FROM oauth_authorization_codes WHERE codeHash = ?"
+
+	var expiresAt, createdAt string
+	var usedAt sql.NullString
+
+	err := db.QueryRow(query, hash).Scan(
+		&code.CodeHash,
+		&code.ClientID,
+		&code.UserID,
+		&code.SessionID,
+		&code.RedirectURI,
+		&code.Scope,
+		&code.CodeChallenge,
+		&code.CodeChallengeMethod,
+		&code.Nonce,
+		&expiresAt,
+		&usedAt,
+		&createdAt,
+	)
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	if code.ExpiresAt, err = parseTime(expiresAt); err != nil {
+		return nil, err
+	}
+	if code.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if code.UsedAt, err = parseNullTime(usedAt); err != nil {
+		return nil, err
+	}
+
+	return code, nil
+}
+
+// MarkUsed consumes the code. It reports false when the code had already
+// been exchanged, so a replayed code is detected even under concurrency.
+func (r *authorizationCodeRepository) MarkUsed(hash string) (bool, error) {
+	db := database.GetDBInstance()
+	query := "UPDATE oauth_authorization_codes SET usedAt = ? WHERE codeHash = ? AND usedAt IS NULL"
+	result, err := db.Exec(query, time.Now(), hash)
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *authorizationCodeRepository) DeleteExpired() error {
+	db := database.GetDBInstance()
+	query := "DELETE FROM oauth_authorization_codes WHERE expiresAt <= ?"
+	result, err := db.Exec(query, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete expired authorization codes in repository method DeleteExpired: ", err)
+		return errors.NewQueryError(err.Error())
+	}
+	rowsAffected, _ := result.RowsAffected()
+	utils.GetLogger().Infof("Deleted %d expired authorization codes.", rowsAffected)
+	return nil
+}
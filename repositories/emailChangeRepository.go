@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type EmailChangeRepository interface {
+	Save(change entities.EmailChange) error
+	FindActive(userID int) (*entities.EmailChange, error)
+	FindByCancelToken(tokenHash string) (*entities.EmailChange, error)
+	Delete(ID int) (bool, error)
+	DeleteExpired() error
+}
+
+type emailChangeRepository struct{}
+
+func NewEmailChangeRepository() EmailChangeRepository {
+	return &emailChangeRepository{}
+}
+
+const emailChangeColumns = "id, userID, newEmail, cancelTokenHash, expiresAt, createdAt"
+
+// Save stores a pending change of the user's email, replacing the previous
+// one.
+func (r *emailChangeRepository) Save(change entities.EmailChange) error {
+	db := database.GetDBInstance()
+	query := "INSERT INTO email_changes (userID, newEmail, cancelTokenHash, expiresAt, createdAt) VALUES (?, ?, ?, ?, ?) " +
+		"ON DUPLICATE KEY UPDATE newEmail = VALUES(newEmail), cancelTokenHash = VALUES(cancelTokenHash), expiresAt = VALUES(expiresAt), createdAt = VALUES(createdAt)"
+	_, err := db.Exec(query, change.UserID, change.NewEmail, change.CancelTokenHash, change.ExpiresAt, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to save email change in repository method Save: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *emailChangeRepository) FindActive(userID int) (*entities.EmailChange, error) {
+	db := database.GetDBInstance()
+	query := "SELECT " + emailChangeColumns + " FROM email_changes WHERE userID = ? AND expiresAt > ?"
+	return scanEmailChange(db.QueryRow(query, userID, time.Now()))
+}
+
+func (r *emailChangeRepository) FindByCancelToken(tokenHash string) (*entities.EmailChange, error) {
+	db := database.GetDBInstance()
+	query := "SELECT " + emailChangeColumns + " FROM email_changes WHERE cancelTokenHash = ? AND expiresAt > ?"
+	return scanEmailChange(db.QueryRow(query, tokenHash, time.Now()))
+}
+
+// Delete removes the pending change and reports whether it was still there,
+// so that a change is only ever applied or cancelled once.
+func (r *emailChangeRepository) Delete(ID int) (bool, error) {
+	db := database.GetDBInstance()
+	query := "DELETE FROM email_changes WHERE id = ?"
+	result, err := db.Exec(query, ID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete email change in repository method Delete: ", err)
+
+		return false, errors.NewQueryError(err.Error())
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *emailChangeRepository) DeleteExpired() error {
+	db := database.GetDBInstance()
+	query := "DELETE FROM email_changes WHERE expiresAt < ?"
+	result, err := db.Exec(query, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete expired email changes in repository method DeleteExpired: ", err)
+		return errors.NewQueryError(err.Error())
+	}
+	rowsAffected, _ := result.RowsAffected()
+	utils.GetLogger().Infof("Deleted %d expired email changes.", rowsAffected)
+	return nil
+}
+
+func scanEmailChange(row rowScanner) (*entities.EmailChange, error) {
+	change := &entities.EmailChange{}
+
+	var expiresAt, createdAt string
+
+	err := row.Scan(
+		&change.ID,
+		&change.UserID,
+		&change.NewEmail,
+		&change.CancelTokenHash,
+		&expiresAt,
+		&createdAt,
+	)
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	if change.ExpiresAt, err = parseTime(expiresAt); err != nil {
+		return nil, err
+	}
+	if change.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
@@ -0,0 +1,43 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Renan-Parise/auth/errors"
+)
+
+const dateTimeLayout = "2006-01-02 15:04:05"
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func parseTime(value string) (time.Time, error) {
+	parsedTime, err := time.Parse(dateTimeLayout, value)
+	if err != nil {
+		return time.Time{}, errors.NewQueryError("invalid time format: " + err.Error())
+	}
+	return parsedTime, nil
+}
+
+func parseNullTime(value sql.NullString) (*time.Time, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+
+	parsedTime, err := parseTime(value.String)
+	if err != nil {
+		return nil, err
+	}
+	return &parsedTime, nil
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
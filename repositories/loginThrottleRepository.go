@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type LoginThrottleRepository interface {
+	Find(subjectType, subject string) (*entities.LoginThrottle, error)
+	FindByUnlockToken(tokenHash string) (*entities.LoginThrottle, error)
+	RecordFailure(subjectType, subject string, windowStart time.Time) (*entities.LoginThrottle, error)
+	Lock(ID int, lockedUntil time.Time, unlockTokenHash *string) error
+	Clear(subjectType, subject string) error
+	DeleteExpired(windowStart time.Time) error
+}
+
+type loginThrottleRepository struct{}
+
+func NewLoginThrottleRepository() LoginThrottleRepository {
+	return &loginThrottleRepository{}
+}
+
+const loginThrottleColumns = "id, subjectType, subject, failures, lastFailureAt, lockedUntil, unlockTokenHash"
+
+func (r *loginThrottleRepository) Find(subjectType, subject string) (*entities.LoginThrottle, error) {
+	db := database.GetDBInstance()
+	query := "SELECT " + loginThrottleColumns + " FROM login_throttles WHERE subjectType = ? AND subject = ?"
+	return scanLoginThrottle(db.QueryRow(query, subjectType, subject))
+}
+
+func (r *loginThrottleRepository) FindByUnlockToken(tokenHash string) (*entities.LoginThrottle, error) {
+	db := database.GetDBInstance()
+	query := "SELECT " + loginThrottleColumns + " FROM login_throttles WHERE unlockTokenHash = ?"
+	return scanLoginThrottle(db.QueryRow(query, tokenHash))
+}
+
+// RecordFailure counts a failed login and returns the updated throttle. The
+// count starts over when the previous failure happened before windowStart.
+func (r *loginThrottleRepository) RecordFailure(subjectType, subject string, windowStart time.Time) (*entities.LoginThrottle, error) {
+	db := database.GetDBInstance()
+	query := "INSERT INTO login_throttles (subjectType, subject, failures, lastFailureAt) VALUES (?, ?, 1, ?) " +
+		"ON DUPLICATE KEY UPDATE failures = IF(lastFailureAt < ?, 1, failures + 1), lastFailureAt = VALUES(lastFailureAt)"
+	_, err := db.Exec(query, subjectType, subject, time.Now(), windowStart)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to record login failure in repository method RecordFailure: ", err)
+
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	return r.Find(subjectType, subject)
+}
+
+func (r *loginThrottleRepository) Lock(ID int, lockedUntil time.Time, unlockTokenHash *string) error {
+	db := database.GetDBInstance()
+	query := "UPDATE login_throttles SET lockedUntil = ?, unlockTokenHash = ? WHERE id = ?"
+	_, err := db.Exec(query, lockedUntil, unlockTokenHash, ID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to lock login throttle in repository method Lock: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+// Clear forgets the failures of the subject, lifting any lock.
+func (r *loginThrottleRepository) Clear(subjectType, subject string) error {
+	db := database.GetDBInstance()
+	query := "DELETE FROM login_throttles WHERE subjectType = ? AND subject = ?"
+	_, err := db.Exec(query, subjectType, subject)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to clear login throttle in repository method Clear: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+// DeleteExpired removes the throttles whose failures no longer count and
+// that are not locked.
+func (r *loginThrottleRepository) DeleteExpired(windowStart time.Time) error {
+	db := database.GetDBInstance()
+	query := "DELETE FROM login_throttles WHERE lastFailureAt < ? AND (lockedUntil IS NULL OR lockedUntil <= ?)"
+	result, err := db.Exec(query, windowStart, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete expired login throttles in repository method DeleteExpired: ", err)
+		return errors.NewQueryError(err.Error())
+	}
+	rowsAffected, _ := result.RowsAffected()
+	utils.GetLogger().Infof("Deleted %d expired login throttles.", rowsAffected)
+	return nil
+}
+
+func scanLoginThrottle(row rowScanner) (*entities.LoginThrottle, error) {
+	throttle := &entities.LoginThrottle{}
+
+	var lastFailureAt string
+	var lockedUntil, unlockTokenHash sql.NullString
+
+	err := row.Scan(
+		&throttle.ID,
+		&throttle.SubjectType,
+		&throttle.Subject,
+		&throttle.Failures,
+		&lastFailureAt,
+		&lockedUntil,
+		&unlockTokenHash,
+	)
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	if throttle.LastFailureAt, err = parseTime(lastFailureAt); err != nil {
+		return nil, err
+	}
+	if throttle.LockedUntil, err = parseNullTime(lockedUntil); err != nil {
+		return nil, err
+	}
+	if unlockTokenHash.Valid {
+		throttle.UnlockTokenHash = &unlockTokenHash.String
+	}
+
+	return throttle, nil
+}
@@ -21,11 +21,19 @@ func (m *MockUserRepository) UpdatePassword(user *entities.User) error {
 	panic("unimplemented")
 }
 
-func (m *MockUserRepository) UpdatePasswordRecoveryCode(user *entities.User) error {
+func (m *MockUserRepository) MarkEmailVerified(ID int) error {
 	panic("unimplemented")
 }
 
-func (m *MockUserRepository) UpdateTwoFACode(user *entities.User) error {
+func (m *MockUserRepository) UpdateEmail(ID int, email string) error {
+	panic("unimplemented")
+}
+
+func (m *MockUserRepository) UpdatePhoneNumber(ID int, phoneNumber *string) error {
+	panic("unimplemented")
+}
+
+func (m *MockUserRepository) MarkPhoneVerified(ID int) error {
 	panic("unimplemented")
 }
 
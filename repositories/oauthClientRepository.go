@@ -0,0 +1,119 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type OAuthClientRepository interface {
+	FindByID(clientID string) (*entities.OAuthClient, error)
+	FindAll() ([]entities.OAuthClient, error)
+	Create(client entities.OAuthClient) error
+}
+
+type oauthClientRepository struct{}
+
+func NewOAuthClientRepository() OAuthClientRepository {
+	return &oauthClientRepository{}
+}
+
+const oauthClientColumns = "clientID, secretHash, name, scopes, grantTypes, audiences, redirectURIs, active, createdAt"
+
+func scanOAuthClient(row rowScanner) (*entities.OAuthClient, error) {
+	client := &entities.OAuthClient{}
+
+	var secretHash, redirectURIs sql.NullString
+	var scopes, grantTypes, audiences, createdAt string
+
+	err := row.Scan(
+		&client.ClientID,
+		&secretHash,
+		&client.Name,
+		&scopes,
+		&grantTypes,
+		&audiences,
+		&redirectURIs,
+		&client.Active,
+		&createdAt,
+	)
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	client.SecretHash = secretHash.String
+	client.Public = !secretHash.Valid
+	client.Scopes = strings.Fields(scopes)
+	client.GrantTypes = strings.Fields(grantTypes)
+	client.Audiences = strings.Fields(audiences)
+	client.RedirectURIs = strings.Fields(redirectURIs.String)
+	if client.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (r *oauthClientRepository) FindByID(clientID string) (*entities.OAuthClient, error) {
+	db := database.GetDBInstance()
+	query := "SELECT " + oauthClientColumns + " FROM oauth_clients WHERE clientID = ?"
+
+	return scanOAuthClient(db.QueryRow(query, clientID))
+}
+
+func (r *oauthClientRepository) FindAll() ([]entities.OAuthClient, error) {
+	db := database.GetDBInstance()
+	query := "SELECT " + oauthClientColumns + " FROM oauth_clients ORDER BY createdAt"
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+	defer rows.Close()
+
+	clients := []entities.OAuthClient{}
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	return clients, nil
+}
+
+func (r *oauthClientRepository) Create(client entities.OAuthClient) error {
+	db := database.GetDBInstance()
+	query := "INSERT INTO oauth_clients (clientID, secretHash, name, scopes, grantTypes, audiences, redirectURIs, active, createdAt) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+	var secretHash sql.NullString
+	if client.SecretHash != "" {
+		secretHash = sql.NullString{String: client.SecretHash, Valid: true}
+	}
+
+	_, err := db.Exec(query,
+		client.ClientID,
+		secretHash,
+		client.Name,
+		strings.Join(client.Scopes, " "),
+		strings.Join(client.GrantTypes, " "),
+		strings.Join(client.Audiences, " "),
+		strings.Join(client.RedirectURIs, " "),
+		client.Active,
+		client.CreatedAt,
+	)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to create OAuth client in repository method Create: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type RecoveryCodeRepository interface {
+	ReplaceAll(userID int, codeHashes []string) error
+	MarkUsed(userID int, codeHash string) (bool, error)
+	CountUnused(userID int) (int, error)
+	DeleteByUser(userID int) error
+}
+
+type recoveryCodeRepository struct{}
+
+func NewRecoveryCodeRepository() RecoveryCodeRepository {
+	return &recoveryCodeRepository{}
+}
+
+// ReplaceAll swaps the user's recovery codes for a new set in a single
+// transaction, so the old codes stop working exactly when the new ones start.
+func (r *recoveryCodeRepository) ReplaceAll(userID int, codeHashes []string) error {
+	db := database.GetDBInstance()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.NewQueryError(err.Error())
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE userID = ?", userID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete recovery codes in repository method ReplaceAll: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec("INSERT INTO recovery_codes (userID, codeHash) VALUES (?, ?)", userID, codeHash)
+		if err != nil {
+			utils.GetLogger().WithError(err).Error("Failed to create recovery code in repository method ReplaceAll: ", err)
+
+			return errors.NewQueryError(err.Error())
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+// MarkUsed consumes a code. It reports false when the code does not exist or
+// was already used, so concurrent attempts with one code cannot both pass.
+func (r *recoveryCodeRepository) MarkUsed(userID int, codeHash string) (bool, error) {
+	db := database.GetDBInstance()
+	query := "UPDATE recovery_codes SET usedAt = ? WHERE userID = ? AND codeHash = ? AND usedAt IS NULL"
+	result, err := db.Exec(query, time.Now(), userID, codeHash)
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *recoveryCodeRepository) CountUnused(userID int) (int, error) {
+	db := database.GetDBInstance()
+	query := "SELECT COUNT(*) FROM recovery_codes WHERE userID = ? AND usedAt IS NULL"
+
+	var count int
+	err := db.QueryRow(query, userID).Scan(&count)
+	if err != nil {
+		return 0, errors.NewQueryError(err.Error())
+	}
+	return count, nil
+}
+
+func (r *recoveryCodeRepository) DeleteByUser(userID int) error {
+	db := database.GetDBInstance()
+	query := "DELETE FROM recovery_codes WHERE userID = ?"
+	_, err := db.Exec(query, userID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete recovery codes in repository method DeleteByUser: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
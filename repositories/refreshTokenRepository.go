@@ -0,0 +1,146 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type RefreshTokenRepository interface {
+	Create(token entities.RefreshToken) error
+	FindByHash(hash string) (*entities.RefreshToken, error)
+	MarkUsed(ID int) (bool, error)
+	RevokeFamily(familyID string) error
+	RevokeBySession(sessionID string) error
+	RevokeByUser(userID int) error
+	DeleteExpired() error
+}
+
+type refreshTokenRepository struct{}
+
+func NewRefreshTokenRepository() RefreshTokenRepository {
+	return &refreshTokenRepository{}
+}
+
+func (r *refreshTokenRepository) Create(token entities.RefreshToken) error {
+	db := database.GetDBInstance()
+	query := "INSERT INTO refresh_tokens (userID, sessionID, clientID, scope, familyID, tokenHash, expiresAt) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	_, err := db.Exec(query, token.UserID, token.SessionID, token.ClientID, token.Scope, token.FamilyID, token.TokenHash, token.ExpiresAt)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to create refresh token in repository method Create: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *refreshTokenRepository) FindByHash(hash string) (*entities.RefreshToken, error) {
+	db := database.GetDBInstance()
+	token := &entities.RefreshToken{}
+	query := "SELECT id, userID, sessionID, clientID, scope, familyID, tokenHash, expiresAt, usedAt, revokedAt, createdAt FROM refresh_tokens WHERE tokenHash = ?"
+
+	var expiresAt, createdAt string
+	var usedAt, revokedAt sql.NullString
+
+	err := db.QueryRow(query, hash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.SessionID,
+		&token.ClientID,
+		&token.Scope,
+		&token.FamilyID,
+		&token.TokenHash,
+		&expiresAt,
+		&usedAt,
+		&revokedAt,
+		&createdAt,
+	)
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	if token.ExpiresAt, err = parseTime(expiresAt); err != nil {
+		return nil, err
+	}
+	if token.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if token.UsedAt, err = parseNullTime(usedAt); err != nil {
+		return nil, err
+	}
+	if token.RevokedAt, err = parseNullTime(revokedAt); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// MarkUsed flags the token as rotated. It reports false when the token had
+// already been used, so concurrent refreshes with the same token are caught.
+func (r *refreshTokenRepository) MarkUsed(ID int) (bool, error) {
+	db := database.GetDBInstance()
+	query := "UPDATE refresh_tokens SET usedAt = ? WHERE id = ? AND usedAt IS NULL"
+	result, err := db.Exec(query, time.Now(), ID)
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *refreshTokenRepository) RevokeFamily(familyID string) error {
+	db := database.GetDBInstance()
+	query := "UPDATE refresh_tokens SET revokedAt = ? WHERE familyID = ? AND revokedAt IS NULL"
+	_, err := db.Exec(query, time.Now(), familyID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to revoke refresh token family in repository method RevokeFamily: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *refreshTokenRepository) RevokeBySession(sessionID string) error {
+	db := database.GetDBInstance()
+	query := "UPDATE refresh_tokens SET revokedAt = ? WHERE sessionID = ? AND revokedAt IS NULL"
+	_, err := db.Exec(query, time.Now(), sessionID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to revoke refresh tokens in repository method RevokeBySession: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *refreshTokenRepository) RevokeByUser(userID int) error {
+	db := database.GetDBInstance()
+	query := "UPDATE refresh_tokens SET revokedAt = ? WHERE userID = ? AND revokedAt IS NULL"
+	_, err := db.Exec(query, time.Now(), userID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to revoke refresh tokens in repository method RevokeByUser: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *refreshTokenRepository) DeleteExpired() error {
+	db := database.GetDBInstance()
+	query := "DELETE FROM refresh_tokens WHERE expiresAt <= ?"
+	result, err := db.Exec(query, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete expired refresh tokens in repository method DeleteExpired: ", err)
+		return errors.NewQueryError(err.Error())
+	}
+	rowsAffected, _ := result.RowsAffected()
+	utils.GetLogger().Infof("Deleted %d expired refresh tokens.", rowsAffected)
+	return nil
+}
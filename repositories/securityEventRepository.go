@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type SecurityEventRepository interface {
+	Create(event entities.SecurityEvent) error
+	FindByUser(userID int, limit int) ([]entities.SecurityEvent, error)
+}
+
+type securityEventRepository struct{}
+
+func NewSecurityEventRepository() SecurityEventRepository {
+	return &securityEventRepository{}
+}
+
+func (r *securityEventRepository) Create(event entities.SecurityEvent) error {
+	db := database.GetDBInstance()
+	query := "INSERT INTO security_events (userID, type, ipAddress, userAgent, details, createdAt) VALUES (?, ?, ?, ?, ?, ?)"
+	_, err := db.Exec(query, event.UserID, event.Type, event.IPAddress, event.UserAgent, event.Details, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to create security event in repository method Create: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+// FindByUser returns the user's latest events, newest first.
+func (r *securityEventRepository) FindByUser(userID int, limit int) ([]entities.SecurityEvent, error) {
+	db := database.GetDBInstance()
+	query := "SELECT id, userID, type, ipAddress, userAgent, details, createdAt FROM security_events WHERE userID = ? ORDER BY createdAt DESC, id DESC LIMIT ?"
+
+	rows, err := db.Query(query, userID, limit)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to query security events in repository method FindByUser: ", err)
+
+		return nil, errors.NewQueryError(err.Error())
+	}
+	defer rows.Close()
+
+	events := []entities.SecurityEvent{}
+	for rows.Next() {
+		event := entities.SecurityEvent{}
+		var createdAt string
+
+		err := rows.Scan(
+			&event.ID,
+			&event.UserID,
+			&event.Type,
+			&event.IPAddress,
+			&event.UserAgent,
+			&event.Details,
+			&createdAt,
+		)
+		if err != nil {
+			return nil, errors.NewQueryError(err.Error())
+		}
+
+		if event.CreatedAt, err = parseTime(createdAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	return events, nil
+}
@@ -0,0 +1,210 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type SessionRepository interface {
+	Create(session entities.Session) error
+	FindByID(ID string) (*entities.Session, error)
+	FindActiveByUser(userID int) ([]entities.Session, error)
+	Touch(ID string, lastSeenAt time.Time) error
+	Extend(ID string, expiresAt time.Time) error
+	Reauthenticate(ID string, authTime time.Time, amr []string) error
+	Revoke(ID string) error
+	RevokeAllByUser(userID int) error
+	DeleteExpired() error
+}
+
+type sessionRepository struct{}
+
+func NewSessionRepository() SessionRepository {
+	return &sessionRepository{}
+}
+
+func (r *sessionRepository) Create(session entities.Session) error {
+	db := database.GetDBInstance()
+	query := "INSERT INTO sessions (id, userID, userAgent, ipAddress, authTime, amr, createdAt, lastSeenAt, expiresAt) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err := db.Exec(query, session.ID, session.UserID, session.UserAgent, session.IPAddress, session.AuthTime, strings.Join(session.AMR, ","), session.CreatedAt, session.LastSeenAt, session.ExpiresAt)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to create session in repository method Create: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *sessionRepository) FindByID(ID string) (*entities.Session, error) {
+	db := database.GetDBInstance()
+	session := &entities.Session{}
+	query := "SELECT id, userID, userAgent, ipAddress, authTime, amr, createdAt, lastSeenAt, expiresAt, revokedAt FROM sessions WHERE id = ?"
+
+	var authTime, amr, createdAt, lastSeenAt, expiresAt string
+	var revokedAt sql.NullString
+
+	err := db.QueryRow(query, ID).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IPAddress,
+		&authTime,
+		&amr,
+		&createdAt,
+		&lastSeenAt,
+		&expiresAt,
+		&revokedAt,
+	)
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	session.AMR = splitList(amr)
+	if session.AuthTime, err = parseTime(authTime); err != nil {
+		return nil, err
+	}
+	if session.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if session.LastSeenAt, err = parseTime(lastSeenAt); err != nil {
+		return nil, err
+	}
+	if session.ExpiresAt, err = parseTime(expiresAt); err != nil {
+		return nil, err
+	}
+	if session.RevokedAt, err = parseNullTime(revokedAt); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (r *sessionRepository) FindActiveByUser(userID int) ([]entities.Session, error) {
+	db := database.GetDBInstance()
+	query := "SELECT id, userID, userAgent, ipAddress, authTime, amr, createdAt, lastSeenAt, expiresAt FROM sessions WHERE userID = ? AND revokedAt IS NULL AND expiresAt > ? ORDER BY lastSeenAt DESC"
+
+	rows, err := db.Query(query, userID, time.Now())
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+	defer rows.Close()
+
+	sessions := []entities.Session{}
+	for rows.Next() {
+		var session entities.Session
+		var authTime, amr, createdAt, lastSeenAt, expiresAt string
+
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.UserAgent,
+			&session.IPAddress,
+			&authTime,
+			&amr,
+			&createdAt,
+			&lastSeenAt,
+			&expiresAt,
+		)
+		if err != nil {
+			return nil, errors.NewQueryError(err.Error())
+		}
+
+		session.AMR = splitList(amr)
+		if session.AuthTime, err = parseTime(authTime); err != nil {
+			return nil, err
+		}
+		if session.CreatedAt, err = parseTime(createdAt); err != nil {
+			return nil, err
+		}
+		if session.LastSeenAt, err = parseTime(lastSeenAt); err != nil {
+			return nil, err
+		}
+		if session.ExpiresAt, err = parseTime(expiresAt); err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	return sessions, nil
+}
+
+func (r *sessionRepository) Touch(ID string, lastSeenAt time.Time) error {
+	db := database.GetDBInstance()
+	query := "UPDATE sessions SET lastSeenAt = ? WHERE id = ?"
+	_, err := db.Exec(query, lastSeenAt, ID)
+	if err != nil {
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *sessionRepository) Extend(ID string, expiresAt time.Time) error {
+	db := database.GetDBInstance()
+	query := "UPDATE sessions SET expiresAt = ? WHERE id = ? AND revokedAt IS NULL"
+	_, err := db.Exec(query, expiresAt, ID)
+	if err != nil {
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+// Reauthenticate records a new authentication of the user within an existing
+// session.
+func (r *sessionRepository) Reauthenticate(ID string, authTime time.Time, amr []string) error {
+	db := database.GetDBInstance()
+	query := "UPDATE sessions SET authTime = ?, amr = ? WHERE id = ? AND revokedAt IS NULL"
+	_, err := db.Exec(query, authTime, strings.Join(amr, ","), ID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to reauthenticate session in repository method Reauthenticate: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *sessionRepository) Revoke(ID string) error {
+	db := database.GetDBInstance()
+	query := "UPDATE sessions SET revokedAt = ? WHERE id = ? AND revokedAt IS NULL"
+	_, err := db.Exec(query, time.Now(), ID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to revoke session in repository method Revoke: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *sessionRepository) RevokeAllByUser(userID int) error {
+	db := database.GetDBInstance()
+	query := "UPDATE sessions SET revokedAt = ? WHERE userID = ? AND revokedAt IS NULL"
+	_, err := db.Exec(query, time.Now(), userID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to revoke sessions in repository method RevokeAllByUser: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *sessionRepository) DeleteExpired() error {
+	db := database.GetDBInstance()
+	query := "DELETE FROM sessions WHERE expiresAt <= ?"
+	result, err := db.Exec(query, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete expired sessions in repository method DeleteExpired: ", err)
+		return errors.NewQueryError(err.Error())
+	}
+	rowsAffected, _ := result.RowsAffected()
+	utils.GetLogger().Infof("Deleted %d expired sessions.", rowsAffected)
+	return nil
+}
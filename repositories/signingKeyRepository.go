@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type SigningKeyRepository interface {
+	Create(key entities.SigningKey) error
+	FindUsable() ([]entities.SigningKey, error)
+	RetireAllExcept(keyID string, retiredAt, expiresAt time.Time) error
+	DeleteExpired() error
+}
+
+type signingKeyRepository struct{}
+
+func NewSigningKeyRepository() SigningKeyRepository {
+	return &signingKeyRepository{}
+}
+
+func (r *signingKeyRepository) Create(key entities.SigningKey) error {
+	db := database.GetDBInstance()
+	query := "INSERT INTO signing_keys (kid, algorithm, privateKey, createdAt, activatesAt) VALUES (?, ?, ?, ?, ?)"
+	_, err := db.Exec(query, key.KeyID, key.Algorithm, key.PrivateKey, key.CreatedAt, key.ActivatesAt)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to create signing key in repository method Create: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+// FindUsable returns every key that can still verify tokens, newest first.
+func (r *signingKeyRepository) FindUsable() ([]entities.SigningKey, error) {
+	db := database.GetDBInstance()
+	query := "SELECT kid, algorithm, privateKey, createdAt, activatesAt, retiredAt, expiresAt FROM signing_keys WHERE expiresAt IS NULL OR expiresAt > ? ORDER BY createdAt DESC"
+
+	rows, err := db.Query(query, time.Now())
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+	defer rows.Close()
+
+	keys := []entities.SigningKey{}
+	for rows.Next() {
+		var key entities.SigningKey
+		var createdAt, activatesAt string
+		var retiredAt, expiresAt sql.NullString
+
+		err := rows.Scan(&key.KeyID, &key.Algorithm, &key.PrivateKey, &createdAt, &activatesAt, &retiredAt, &expiresAt)
+		if err != nil {
+			return nil, errors.NewQueryError(err.Error())
+		}
+
+		if key.CreatedAt, err = parseTime(createdAt); err != nil {
+			return nil, err
+		}
+		if key.ActivatesAt, err = parseTime(activatesAt); err != nil {
+			return nil, err
+		}
+		if key.RetiredAt, err = parseNullTime(retiredAt); err != nil {
+			return nil, err
+		}
+		if key.ExpiresAt, err = parseNullTime(expiresAt); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	return keys, nil
+}
+
+func (r *signingKeyRepository) RetireAllExcept(keyID string, retiredAt, expiresAt time.Time) error {
+	db := database.GetDBInstance()
+	query := "UPDATE signing_keys SET retiredAt = ?, expiresAt = ? WHERE kid <> ? AND retiredAt IS NULL"
+	_, err := db.Exec(query, retiredAt, expiresAt, keyID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to retire signing keys in repository method RetireAllExcept: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *signingKeyRepository) DeleteExpired() error {
+	db := database.GetDBInstance()
+	query := "DELETE FROM signing_keys WHERE expiresAt <= ?"
+	result, err := db.Exec(query, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete expired signing keys in repository method DeleteExpired: ", err)
+		return errors.NewQueryError(err.Error())
+	}
+	rowsAffected, _ := result.RowsAffected()
+	utils.GetLogger().Infof("Deleted %d expired signing keys.", rowsAffected)
+	return nil
+}
@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type TOTPRepository interface {
+	FindByUser(userID int) (*entities.TOTP, error)
+	Save(totp entities.TOTP) error
+	Confirm(userID int, step int64) error
+	UseStep(userID int, step int64) (bool, error)
+	Delete(userID int) error
+}
+
+type totpRepository struct{}
+
+func NewTOTPRepository() TOTPRepository {
+	return &totpRepository{}
+}
+
+func (r *totpRepository) FindByUser(userID int) (*entities.TOTP, error) {
+	db := database.GetDBInstance()
+	totp := &entities.TOTP{}
+	query := "SELECT userID, secret, confirmedAt, lastUsedStep, createdAt FROM user_totp WHERE userID = ?"
+
+	var createdAt string
+	var confirmedAt sql.NullString
+	var lastUsedStep sql.NullInt64
+
+	err := db.QueryRow(query, userID).Scan(
+		&totp.UserID,
+		&totp.Secret,
+		&confirmedAt,
+		&lastUsedStep,
+		&createdAt,
+	)
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	if totp.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if totp.ConfirmedAt, err = parseNullTime(confirmedAt); err != nil {
+		return nil, err
+	}
+	if lastUsedStep.Valid {
+		totp.LastUsedStep = &lastUsedStep.Int64
+	}
+
+	return totp, nil
+}
+
+// Save stores a new, unconfirmed enrollment, replacing any previous one.
+func (r *totpRepository) Save(totp entities.TOTP) error {
+	db := database.GetDBInstance()
+	query := "INSERT INTO user_totp (userID, secret, createdAt) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE secret = VALUES(secret), confirmedAt = NULL, lastUsedStep = NULL, createdAt = VALUES(createdAt)"
+	_, err := db.Exec(query, totp.UserID, totp.Secret, totp.CreatedAt)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to save TOTP enrollment in repository method Save: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *totpRepository) Confirm(userID int, step int64) error {
+	db := database.GetDBInstance()
+	query := "UPDATE user_totp SET confirmedAt = ?, lastUsedStep = ? WHERE userID = ?"
+	_, err := db.Exec(query, time.Now(), step, userID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to confirm TOTP enrollment in repository method Confirm: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+// UseStep records step as the last one used. It reports false when that step
+// or a later one was already used, so a code can never be accepted twice.
+func (r *totpRepository) UseStep(userID int, step int64) (bool, error) {
+	db := database.GetDBInstance()
+	query := "UPDATE user_totp SET lastUsedStep = ? WHERE userID = ? AND (lastUsedStep IS NULL OR lastUsedStep < ?)"
+	result, err := db.Exec(query, step, userID, step)
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *totpRepository) Delete(userID int) error {
+	db := database.GetDBInstance()
+	query := "DELETE FROM user_totp WHERE userID = ?"
+	_, err := db.Exec(query, userID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete TOTP enrollment in repository method Delete: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type TrustedDeviceRepository interface {
+	Create(device entities.TrustedDevice) error
+	FindByHash(hash string) (*entities.TrustedDevice, error)
+	FindActiveByUser(userID int) ([]entities.TrustedDevice, error)
+	Touch(ID int, lastUsedAt time.Time) error
+	Delete(userID, ID int) (bool, error)
+	DeleteByUser(userID int) error
+	DeleteExpired() error
+}
+
+type trustedDeviceRepository struct{}
+
+func NewTrustedDeviceRepository() TrustedDeviceRepository {
+	return &trustedDeviceRepository{}
+}
+
+func (r *trustedDeviceRepository) Create(device entities.TrustedDevice) error {
+	db := database.GetDBInstance()
+	query := "INSERT INTO trusted_devices (userID, tokenHash, userAgent, ipAddress, expiresAt) VALUES (?, ?, ?, ?, ?)"
+	_, err := db.Exec(query, device.UserID, device.TokenHash, device.UserAgent, device.IPAddress, device.ExpiresAt)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to create trusted device in repository method Create: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *trustedDeviceRepository) FindByHash(hash string) (*entities.TrustedDevice, error) {
+	db := database.GetDBInstance()
+	query := "SELECT id, userID, tokenHash, userAgent, ipAddress, createdAt, lastUsedAt, expiresAt FROM trusted_devices WHERE tokenHash = ?"
+	return scanTrustedDevice(db.QueryRow(query, hash))
+}
+
+func (r *trustedDeviceRepository) FindActiveByUser(userID int) ([]entities.TrustedDevice, error) {
+	db := database.GetDBInstance()
+	query := "SELECT id, userID, tokenHash, userAgent, ipAddress, createdAt, lastUsedAt, expiresAt FROM trusted_devices WHERE userID = ? AND expiresAt > ? ORDER BY createdAt DESC"
+
+	rows, err := db.Query(query, userID, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to query trusted devices in repository method FindActiveByUser: ", err)
+
+		return nil, errors.NewQueryError(err.Error())
+	}
+	defer rows.Close()
+
+	devices := []entities.TrustedDevice{}
+	for rows.Next() {
+		device, err := scanTrustedDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, *device)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	return devices, nil
+}
+
+func (r *trustedDeviceRepository) Touch(ID int, lastUsedAt time.Time) error {
+	db := database.GetDBInstance()
+	query := "UPDATE trusted_devices SET lastUsedAt = ? WHERE id = ?"
+	_, err := db.Exec(query, lastUsedAt, ID)
+	if err != nil {
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *trustedDeviceRepository) Delete(userID, ID int) (bool, error) {
+	db := database.GetDBInstance()
+	query := "DELETE FROM trusted_devices WHERE id = ? AND userID = ?"
+	result, err := db.Exec(query, ID, userID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete trusted device in repository method Delete: ", err)
+
+		return false, errors.NewQueryError(err.Error())
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *trustedDeviceRepository) DeleteByUser(userID int) error {
+	db := database.GetDBInstance()
+	query := "DELETE FROM trusted_devices WHERE userID = ?"
+	_, err := db.Exec(query, userID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete trusted devices in repository method DeleteByUser: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *trustedDeviceRepository) DeleteExpired() error {
+	db := database.GetDBInstance()
+	query := "DELETE FROM trusted_devices WHERE expiresAt <= ?"
+	result, err := db.Exec(query, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete expired trusted devices in repository method DeleteExpired: ", err)
+		return errors.NewQueryError(err.Error())
+	}
+	rowsAffected, _ := result.RowsAffected()
+	utils.GetLogger().Infof("Deleted %d expired trusted devices.", rowsAffected)
+	return nil
+}
+
+func scanTrustedDevice(row rowScanner) (*entities.TrustedDevice, error) {
+	device := &entities.TrustedDevice{}
+
+	var createdAt, expiresAt string
+	var lastUsedAt sql.NullString
+
+	err := row.Scan(
+		&device.ID,
+		&device.UserID,
+		&device.TokenHash,
+		&device.UserAgent,
+		&device.IPAddress,
+		&createdAt,
+		&lastUsedAt,
+		&expiresAt,
+	)
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	if device.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if device.LastUsedAt, err = parseNullTime(lastUsedAt); err != nil {
+		return nil, err
+	}
+	if device.ExpiresAt, err = parseTime(expiresAt); err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
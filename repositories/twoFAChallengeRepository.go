@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type TwoFAChallengeRepository interface {
+	Create(challenge entities.TwoFAChallenge) error
+	FindByID(ID string) (*entities.TwoFAChallenge, error)
+	CountAttempt(ID string, maxAttempts int) (bool, error)
+	MarkUsed(ID string) (bool, error)
+	DeleteExpired() error
+}
+
+type twoFAChallengeRepository struct{}
+
+func NewTwoFAChallengeRepository() TwoFAChallengeRepository {
+	return &twoFAChallengeRepository{}
+}
+
+func (r *twoFAChallengeRepository) Create(challenge entities.TwoFAChallenge) error {
+	db := database.GetDBInstance()
+	query := "INSERT INTO twofa_challenges (id, userID, method, userAgent, ipAddress, expiresAt) VALUES (?, ?, ?, ?, ?, ?)"
+	_, err := db.Exec(query,
+		challenge.ID,
+		challenge.UserID,
+		challenge.Method,
+		challenge.UserAgent,
+		challenge.IPAddress,
+		challenge.ExpiresAt,
+	)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to create 2FA challenge in repository method Create: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *twoFAChallengeRepository) FindByID(ID string) (*entities.TwoFAChallenge, error) {
+	db := database.GetDBInstance()
+	challenge := &entities.TwoFAChallenge{}
+	query := "SELECT id, userID, method, userAgent, ipAddress, attempts, expiresAt, usedAt, createdAt FROM twofa_challenges WHERE id = ?"
+
+	var expiresAt, createdAt string
+	var usedAt sql.NullString
+
+	err := db.QueryRow(query, ID).Scan(
+		&challenge.ID,
+		&challenge.UserID,
+		&challenge.Method,
+		&challenge.UserAgent,
+		&challenge.IPAddress,
+		&challenge.Attempts,
+		&expiresAt,
+		&usedAt,
+		&createdAt,
+	)
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	if challenge.ExpiresAt, err = parseTime(expiresAt); err != nil {
+		return nil, err
+	}
+	if challenge.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if challenge.UsedAt, err = parseNullTime(usedAt); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// CountAttempt records an attempt at the challenge. It reports false once
+// maxAttempts were made or the challenge was completed, so concurrent
+// guesses cannot exceed the limit.
+func (r *twoFAChallengeRepository) CountAttempt(ID string, maxAttempts int) (bool, error) {
+	db := database.GetDBInstance()
+	query := "UPDATE twofa_challenges SET attempts = attempts + 1 WHERE id = ? AND attempts < ? AND usedAt IS NULL"
+	result, err := db.Exec(query, ID, maxAttempts)
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+	return rowsAffected == 1, nil
+}
+
+// MarkUsed completes the challenge. It reports false when it was already
+// completed, so one password step can only ever start one session.
+func (r *twoFAChallengeRepository) MarkUsed(ID string) (bool, error) {
+	db := database.GetDBInstance()
+	query := "UPDATE twofa_challenges SET usedAt = ? WHERE id = ? AND usedAt IS NULL"
+	result, err := db.Exec(query, time.Now(), ID)
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *twoFAChallengeRepository) DeleteExpired() error {
+	db := database.GetDBInstance()
+	query := "DELETE FROM twofa_challenges WHERE expiresAt <= ?"
+	result, err := db.Exec(query, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete expired 2FA challenges in repository method DeleteExpired: ", err)
+		return errors.NewQueryError(err.Error())
+	}
+	rowsAffected, _ := result.RowsAffected()
+	utils.GetLogger().Infof("Deleted %d expired 2FA challenges.", rowsAffected)
+	return nil
+}
@@ -0,0 +1,167 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type UserFactorRepository interface {
+	Create(factor entities.UserFactor) error
+	FindByUser(userID int) ([]entities.UserFactor, error)
+	FindByID(userID, ID int) (*entities.UserFactor, error)
+	FindByType(userID int, factorType string) (*entities.UserFactor, error)
+	Confirm(ID int) error
+	SetDefault(userID, ID int) error
+	Touch(ID int, lastUsedAt time.Time) error
+	Delete(userID, ID int) (bool, error)
+}
+
+type userFactorRepository struct{}
+
+func NewUserFactorRepository() UserFactorRepository {
+	return &userFactorRepository{}
+}
+
+const userFactorColumns = "id, userID, type, isDefault, confirmedAt, lastUsedAt, createdAt"
+
+func (r *userFactorRepository) Create(factor entities.UserFactor) error {
+	db := database.GetDBInstance()
+	query := "INSERT INTO user_factors (userID, type, isDefault) VALUES (?, ?, ?)"
+	_, err := db.Exec(query, factor.UserID, factor.Type, factor.IsDefault)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to create user factor in repository method Create: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *userFactorRepository) FindByUser(userID int) ([]entities.UserFactor, error) {
+	db := database.GetDBInstance()
+	query := "SELECT " + userFactorColumns + " FROM user_factors WHERE userID = ? ORDER BY createdAt"
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to query user factors in repository method FindByUser: ", err)
+
+		return nil, errors.NewQueryError(err.Error())
+	}
+	defer rows.Close()
+
+	factors := []entities.UserFactor{}
+	for rows.Next() {
+		factor, err := scanUserFactor(rows)
+		if err != nil {
+			return nil, err
+		}
+		factors = append(factors, *factor)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	return factors, nil
+}
+
+func (r *userFactorRepository) FindByID(userID, ID int) (*entities.UserFactor, error) {
+	db := database.GetDBInstance()
+	query := "SELECT " + userFactorColumns + " FROM user_factors WHERE id = ? AND userID = ?"
+	return scanUserFactor(db.QueryRow(query, ID, userID))
+}
+
+func (r *userFactorRepository) FindByType(userID int, factorType string) (*entities.UserFactor, error) {
+	db := database.GetDBInstance()
+	query := "SELECT " + userFactorColumns + " FROM user_factors WHERE userID = ? AND type = ?"
+	return scanUserFactor(db.QueryRow(query, userID, factorType))
+}
+
+func (r *userFactorRepository) Confirm(ID int) error {
+	db := database.GetDBInstance()
+	query := "UPDATE user_factors SET confirmedAt = ? WHERE id = ?"
+	_, err := db.Exec(query, time.Now(), ID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to confirm user factor in repository method Confirm: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+// SetDefault makes the factor the user's default and clears the flag on
+// their other factors.
+func (r *userFactorRepository) SetDefault(userID, ID int) error {
+	db := database.GetDBInstance()
+	query := "UPDATE user_factors SET isDefault = (id = ?) WHERE userID = ?"
+	_, err := db.Exec(query, ID, userID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to set default user factor in repository method SetDefault: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *userFactorRepository) Touch(ID int, lastUsedAt time.Time) error {
+	db := database.GetDBInstance()
+	query := "UPDATE user_factors SET lastUsedAt = ? WHERE id = ?"
+	_, err := db.Exec(query, lastUsedAt, ID)
+	if err != nil {
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *userFactorRepository) Delete(userID, ID int) (bool, error) {
+	db := database.GetDBInstance()
+	query := "DELETE FROM user_factors WHERE id = ? AND userID = ?"
+	result, err := db.Exec(query, ID, userID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete user factor in repository method Delete: ", err)
+
+		return false, errors.NewQueryError(err.Error())
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+	return rowsAffected == 1, nil
+}
+
+func scanUserFactor(row rowScanner) (*entities.UserFactor, error) {
+	factor := &entities.UserFactor{}
+
+	var createdAt string
+	var confirmedAt, lastUsedAt sql.NullString
+
+	err := row.Scan(
+		&factor.ID,
+		&factor.UserID,
+		&factor.Type,
+		&factor.IsDefault,
+		&confirmedAt,
+		&lastUsedAt,
+		&createdAt,
+	)
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	if factor.ConfirmedAt, err = parseNullTime(confirmedAt); err != nil {
+		return nil, err
+	}
+	if factor.LastUsedAt, err = parseNullTime(lastUsedAt); err != nil {
+		return nil, err
+	}
+	if factor.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+
+	return factor, nil
+}
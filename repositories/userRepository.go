@@ -1,7 +1,6 @@
 package repositories
 
 import (
-	"database/sql"
 	"time"
 
 	"github.com/Renan-Parise/auth/database"
@@ -17,10 +16,12 @@ type UserRepository interface {
 	Update(ID int, user entities.User) error
 	DeactivateUser(ID int) error
 	DeleteInactiveUsers() error
-	UpdateTwoFACode(user *entities.User) error
 	UpdateTwoFASettings(user *entities.User) error
-	UpdatePasswordRecoveryCode(user *entities.User) error
 	UpdatePassword(user *entities.User) error
+	MarkEmailVerified(ID int) error
+	UpdateEmail(ID int, email string) error
+	UpdatePhoneNumber(ID int, phoneNumber *string) error
+	MarkPhoneVerified(ID int) error
 }
 
 type userRepository struct{}
@@ -32,94 +33,46 @@ func NewUserRepository() UserRepository {
 func (r *userRepository) FindByID(id int) (*entities.User, error) {
 	db := database.GetDBInstance()
 	user := &entities.User{}
-	query := "SELECT id, username, email, password, active, isTwoFAEnabled, twoFACode, twoFACodeExpiration, passwordRecoveryCode, recoveryCodeExpiration FROM users WHERE id = ?"
-
-	var twoFACodeExpiresAtStr sql.NullString
-	var recoveryCodeExpiresAtStr sql.NullString
+	query := "SELECT id, username, email, emailVerified, phoneNumber, phoneVerified, password, active, isTwoFAEnabled FROM users WHERE id = ?"
 
 	err := db.QueryRow(query, id).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
+		&user.EmailVerified,
+		&user.PhoneNumber,
+		&user.PhoneVerified,
 		&user.Password,
 		&user.Active,
 		&user.Is2FAEnabled,
-		&user.TwoFACode,
-		&twoFACodeExpiresAtStr,
-		&user.PasswordRecoveryCode,
-		&recoveryCodeExpiresAtStr,
 	)
 	if err != nil {
 		return nil, errors.NewQueryError(err.Error())
 	}
 
-	if twoFACodeExpiresAtStr.Valid {
-		parsedTime, err := time.Parse("2006-01-02 15:04:05", twoFACodeExpiresAtStr.String)
-		if err != nil {
-			return nil, errors.NewQueryError("invalid expiration time format: " + err.Error())
-		}
-		user.TwoFACodeExpiresAt = &parsedTime
-	} else {
-		user.TwoFACodeExpiresAt = nil
-	}
-
-	if recoveryCodeExpiresAtStr.Valid {
-		parsedTime, err := time.Parse("2006-01-02 15:04:05", recoveryCodeExpiresAtStr.String)
-		if err != nil {
-			return nil, errors.NewQueryError("invalid expiration time format: " + err.Error())
-		}
-		user.RecoveryCodeExpiresAt = &parsedTime
-	} else {
-		user.RecoveryCodeExpiresAt = nil
-	}
-
 	return user, nil
 }
 
 func (r *userRepository) FindByEmail(email string) (*entities.User, error) {
 	db := database.GetDBInstance()
 	user := &entities.User{}
-	query := "SELECT id, username, email, password, active, isTwoFAEnabled, twoFACode, twoFACodeExpiration, passwordRecoveryCode, recoveryCodeExpiration FROM users WHERE email = ?"
-
-	var twoFACodeExpiresAt sql.NullString
-	var recoveryCodeExpiresAt sql.NullString
+	query := "SELECT id, username, email, emailVerified, phoneNumber, phoneVerified, password, active, isTwoFAEnabled FROM users WHERE email = ?"
 
 	err := db.QueryRow(query, email).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
+		&user.EmailVerified,
+		&user.PhoneNumber,
+		&user.PhoneVerified,
 		&user.Password,
 		&user.Active,
 		&user.Is2FAEnabled,
-		&user.TwoFACode,
-		&twoFACodeExpiresAt,
-		&user.PasswordRecoveryCode,
-		&recoveryCodeExpiresAt,
 	)
 	if err != nil {
 		return nil, errors.NewQueryError(err.Error())
 	}
 
-	if twoFACodeExpiresAt.Valid {
-		parsedTime, err := time.Parse("2006-01-02 15:04:05", twoFACodeExpiresAt.String)
-		if err != nil {
-			return nil, errors.NewQueryError("invalid expiration time format: " + err.Error())
-		}
-		user.TwoFACodeExpiresAt = &parsedTime
-	} else {
-		user.TwoFACodeExpiresAt = nil
-	}
-
-	if recoveryCodeExpiresAt.Valid {
-		parsedTime, err := time.Parse("2006-01-02 15:04:05", recoveryCodeExpiresAt.String)
-		if err != nil {
-			return nil, errors.NewQueryError("invalid expiration time format: " + err.Error())
-		}
-		user.RecoveryCodeExpiresAt = &parsedTime
-	} else {
-		user.RecoveryCodeExpiresAt = nil
-	}
-
 	return user, nil
 }
 
@@ -172,40 +125,69 @@ func (r *userRepository) DeleteInactiveUsers() error {
 	return nil
 }
 
-func (r *userRepository) UpdateTwoFACode(user *entities.User) error {
+func (r *userRepository) UpdateTwoFASettings(user *entities.User) error {
 	db := database.GetDBInstance()
-	query := "UPDATE users SET twoFACode = ?, twoFACodeExpiration = ? WHERE id = ?"
-	_, err := db.Exec(query, user.TwoFACode, user.TwoFACodeExpiresAt, user.ID)
+	query := "UPDATE users SET isTwoFAEnabled = ? WHERE id = ?"
+	_, err := db.Exec(query, user.Is2FAEnabled, user.ID)
 	if err != nil {
 		return errors.NewQueryError(err.Error())
 	}
 	return nil
 }
 
-func (r *userRepository) UpdateTwoFASettings(user *entities.User) error {
+func (r *userRepository) UpdatePassword(user *entities.User) error {
 	db := database.GetDBInstance()
-	query := "UPDATE users SET isTwoFAEnabled = ? WHERE id = ?"
-	_, err := db.Exec(query, user.Is2FAEnabled, user.ID)
+	query := "UPDATE users SET password = ? WHERE id = ?"
+	_, err := db.Exec(query, user.Password, user.ID)
 	if err != nil {
 		return errors.NewQueryError(err.Error())
 	}
 	return nil
 }
 
-func (r *userRepository) UpdatePasswordRecoveryCode(user *entities.User) error {
+func (r *userRepository) MarkEmailVerified(ID int) error {
 	db := database.GetDBInstance()
-	query := "UPDATE users SET passwordRecoveryCode = ?, recoveryCodeExpiration = ? WHERE id = ?"
-	_, err := db.Exec(query, user.PasswordRecoveryCode, user.RecoveryCodeExpiresAt, user.ID)
+	query := "UPDATE users SET emailVerified = ? WHERE id = ?"
+	_, err := db.Exec(query, true, ID)
 	if err != nil {
 		return errors.NewQueryError(err.Error())
 	}
 	return nil
 }
 
-func (r *userRepository) UpdatePassword(user *entities.User) error {
+// UpdateEmail replaces the user's email address. The new address is
+// unverified until MarkEmailVerified records that the user proved it.
+func (r *userRepository) UpdateEmail(ID int, email string) error {
 	db := database.GetDBInstance()
-	query := "UPDATE users SET password = ?, passwordRecoveryCode = NULL, recoveryCodeExpiration = NULL WHERE id = ?"
-	_, err := db.Exec(query, user.Password, user.ID)
+	query := "UPDATE users SET email = ?, emailVerified = FALSE WHERE id = ?"
+	_, err := db.Exec(query, email, ID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to update email in repository method UpdateEmail: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+// UpdatePhoneNumber replaces the user's phone number, or removes it when
+// phoneNumber is nil. The new number is unverified until a code sent to it is
+// entered.
+func (r *userRepository) UpdatePhoneNumber(ID int, phoneNumber *string) error {
+	db := database.GetDBInstance()
+	query := "UPDATE users SET phoneNumber = ?, phoneVerified = FALSE WHERE id = ?"
+	_, err := db.Exec(query, phoneNumber, ID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to update phone number in repository method UpdatePhoneNumber: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *userRepository) MarkPhoneVerified(ID int) error {
+	db := database.GetDBInstance()
+	query := "UPDATE users SET phoneVerified = ? WHERE id = ? AND phoneNumber IS NOT NULL"
+	_, err := db.Exec(query, true, ID)
 	if err != nil {
 		return errors.NewQueryError(err.Error())
 	}
@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type VerificationCodeRepository interface {
+	Save(code entities.VerificationCode) error
+	FindActive(userID int, purpose string) (*entities.VerificationCode, error)
+	CountAttempt(ID int, maxAttempts int) (bool, error)
+	Consume(ID int, codeHash string) (bool, error)
+	DeleteExpired() error
+}
+
+type verificationCodeRepository struct{}
+
+func NewVerificationCodeRepository() VerificationCodeRepository {
+	return &verificationCodeRepository{}
+}
+
+// Save stores a new code for the user and purpose, replacing the previous
+// one together with its attempts.
+func (r *verificationCodeRepository) Save(code entities.VerificationCode) error {
+	db := database.GetDBInstance()
+	query := "INSERT INTO verification_codes (userID, purpose, channel, codeHash, attempts, expiresAt, createdAt) VALUES (?, ?, ?, ?, 0, ?, ?) " +
+		"ON DUPLICATE KEY UPDATE channel = VALUES(channel), codeHash = VALUES(codeHash), attempts = 0, expiresAt = VALUES(expiresAt), createdAt = VALUES(createdAt)"
+	_, err := db.Exec(query, code.UserID, code.Purpose, code.Channel, code.CodeHash, code.ExpiresAt, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to save verification code in repository method Save: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *verificationCodeRepository) FindActive(userID int, purpose string) (*entities.VerificationCode, error) {
+	db := database.GetDBInstance()
+	code := &entities.VerificationCode{}
+	query := "SELECT id, userID, purpose, channel, codeHash, attempts, expiresAt, createdAt FROM verification_codes WHERE userID = ? AND purpose = ? AND expiresAt > ?"
+
+	var expiresAt, createdAt string
+
+	err := db.QueryRow(query, userID, purpose, time.Now()).Scan(
+		&code.ID,
+		&code.UserID,
+		&code.Purpose,
+		&code.Channel,
+		&code.CodeHash,
+		&code.Attempts,
+		&expiresAt,
+		&createdAt,
+	)
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	if code.ExpiresAt, err = parseTime(expiresAt); err != nil {
+		return nil, err
+	}
+	if code.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+
+	return code, nil
+}
+
+// CountAttempt records an attempt at the code before it is compared. It
+// reports false once maxAttempts were made, so concurrent guesses cannot
+// exceed the limit.
+func (r *verificationCodeRepository) CountAttempt(ID int, maxAttempts int) (bool, error) {
+	db := database.GetDBInstance()
+	query := "UPDATE verification_codes SET attempts = attempts + 1 WHERE id = ? AND attempts < ?"
+	result, err := db.Exec(query, ID, maxAttempts)
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+	return rowsAffected == 1, nil
+}
+
+// Consume deletes the code if it is still the one that was checked and has
+// not expired. It reports whether it did, so each code is accepted only once
+// even when it is entered twice at the same time.
+func (r *verificationCodeRepository) Consume(ID int, codeHash string) (bool, error) {
+	db := database.GetDBInstance()
+	query := "DELETE FROM verification_codes WHERE id = ? AND codeHash = ? AND expiresAt > ?"
+	result, err := db.Exec(query, ID, codeHash, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to consume verification code in repository method Consume: ", err)
+
+		return false, errors.NewQueryError(err.Error())
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *verificationCodeRepository) DeleteExpired() error {
+	db := database.GetDBInstance()
+	query := "DELETE FROM verification_codes WHERE expiresAt <= ?"
+	result, err := db.Exec(query, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete expired verification codes in repository method DeleteExpired: ", err)
+		return errors.NewQueryError(err.Error())
+	}
+	rowsAffected, _ := result.RowsAffected()
+	utils.GetLogger().Infof("Deleted %d expired verification codes.", rowsAffected)
+	return nil
+}
@@ -0,0 +1,104 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type WebAuthnCeremonyRepository interface {
+	Create(ceremony entities.WebAuthnCeremony) error
+	FindByID(ID string) (*entities.WebAuthnCeremony, error)
+	Delete(ID string) (bool, error)
+	DeleteExpired() error
+}
+
+type webauthnCeremonyRepository struct{}
+
+func NewWebAuthnCeremonyRepository() WebAuthnCeremonyRepository {
+	return &webauthnCeremonyRepository{}
+}
+
+func (r *webauthnCeremonyRepository) Create(ceremony entities.WebAuthnCeremony) error {
+	db := database.GetDBInstance()
+	query := "INSERT INTO webauthn_ceremonies (id, userID, type, sessionData, expiresAt) VALUES (?, ?, ?, ?, ?)"
+
+	var userID sql.NullInt64
+	if ceremony.UserID != 0 {
+		userID = sql.NullInt64{Int64: int64(ceremony.UserID), Valid: true}
+	}
+
+	_, err := db.Exec(query, ceremony.ID, userID, ceremony.Type, string(ceremony.SessionData), ceremony.ExpiresAt)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to create WebAuthn ceremony in repository method Create: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *webauthnCeremonyRepository) FindByID(ID string) (*entities.WebAuthnCeremony, error) {
+	db := database.GetDBInstance()
+	ceremony := &entities.WebAuthnCeremony{}
+	query := "SELECT id, userID, type, sessionData, expiresAt, createdAt FROM webauthn_ceremonies WHERE id = ?"
+
+	var userID sql.NullInt64
+	var sessionData, expiresAt, createdAt string
+
+	err := db.QueryRow(query, ID).Scan(
+		&ceremony.ID,
+		&userID,
+		&ceremony.Type,
+		&sessionData,
+		&expiresAt,
+		&createdAt,
+	)
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	ceremony.UserID = int(userID.Int64)
+	ceremony.SessionData = []byte(sessionData)
+	if ceremony.ExpiresAt, err = parseTime(expiresAt); err != nil {
+		return nil, err
+	}
+	if ceremony.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+
+	return ceremony, nil
+}
+
+// Delete consumes the ceremony. It reports false when it was already
+// completed, so one challenge can never be answered twice.
+func (r *webauthnCeremonyRepository) Delete(ID string) (bool, error) {
+	db := database.GetDBInstance()
+	query := "DELETE FROM webauthn_ceremonies WHERE id = ?"
+	result, err := db.Exec(query, ID)
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *webauthnCeremonyRepository) DeleteExpired() error {
+	db := database.GetDBInstance()
+	query := "DELETE FROM webauthn_ceremonies WHERE expiresAt <= ?"
+	result, err := db.Exec(query, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete expired WebAuthn ceremonies in repository method DeleteExpired: ", err)
+		return errors.NewQueryError(err.Error())
+	}
+	rowsAffected, _ := result.RowsAffected()
+	utils.GetLogger().Infof("Deleted %d expired WebAuthn ceremonies.", rowsAffected)
+	return nil
+}
@@ -0,0 +1,157 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Renan-Parise/auth/database"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type WebAuthnCredentialRepository interface {
+	Create(credential entities.WebAuthnCredential) error
+	FindByUser(userID int) ([]entities.WebAuthnCredential, error)
+	FindByCredentialID(credentialID []byte) (*entities.WebAuthnCredential, error)
+	UpdateSignCount(ID int, signCount uint32, backupState bool) (bool, error)
+	Delete(userID, ID int) (bool, error)
+}
+
+type webauthnCredentialRepository struct{}
+
+func NewWebAuthnCredentialRepository() WebAuthnCredentialRepository {
+	return &webauthnCredentialRepository{}
+}
+
+const webauthnCredentialColumns = "id, userID, credentialID, publicKey, attestationType, transports, aaguid, signCount, backupEligible, backupState, name, createdAt, lastUsedAt"
+
+func (r *webauthnCredentialRepository) Create(credential entities.WebAuthnCredential) error {
+	db := database.GetDBInstance()
+	query := "INSERT INTO webauthn_credentials (userID, credentialID, publicKey, attestationType, transports, aaguid, signCount, backupEligible, backupState, name) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err := db.Exec(query,
+		credential.UserID,
+		credential.CredentialID,
+		credential.PublicKey,
+		credential.AttestationType,
+		strings.Join(credential.Transports, ","),
+		credential.AAGUID,
+		credential.SignCount,
+		credential.BackupEligible,
+		credential.BackupState,
+		credential.Name,
+	)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to create WebAuthn credential in repository method Create: ", err)
+
+		return errors.NewQueryError(err.Error())
+	}
+	return nil
+}
+
+func (r *webauthnCredentialRepository) FindByUser(userID int) ([]entities.WebAuthnCredential, error) {
+	db := database.GetDBInstance()
+	query := "SELECT " + webauthnCredentialColumns + " FROM webauthn_credentials WHERE userID = ? ORDER BY createdAt"
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to query WebAuthn credentials in repository method FindByUser: ", err)
+
+		return nil, errors.NewQueryError(err.Error())
+	}
+	defer rows.Close()
+
+	credentials := []entities.WebAuthnCredential{}
+	for rows.Next() {
+		credential, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, *credential)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	return credentials, nil
+}
+
+func (r *webauthnCredentialRepository) FindByCredentialID(credentialID []byte) (*entities.WebAuthnCredential, error) {
+	db := database.GetDBInstance()
+	query := "SELECT " + webauthnCredentialColumns + " FROM webauthn_credentials WHERE credentialID = ?"
+	return scanWebAuthnCredential(db.QueryRow(query, credentialID))
+}
+
+// UpdateSignCount stores the counter of a successful assertion. It reports
+// false when a higher counter was stored in the meantime, so two assertions
+// with the same counter cannot both succeed. Authenticators that do not
+// implement a counter always report zero.
+func (r *webauthnCredentialRepository) UpdateSignCount(ID int, signCount uint32, backupState bool) (bool, error) {
+	db := database.GetDBInstance()
+	query := "UPDATE webauthn_credentials SET signCount = ?, backupState = ?, lastUsedAt = ? WHERE id = ? AND (signCount < ? OR (signCount = 0 AND ? = 0))"
+	result, err := db.Exec(query, signCount, backupState, time.Now(), ID, signCount, signCount)
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *webauthnCredentialRepository) Delete(userID, ID int) (bool, error) {
+	db := database.GetDBInstance()
+	query := "DELETE FROM webauthn_credentials WHERE id = ? AND userID = ?"
+	result, err := db.Exec(query, ID, userID)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to delete WebAuthn credential in repository method Delete: ", err)
+
+		return false, errors.NewQueryError(err.Error())
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.NewQueryError(err.Error())
+	}
+	return rowsAffected == 1, nil
+}
+
+func scanWebAuthnCredential(row rowScanner) (*entities.WebAuthnCredential, error) {
+	credential := &entities.WebAuthnCredential{}
+
+	var transports, createdAt string
+	var lastUsedAt sql.NullString
+
+	err := row.Scan(
+		&credential.ID,
+		&credential.UserID,
+		&credential.CredentialID,
+		&credential.PublicKey,
+		&credential.AttestationType,
+		&transports,
+		&credential.AAGUID,
+		&credential.SignCount,
+		&credential.BackupEligible,
+		&credential.BackupState,
+		&credential.Name,
+		&createdAt,
+		&lastUsedAt,
+	)
+	if err != nil {
+		return nil, errors.NewQueryError(err.Error())
+	}
+
+	credential.Transports = splitList(transports)
+	if credential.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if credential.LastUsedAt, err = parseNullTime(lastUsedAt); err != nil {
+		return nil, err
+	}
+
+	return credential, nil
+}
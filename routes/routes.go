@@ -6,32 +6,148 @@ import (
 	"github.com/Renan-Parise/auth/middlewares"
 	"github.com/Renan-Parise/auth/repositories"
 	"github.com/Renan-Parise/auth/services"
+	"github.com/Renan-Parise/auth/templates"
+	"github.com/Renan-Parise/auth/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 func SetupRouter() *gin.Engine {
 	router := gin.Default()
+	err := router.SetTrustedProxies(utils.GetTrustedProxies())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to configure trusted proxies, trusting none: ", err)
+		router.SetTrustedProxies(nil)
+	}
+	router.SetHTMLTemplate(templates.Load())
 
 	userRepo := repositories.NewUserRepository()
-	financesService := client.NewFinancesService()
-	authService := services.NewAuthService(userRepo, financesService)
-	authController := controllers.NewAuthController(authService)
+	sessionRepo := repositories.NewSessionRepository()
+	refreshTokenRepo := repositories.NewRefreshTokenRepository()
+	emailVerificationService := services.NewEmailVerificationService(userRepo, client.NewFinancesService())
+	tokenService := services.NewTokenService(userRepo, sessionRepo, refreshTokenRepo)
+	sessionService := services.NewSessionService(sessionRepo, refreshTokenRepo)
+	recoveryCodeService := services.NewRecoveryCodeService(repositories.NewRecoveryCodeRepository())
+	userFactorRepo := repositories.NewUserFactorRepository()
+	otpSender := utils.NewOTPSender()
+	verificationCodeService := services.NewVerificationCodeService(repositories.NewVerificationCodeRepository())
+	totpService := services.NewTOTPService(repositories.NewTOTPRepository(), userRepo)
+	webauthnService := services.NewWebAuthnService(repositories.NewWebAuthnCredentialRepository(), repositories.NewWebAuthnCeremonyRepository(), userRepo, userFactorRepo)
+	factors := services.NewFactorRegistry(
+		services.NewEmailFactor(verificationCodeService, emailVerificationService),
+		services.NewTOTPFactor(totpService),
+		services.NewWebAuthnFactor(webauthnService),
+		services.NewSMSFactor(verificationCodeService, otpSender),
+		services.NewVoiceFactor(verificationCodeService, otpSender),
+	)
+	factorService := services.NewFactorService(factors, userFactorRepo, userRepo, recoveryCodeService)
+	trustedDeviceService := services.NewTrustedDeviceService(repositories.NewTrustedDeviceRepository())
+	loginThrottleService := services.NewLoginThrottleService(repositories.NewLoginThrottleRepository(), repositories.NewSecurityEventRepository())
+	authService := services.NewAuthService(userRepo, repositories.NewTwoFAChallengeRepository(), tokenService, sessionService, factorService, recoveryCodeService, webauthnService, trustedDeviceService, loginThrottleService, verificationCodeService, otpSender, emailVerificationService)
+	authController := controllers.NewAuthController(authService, loginThrottleService)
+	tokenController := controllers.NewTokenController(tokenService)
+	sessionController := controllers.NewSessionController(sessionService)
+	factorController := controllers.NewFactorController(factorService)
+	recoveryCodeController := controllers.NewRecoveryCodeController(authService, recoveryCodeService)
+	webauthnController := controllers.NewWebAuthnController(webauthnService, authService)
+	trustedDeviceController := controllers.NewTrustedDeviceController(trustedDeviceService)
+	emailChangeController := controllers.NewEmailChangeController(services.NewEmailChangeService(repositories.NewEmailChangeRepository(), userRepo, verificationCodeService, sessionService, emailVerificationService))
+	phoneController := controllers.NewPhoneController(services.NewPhoneService(userRepo, userFactorRepo, verificationCodeService, otpSender))
+	keyService := services.NewKeyService(repositories.NewSigningKeyRepository())
+	oauthService := services.NewOAuthService(repositories.NewOAuthClientRepository(), repositories.NewAuthorizationCodeRepository(), sessionRepo, userRepo, tokenService, sessionService)
+	introspectionService := services.NewIntrospectionService(userRepo, sessionRepo, refreshTokenRepo)
+	adminController := controllers.NewAdminController(keyService, oauthService, loginThrottleService)
+	oauthController := controllers.NewOAuthController(oauthService, introspectionService)
+	authorizeController := controllers.NewAuthorizeController(oauthService, authService)
+
+	limiter := utils.NewRateLimiter(utils.NewRateLimitStore())
+	limitLogin := middlewares.RateLimitMiddleware(limiter, utils.GetRateLimitPolicy("login", "RATE_LIMIT_LOGIN", "20/1m"), middlewares.RateLimitByIP)
+	limitLoginEmail := middlewares.RateLimitMiddleware(limiter, utils.GetRateLimitPolicy("login_email", "RATE_LIMIT_LOGIN_EMAIL", "10/15m"), middlewares.RateLimitByEmail)
+	limitRegister := middlewares.RateLimitMiddleware(limiter, utils.GetRateLimitPolicy("register", "RATE_LIMIT_REGISTER", "5/1h"), middlewares.RateLimitByIP)
+	limitRecover := middlewares.RateLimitMiddleware(limiter, utils.GetRateLimitPolicy("recover", "RATE_LIMIT_PASSWORD_RECOVER", "10/1h"), middlewares.RateLimitByIP)
+	limitRecoverEmail := middlewares.RateLimitMiddleware(limiter, utils.GetRateLimitPolicy("recover_email", "RATE_LIMIT_PASSWORD_RECOVER_EMAIL", "3/1h"), middlewares.RateLimitByEmail)
+	limitConfirmCode := middlewares.RateLimitMiddleware(limiter, utils.GetRateLimitPolicy("confirm_code", "RATE_LIMIT_CODE_CONFIRM", "20/1m"), middlewares.RateLimitByIP)
+	limitVerificationEmail := middlewares.RateLimitMiddleware(limiter, utils.GetRateLimitPolicy("verification_email", "RATE_LIMIT_VERIFICATION_EMAIL", "3/1h"), middlewares.RateLimitByEmail)
+	limitPasswordChange := middlewares.RateLimitMiddleware(limiter, utils.GetRateLimitPolicy("password_change", "RATE_LIMIT_PASSWORD_CHANGE", "5/15m"), middlewares.RateLimitByUser)
+	limitSendCode := middlewares.RateLimitMiddleware(limiter, utils.GetRateLimitPolicy("send_code", "RATE_LIMIT_SEND_CODE", "5/1h"), middlewares.RateLimitByUser)
+	limitFactorVerify := middlewares.RateLimitMiddleware(limiter, utils.GetRateLimitPolicy("factor_verify", "RATE_LIMIT_FACTOR_VERIFY", "10/15m"), middlewares.RateLimitByUser)
+	limitReauthenticate := middlewares.RateLimitMiddleware(limiter, utils.GetRateLimitPolicy("reauthenticate", "RATE_LIMIT_REAUTHENTICATE", "10/15m"), middlewares.RateLimitByUser)
+	limitPasskey := middlewares.RateLimitMiddleware(limiter, utils.GetRateLimitPolicy("passkey", "RATE_LIMIT_PASSKEY", "20/1m"), middlewares.RateLimitByIP)
+	limitToken := middlewares.RateLimitMiddleware(limiter, utils.GetRateLimitPolicy("token", "RATE_LIMIT_TOKEN", "60/1m"), middlewares.RateLimitByIP)
 
 	authRoutes := router.Group("/auth")
 	{
-		authRoutes.POST("/login", authController.Login)
-		authRoutes.POST("/register", authController.Register)
-		authRoutes.POST("/fa/confirm", authController.ConfirmTwoFA)
-		authRoutes.POST("/password/recover", authController.InitiatePasswordRecovery)
-		authRoutes.POST("/password/reset", authController.ResetPassword)
-
-		authRoutes.PUT("/update", middlewares.AuthMiddleware(), authController.Update)
-		authRoutes.DELETE("/deactivate", middlewares.AuthMiddleware(), authController.Deactivate)
-		authRoutes.POST("/fa/toggle", middlewares.AuthMiddleware(), authController.ToggleTwoFA)
-		authRoutes.POST("/fa/confirm-toggle", middlewares.AuthMiddleware(), authController.ConfirmToggleTwoFA)
+		authRoutes.POST("/login", limitLogin, limitLoginEmail, authController.Login)
+		authRoutes.POST("/register", limitRegister, authController.Register)
+		authRoutes.POST("/email/verify", limitConfirmCode, authController.VerifyEmail)
+		authRoutes.POST("/email/resend", limitRecover, limitVerificationEmail, authController.ResendEmailVerification)
+		authRoutes.POST("/fa/confirm", limitConfirmCode, authController.ConfirmTwoFA)
+		authRoutes.POST("/password/recover", limitRecover, limitRecoverEmail, authController.InitiatePasswordRecovery)
+		authRoutes.POST("/password/reset", limitConfirmCode, authController.ResetPassword)
+		authRoutes.POST("/fa/webauthn/options", limitPasskey, webauthnController.TwoFAOptions)
+		authRoutes.POST("/webauthn/login/options", limitPasskey, webauthnController.LoginOptions)
+		authRoutes.POST("/webauthn/login", limitPasskey, webauthnController.Login)
+		authRoutes.POST("/token/refresh", limitToken, tokenController.Refresh)
+		authRoutes.GET("/unlock", authController.ConfirmUnlock)
+		authRoutes.POST("/unlock", limitConfirmCode, authController.Unlock)
+		authRoutes.GET("/email/change/cancel", emailChangeController.ConfirmCancelChange)
+		authRoutes.POST("/email/change/cancel", limitConfirmCode, emailChangeController.CancelChange)
+
+		authRoutes.POST("/reauthenticate", middlewares.AuthMiddleware(), limitReauthenticate, authController.Reauthenticate)
+		authRoutes.PUT("/update", middlewares.AuthMiddleware(), middlewares.StepUpMiddleware(userRepo), authController.Update)
+		authRoutes.POST("/password/change", middlewares.AuthMiddleware(), limitPasswordChange, authController.ChangePassword)
+		authRoutes.DELETE("/deactivate", middlewares.AuthMiddleware(), middlewares.StepUpMiddleware(userRepo), authController.Deactivate)
+		authRoutes.POST("/email/change", middlewares.AuthMiddleware(), middlewares.StepUpMiddleware(userRepo), limitSendCode, emailChangeController.RequestChange)
+		authRoutes.POST("/email/change/confirm", middlewares.AuthMiddleware(), limitConfirmCode, emailChangeController.ConfirmChange)
+		authRoutes.PUT("/phone", middlewares.AuthMiddleware(), middlewares.StepUpMiddleware(userRepo), limitSendCode, phoneController.SetPhoneNumber)
+		authRoutes.POST("/phone/verify", middlewares.AuthMiddleware(), phoneController.VerifyPhoneNumber)
+		authRoutes.DELETE("/phone", middlewares.AuthMiddleware(), middlewares.StepUpMiddleware(userRepo), phoneController.RemovePhoneNumber)
+		authRoutes.GET("/factors", middlewares.AuthMiddleware(), factorController.ListFactors)
+		authRoutes.POST("/factors", middlewares.AuthMiddleware(), middlewares.StepUpMiddleware(userRepo), factorController.AddFactor)
+		authRoutes.POST("/factors/confirm", middlewares.AuthMiddleware(), middlewares.StepUpMiddleware(userRepo), limitFactorVerify, factorController.ConfirmFactor)
+		authRoutes.POST("/factors/challenge", middlewares.AuthMiddleware(), limitSendCode, factorController.Challenge)
+		authRoutes.PUT("/factors/:id/default", middlewares.AuthMiddleware(), middlewares.StepUpMiddleware(userRepo), factorController.SetDefault)
+		authRoutes.DELETE("/factors/:id", middlewares.AuthMiddleware(), limitFactorVerify, factorController.RemoveFactor)
+		authRoutes.GET("/fa/recovery-codes", middlewares.AuthMiddleware(), recoveryCodeController.Remaining)
+		authRoutes.POST("/fa/recovery-codes", middlewares.AuthMiddleware(), limitFactorVerify, recoveryCodeController.Regenerate)
+		authRoutes.POST("/webauthn/register/options", middlewares.AuthMiddleware(), middlewares.StepUpMiddleware(userRepo), webauthnController.RegistrationOptions)
+		authRoutes.POST("/webauthn/register", middlewares.AuthMiddleware(), middlewares.StepUpMiddleware(userRepo), webauthnController.Register)
+		authRoutes.GET("/webauthn/credentials", middlewares.AuthMiddleware(), webauthnController.ListCredentials)
+		authRoutes.DELETE("/webauthn/credentials/:id", middlewares.AuthMiddleware(), middlewares.StepUpMiddleware(userRepo), webauthnController.DeleteCredential)
+		authRoutes.POST("/logout", middlewares.AuthMiddleware(), sessionController.Logout)
+		authRoutes.POST("/logout/all", middlewares.AuthMiddleware(), sessionController.LogoutAll)
+		authRoutes.GET("/sessions", middlewares.AuthMiddleware(), sessionController.ListSessions)
+		authRoutes.DELETE("/sessions/:id", middlewares.AuthMiddleware(), sessionController.RevokeSession)
+		authRoutes.GET("/devices", middlewares.AuthMiddleware(), trustedDeviceController.ListDevices)
+		authRoutes.DELETE("/devices", middlewares.AuthMiddleware(), trustedDeviceController.RevokeAll)
+		authRoutes.DELETE("/devices/:id", middlewares.AuthMiddleware(), trustedDeviceController.RevokeDevice)
+	}
+
+	oauthRoutes := router.Group("/oauth")
+	{
+		oauthRoutes.GET("/authorize", authorizeController.Authorize)
+		oauthRoutes.POST("/authorize", limitLogin, authorizeController.Login)
+		oauthRoutes.POST("/authorize/2fa", limitConfirmCode, authorizeController.ConfirmTwoFA)
+		oauthRoutes.POST("/token", limitToken, oauthController.Token)
+		oauthRoutes.GET("/userinfo", middlewares.ClientAuthMiddleware(), oauthController.UserInfo)
+		oauthRoutes.POST("/userinfo", middlewares.ClientAuthMiddleware(), oauthController.UserInfo)
+		oauthRoutes.POST("/introspect", middlewares.ServiceAuthMiddleware(oauthService, "introspect"), oauthController.Introspect)
 	}
 
+	adminRoutes := router.Group("/admin", middlewares.AdminMiddleware())
+	{
+		adminRoutes.GET("/keys", adminController.ListKeys)
+		adminRoutes.POST("/keys/rotate", adminController.RotateKeys)
+		adminRoutes.GET("/clients", adminController.ListClients)
+		adminRoutes.POST("/clients", adminController.RegisterClient)
+		adminRoutes.POST("/users/:id/unlock", adminController.UnlockUser)
+		adminRoutes.GET("/users/:id/events", adminController.ListUserEvents)
+	}
+
+	wellKnownController := controllers.NewWellKnownController()
+	router.GET("/.well-known/jwks.json", wellKnownController.JWKS)
+	router.GET("/.well-known/openid-configuration", wellKnownController.OpenIDConfiguration)
+
 	pingController := controllers.NewPingController()
 	router.GET("/ping", pingController.Ping)
 
@@ -1,9 +1,9 @@
 package services
 
 import (
+	"strconv"
 	"time"
 
-	"github.com/Renan-Parise/auth/client"
 	"github.com/Renan-Parise/auth/entities"
 	"github.com/Renan-Parise/auth/errors"
 	"github.com/Renan-Parise/auth/repositories"
@@ -12,61 +12,126 @@ import (
 )
 
 type AuthService interface {
-	Login(email, password string) (string, error)
+	Login(email, password, method string, client entities.ClientInfo) (*entities.Tokens, error)
+	LoginSession(email, password, method string, client entities.ClientInfo) (*entities.Session, error)
 	Register(user entities.User) error
+	VerifyEmail(email, code string) error
+	ResendEmailVerification(email string) error
 	Update(ID int, user entities.User) error
+	ChangePassword(ID int, sessionID, currentPassword, newPassword string) error
 	DeactivateAccount(ID int) error
-	GenerateAndSendTwoFACode(user *entities.User) error
-	VerifyTwoFACode(email, code string) (string, error)
-	GenerateAndSendTwoFACodeByID(userID int) error
-	ToggleTwoFA(userID int, code string) error
-	InitiatePasswordRecovery(email string) error
+	VerifyTwoFACode(challenge, code, method string, rememberDevice bool, client entities.ClientInfo) (*entities.Tokens, error)
+	VerifyTwoFASession(challenge, method string, response entities.FactorResponse, client entities.ClientInfo) (*entities.Session, error)
+	ChallengeTwoFA(challenge, method string, client entities.ClientInfo) (interface{}, error)
+	VerifyPasskeyTwoFA(challenge, ceremonyID string, response []byte, rememberDevice bool, client entities.ClientInfo) (*entities.Tokens, error)
+	PasskeyLogin(ceremonyID string, response []byte, client entities.ClientInfo) (*entities.Tokens, error)
+	Reauthenticate(userID int, sessionID, password, method string, response entities.FactorResponse, client entities.ClientInfo) (*entities.Tokens, error)
+	RegenerateRecoveryCodes(userID int, method string, response entities.FactorResponse) ([]string, error)
+	InitiatePasswordRecovery(email, channel string) error
 	ResetPassword(email, code, newPassword string) error
 }
 
+// twoFAChallengeTTL is how long a login waits for its second factor.
+const twoFAChallengeTTL = 5 * time.Minute
+
+// passwordRecoveryTTL is how long a password recovery code can be used.
+const passwordRecoveryTTL = 30 * time.Minute
+
 type authService struct {
-	userRepo        repositories.UserRepository
-	financesService client.FinancesService
+	userRepo          repositories.UserRepository
+	challengeRepo     repositories.TwoFAChallengeRepository
+	tokenService      TokenService
+	sessionService    SessionService
+	factorService     FactorService
+	recoveryCodes     RecoveryCodeService
+	webauthnService   WebAuthnService
+	trustedDevices    TrustedDeviceService
+	loginThrottle     LoginThrottleService
+	codes             VerificationCodeService
+	otpSender         utils.OTPSender
+	emailVerification EmailVerificationService
 }
 
-func NewAuthService(repo repositories.UserRepository, finances client.FinancesService) AuthService {
+func NewAuthService(repo repositories.UserRepository, challenges repositories.TwoFAChallengeRepository, tokens TokenService, sessions SessionService, factors FactorService, recoveryCodes RecoveryCodeService, webauthn WebAuthnService, trustedDevices TrustedDeviceService, loginThrottle LoginThrottleService, codes VerificationCodeService, otp utils.OTPSender, emailVerification EmailVerificationService) AuthService {
 	return &authService{
-		userRepo:        repo,
-		financesService: finances,
+		userRepo:          repo,
+		challengeRepo:     challenges,
+		tokenService:      tokens,
+		sessionService:    sessions,
+		factorService:     factors,
+		recoveryCodes:     recoveryCodes,
+		webauthnService:   webauthn,
+		trustedDevices:    trustedDevices,
+		loginThrottle:     loginThrottle,
+		codes:             codes,
+		otpSender:         otp,
+		emailVerification: emailVerification,
+	}
+}
+
+func (s *authService) Login(email, password, method string, client entities.ClientInfo) (*entities.Tokens, error) {
+	session, err := s.LoginSession(email, password, method, client)
+	if err != nil {
+		return nil, err
 	}
+
+	return s.tokenService.IssueSessionTokens(session, "", "")
 }
 
-func (s *authService) Login(email, password string) (string, error) {
+// LoginSession starts a session without issuing tokens, for the OAuth authorization flow.
+func (s *authService) LoginSession(email, password, method string, client entities.ClientInfo) (*entities.Session, error) {
 	user, err := s.userRepo.FindByEmail(email)
 	if err != nil {
-		return "", errors.NewServiceError("authentication failed because user does not exist")
+		if err := s.loginThrottle.Check(0, client); err != nil {
+			return nil, err
+		}
+
+		s.loginThrottle.RecordFailure(nil, client)
+		return nil, errors.NewServiceError("authentication failed because user does not exist")
 	}
 
 	if !user.Active {
-		return "", errors.NewServiceError("authentication failed because account is deactivated")
+		return nil, errors.NewServiceError("authentication failed because account is deactivated")
+	}
+
+	err = s.loginThrottle.Check(user.ID, client)
+	if err != nil {
+		return nil, err
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
-		return "", errors.NewServiceError("authentication failed because password is incorrect")
+		s.loginThrottle.RecordFailure(user, client)
+		return nil, errors.NewServiceError("authentication failed because password is incorrect")
 	}
 
-	if user.Is2FAEnabled {
-		err := s.GenerateAndSendTwoFACode(user)
-		if err != nil {
-			return "", errors.NewServiceError("failed to send 2FA code")
-		}
-		return "", entities.ErrTwoFARequired
+	s.loginThrottle.RecordSuccess(user.ID)
+
+	err = checkEmailVerified(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Is2FAEnabled && !s.trustedDevices.IsTrusted(user.ID, client) {
+		return nil, s.startTwoFA(user, method, client)
 	}
 
-	return utils.GenerateToken(user.ID)
+	return s.tokenService.StartSession(user.ID, client, []string{entities.AuthMethodPassword})
 }
 
+// Register creates the account and emails a code to verify its address.
+// The default categories are created now or once the address is verified,
+// depending on DEFAULT_CATEGORIES_ON. Failing to send the email does not fail
+// the registration, as the user can ask for it again.
 func (s *authService) Register(user entities.User) error {
 	if err := user.Validate(); err != nil {
 		return err
 	}
 
+	if err := utils.GetPasswordPolicy().Check(user.Password, user.Username, user.Email); err != nil {
+		return err
+	}
+
 	_, err := s.userRepo.FindByEmail(user.Email)
 	if err == nil {
 		return errors.NewServiceError("user already exists. please login or use another email")
@@ -78,6 +143,7 @@ func (s *authService) Register(user entities.User) error {
 	}
 
 	user.Password = string(hashedPassword)
+	user.EmailVerified = false
 
 	err = s.userRepo.Create(user)
 	if err != nil {
@@ -89,27 +155,148 @@ func (s *authService) Register(user entities.User) error {
 		return errors.NewServiceError("failed to fetch created user details")
 	}
 
-	err = s.financesService.CreateDefaultCategories(int64(createdUser.ID))
+	err = s.emailVerification.Registered(createdUser.ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.sendEmailVerification(createdUser)
+	if err != nil {
+		utils.GetLogger().WithError(err).Errorf("Failed to send verification email to user %d", createdUser.ID)
+	}
+
+	return nil
+}
+
+// VerifyEmail verifies the user's email address with the code emailed by
+// Register or ResendEmailVerification.
+func (s *authService) VerifyEmail(email, code string) error {
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return errors.NewServiceError("user not found")
+	}
+
+	if user.EmailVerified {
+		return errors.NewServiceError("email is already verified")
+	}
+
+	// The code is only spent once the address is recorded, so that it can be
+	// entered again when creating the default categories fails.
+	stored, err := s.codes.Check(user.ID, entities.VerificationPurposeEmail, code)
+	if err != nil {
+		return err
+	}
+
+	err = s.emailVerification.MarkVerified(user)
+	if err != nil {
+		return err
+	}
+
+	err = s.codes.Consume(stored)
+	if err != nil {
+		utils.GetLogger().WithError(err).Errorf("Failed to consume the email verification code of user %d", user.ID)
+	}
+
+	return nil
+}
+
+// ResendEmailVerification emails a new verification code, which replaces the
+// previous one.
+func (s *authService) ResendEmailVerification(email string) error {
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return errors.NewServiceError("user not found")
+	}
+
+	if user.EmailVerified {
+		return errors.NewServiceError("email is already verified")
+	}
+
+	return s.sendEmailVerification(user)
+}
+
+func (s *authService) sendEmailVerification(user *entities.User) error {
+	code, err := s.codes.Issue(user.ID, entities.VerificationPurposeEmail, entities.TwoFAMethodEmail, utils.GetEmailVerificationTTL())
 	if err != nil {
-		utils.GetLogger().WithError(err).Error("failed to create default categories for user")
+		return err
+	}
 
-		return errors.NewServiceError("failed to create default categories for user")
+	err = s.sendVerificationEmail(user.Email, code)
+	if err != nil {
+		return errors.NewServiceError("failed to send verification email")
 	}
 
 	return nil
 }
 
+// checkEmailVerified refuses logins of users who have not verified their
+// email address while LOGIN_REQUIRES_VERIFIED_EMAIL is set.
+func checkEmailVerified(user *entities.User) error {
+	if !user.EmailVerified && utils.GetLoginRequiresVerifiedEmail() {
+		return &entities.EmailNotVerifiedError{Email: user.Email}
+	}
+
+	return nil
+}
+
+// Update changes the user's profile. The password and email address have
+// their own flows, ChangePassword and EmailChangeService.
 func (s *authService) Update(ID int, user entities.User) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if user.Username == "" {
+		return errors.NewValidationError("username", "username is required. please provide a valid username")
+	}
+
+	err := s.userRepo.Update(ID, user)
 	if err != nil {
-		return errors.NewServiceError("failed to hash password. please try again")
+		return errors.NewServiceError("failed to update user. please try again")
+	}
+
+	return nil
+}
+
+// ChangePassword replaces the password of a signed in user, who has to enter
+// the current one. All other sessions are revoked, and the user is emailed
+// about the change.
+func (s *authService) ChangePassword(ID int, sessionID, currentPassword, newPassword string) error {
+	user, err := s.userRepo.FindByID(ID)
+	if err != nil {
+		return errors.NewServiceError("user not found")
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword))
+	if err != nil {
+		return errors.NewServiceError("current password is incorrect")
+	}
+
+	err = utils.GetPasswordPolicy().Check(newPassword, user.Username, user.Email)
+	if err != nil {
+		return err
+	}
+
+	if newPassword == currentPassword {
+		return errors.NewValidationError("newPassword", "new password must differ from the current one")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.NewServiceError("failed to hash new password")
 	}
 
 	user.Password = string(hashedPassword)
 
-	err = s.userRepo.Update(ID, user)
+	err = s.userRepo.UpdatePassword(user)
 	if err != nil {
-		return errors.NewServiceError("failed to update user. please try again")
+		return errors.NewServiceError("failed to update password")
+	}
+
+	err = s.sessionService.LogoutOthers(user.ID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	err = s.sendPasswordChangedEmail(user.Email)
+	if err != nil {
+		utils.GetLogger().WithError(err).Errorf("Failed to send password changed email to user %d", user.ID)
 	}
 
 	return nil
@@ -120,97 +307,329 @@ func (s *authService) DeactivateAccount(ID int) error {
 	if err != nil {
 		return errors.NewServiceError("failed to deactivate account")
 	}
-	return nil
+
+	return s.sessionService.LogoutAll(ID)
 }
 
-func (s *authService) GenerateAndSendTwoFACode(user *entities.User) error {
-	code := utils.GenerateCode(6)
+// VerifyTwoFACode completes a login like VerifyTwoFASession and issues its
+// tokens. With rememberDevice the tokens also carry a device token that
+// skips 2FA on this device until it expires.
+func (s *authService) VerifyTwoFACode(challenge, code, method string, rememberDevice bool, client entities.ClientInfo) (*entities.Tokens, error) {
+	session, err := s.VerifyTwoFASession(challenge, method, entities.FactorResponse{Code: code}, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTwoFATokens(session, rememberDevice, client)
+}
 
-	user.TwoFACode = &code
-	expirationTime := time.Now().Add(5 * time.Minute)
-	user.TwoFACodeExpiresAt = &expirationTime
+// VerifyTwoFASession completes a login started by LoginSession by checking
+// the answer to the 2FA challenge the login returned, and starts the
+// session. method defaults to the one the login asked for, but any of the
+// user's factors is accepted, and so is a recovery code.
+func (s *authService) VerifyTwoFASession(challenge, method string, response entities.FactorResponse, client entities.ClientInfo) (*entities.Session, error) {
+	return s.verifyTwoFA(challenge, method, response, client)
+}
 
-	err := s.userRepo.UpdateTwoFACode(user)
+// ChallengeTwoFA lets a login that LoginSession left waiting answer another
+// of the user's factors. It sends a new code or returns new WebAuthn options,
+// like the login did for the first factor.
+func (s *authService) ChallengeTwoFA(challenge, method string, client entities.ClientInfo) (interface{}, error) {
+	pending, err := s.findChallenge(challenge, client)
+	if err != nil {
+		return nil, err
+	}
+
+	if method == entities.TwoFAMethodRecovery {
+		return nil, nil
+	}
+
+	return s.factorService.Challenge(pending.UserID, method)
+}
+
+// VerifyPasskeyTwoFA completes a login with an assertion from one of the
+// user's passkeys for a ceremony started by ChallengeTwoFA.
+// rememberDevice works as in VerifyTwoFACode.
+func (s *authService) VerifyPasskeyTwoFA(challenge, ceremonyID string, response []byte, rememberDevice bool, client entities.ClientInfo) (*entities.Tokens, error) {
+	session, err := s.verifyTwoFA(challenge, entities.TwoFAMethodWebAuthn, entities.FactorResponse{CeremonyID: ceremonyID, Credential: response}, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTwoFATokens(session, rememberDevice, client)
+}
+
+// issueTwoFATokens issues the tokens of a session that passed 2FA and, when
+// the user asked for it, trusts the device the login came from.
+func (s *authService) issueTwoFATokens(session *entities.Session, rememberDevice bool, client entities.ClientInfo) (*entities.Tokens, error) {
+	tokens, err := s.tokenService.IssueSessionTokens(session, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if rememberDevice {
+		tokens.DeviceToken, err = s.trustedDevices.Trust(session.UserID, client)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tokens, nil
+}
+
+// PasskeyLogin signs a user in without a password, with an assertion for a
+// passwordless ceremony started by WebAuthnService.BeginLogin. The passkey
+// verifies the user itself, so no further factor is asked for.
+func (s *authService) PasskeyLogin(ceremonyID string, response []byte, client entities.ClientInfo) (*entities.Tokens, error) {
+	userID, err := s.webauthnService.FinishLogin(0, ceremonyID, response)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.NewServiceError("authentication failed because user does not exist")
+	}
+
+	if !user.Active {
+		return nil, errors.NewServiceError("authentication failed because account is deactivated")
+	}
+
+	err = checkEmailVerified(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.tokenService.IssueTokens(user.ID, client, []string{entities.AuthMethodHardware, entities.AuthMethodMFA})
+}
+
+// Reauthenticate issues tokens whose auth_time and amr reflect a fresh authentication.
+func (s *authService) Reauthenticate(userID int, sessionID, password, method string, response entities.FactorResponse, client entities.ClientInfo) (*entities.Tokens, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.NewServiceError("user not found")
+	}
+
+	err = s.loginThrottle.Check(user.ID, client)
+	if err != nil {
+		return nil, err
+	}
+
+	amr := []string{}
+
+	if password != "" {
+		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+		if err != nil {
+			s.loginThrottle.RecordFailure(user, client)
+			return nil, errors.NewServiceError("reauthentication failed because password is incorrect")
+		}
+		amr = append(amr, entities.AuthMethodPassword)
+	}
+
+	if method != "" {
+		authMethod, err := s.factorService.Verify(user.ID, method, response)
+		if err != nil {
+			s.loginThrottle.RecordFailure(user, client)
+			return nil, err
+		}
+		amr = append(amr, authMethod, entities.AuthMethodMFA)
+	}
+
+	if len(amr) == 0 {
+		return nil, errors.NewServiceError("password or 2FA code is required")
+	}
+
+	s.loginThrottle.RecordSuccess(user.ID)
+
+	session, err := s.tokenService.Reauthenticate(sessionID, amr)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.tokenService.IssueSessionTokens(session, "", "")
+}
+
+// startTwoFA challenges the chosen factor, which for email sends the code,
+// and returns a TwoFARequiredError with a new challenge for the second step.
+func (s *authService) startTwoFA(user *entities.User, method string, client entities.ClientInfo) error {
+	var err error
+	if method == "" {
+		method, err = s.factorService.DefaultType(user.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Recovery codes are not sent anywhere, and they must keep working when
+	// the user's factors cannot be challenged.
+	var options interface{}
+	if method != entities.TwoFAMethodRecovery {
+		options, err = s.factorService.Challenge(user.ID, method)
+		if err != nil {
+			return err
+		}
+	}
+
+	factors, err := s.factorService.ListFactors(user.ID)
 	if err != nil {
 		return err
 	}
 
-	err = s.sendTwoFACodeEmail(user.Email, code)
+	methods := []string{}
+	for _, factor := range factors {
+		if factor.ConfirmedAt != nil {
+			methods = append(methods, factor.Type)
+		}
+	}
+
+	challengeID, err := utils.GenerateSecureToken(16)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	expiresAt := time.Now().Add(twoFAChallengeTTL)
+	err = s.challengeRepo.Create(entities.TwoFAChallenge{
+		ID:        challengeID,
+		UserID:    user.ID,
+		Method:    method,
+		UserAgent: client.UserAgent,
+		IPAddress: client.IPAddress,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return errors.NewServiceError("failed to start 2FA")
+	}
+
+	challenge, err := utils.GenerateChallengeToken(strconv.Itoa(user.ID), challengeID, expiresAt)
+	if err != nil {
+		return errors.NewServiceError("failed to start 2FA")
+	}
+
+	return &entities.TwoFARequiredError{Method: method, Challenge: challenge, Options: options, Methods: methods}
 }
 
-func (s *authService) VerifyTwoFACode(email string, code string) (string, error) {
-	user, err := s.userRepo.FindByEmail(email)
+// findChallenge checks the signature and lifetime of a challenge token and
+// that it is presented by the client whose password step issued it.
+func (s *authService) findChallenge(token string, client entities.ClientInfo) (*entities.TwoFAChallenge, error) {
+	claims, err := utils.ValidateToken(token, utils.ChallengeTokenAudience)
 	if err != nil {
-		return "", errors.NewServiceError("user not found")
+		return nil, errors.NewServiceError("invalid or expired 2FA challenge")
 	}
 
-	if *user.TwoFACode != code || time.Now().After(*user.TwoFACodeExpiresAt) {
-		return "", errors.NewServiceError("invalid or expired 2FA code")
+	challenge, err := s.challengeRepo.FindByID(claims.ID)
+	if err != nil || strconv.Itoa(challenge.UserID) != claims.Subject || challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) {
+		return nil, errors.NewServiceError("invalid or expired 2FA challenge")
 	}
 
-	user.TwoFACode = nil
-	user.TwoFACodeExpiresAt = nil
+	if challenge.UserAgent != client.UserAgent {
+		utils.GetLogger().Warnf("2FA challenge for user %d presented by a different client", challenge.UserID)
+		return nil, errors.NewServiceError("invalid or expired 2FA challenge")
+	}
 
-	err = s.userRepo.UpdateTwoFACode(user)
+	return challenge, nil
+}
+
+func (s *authService) verifyTwoFA(token, method string, response entities.FactorResponse, client entities.ClientInfo) (*entities.Session, error) {
+	challenge, err := s.findChallenge(token, client)
+	if err != nil {
+		return nil, err
+	}
+
+	counted, err := s.challengeRepo.CountAttempt(challenge.ID, entities.TwoFAChallengeMaxAttempts)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to verify 2FA challenge")
+	}
+	if !counted {
+		return nil, errors.NewServiceError("too many 2FA attempts. please log in again")
+	}
+
+	if method == "" {
+		method = challenge.Method
+	}
+
+	authMethod, err := s.factorService.Verify(challenge.UserID, method, response)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return utils.GenerateToken(user.ID)
+	return s.completeChallenge(challenge, []string{entities.AuthMethodPassword, authMethod, entities.AuthMethodMFA})
 }
 
-func (s *authService) GenerateAndSendTwoFACodeByID(userID int) error {
-	user, err := s.userRepo.FindByID(userID)
+// completeChallenge spends the challenge and starts the session for the
+// client that entered the password.
+func (s *authService) completeChallenge(challenge *entities.TwoFAChallenge, amr []string) (*entities.Session, error) {
+	used, err := s.challengeRepo.MarkUsed(challenge.ID)
 	if err != nil {
-		return errors.NewServiceError("user not found")
+		return nil, errors.NewServiceError("failed to complete 2FA challenge")
+	}
+	if !used {
+		return nil, errors.NewServiceError("invalid or expired 2FA challenge")
 	}
 
-	return s.GenerateAndSendTwoFACode(user)
+	client := entities.ClientInfo{UserAgent: challenge.UserAgent, IPAddress: challenge.IPAddress}
+	return s.tokenService.StartSession(challenge.UserID, client, amr)
 }
 
-func (s *authService) ToggleTwoFA(userID int, code string) error {
+// RegenerateRecoveryCodes replaces the user's recovery codes. It requires a
+// fresh answer to one of the user's factors, named by method and defaulting
+// to the default one, so that a stolen session alone cannot read out new
+// codes.
+func (s *authService) RegenerateRecoveryCodes(userID int, method string, response entities.FactorResponse) ([]string, error) {
 	user, err := s.userRepo.FindByID(userID)
 	if err != nil {
-		return errors.NewServiceError("user not found")
+		return nil, errors.NewServiceError("user not found")
 	}
 
-	if *user.TwoFACode != code || time.Now().After(*user.TwoFACodeExpiresAt) {
-		return errors.NewServiceError("invalid or expired 2FA code")
+	if !user.Is2FAEnabled {
+		return nil, errors.NewServiceError("2FA is not enabled")
 	}
 
-	if user.Is2FAEnabled {
-		user.Is2FAEnabled = false
-	} else {
-		user.Is2FAEnabled = true
+	if method == "" {
+		method, err = s.factorService.DefaultType(user.ID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	err = s.userRepo.UpdateTwoFASettings(user)
+	_, err = s.factorService.Verify(user.ID, method, response)
 	if err != nil {
-		return errors.NewServiceError("failed to update 2FA settings")
+		return nil, err
 	}
 
-	return nil
+	return s.recoveryCodes.Generate(user.ID)
 }
 
-func (s *authService) InitiatePasswordRecovery(email string) error {
+// InitiatePasswordRecovery sends a recovery code by email, or by text message
+// or voice call to the user's verified phone number when channel is sms or
+// voice.
+func (s *authService) InitiatePasswordRecovery(email, channel string) error {
 	user, err := s.userRepo.FindByEmail(email)
 	if err != nil {
 		return errors.NewServiceError("user not found")
 	}
 
-	code := utils.GenerateCode(6)
-	user.PasswordRecoveryCode = &code
-	expirationTime := time.Now().Add(30 * time.Minute)
-	user.RecoveryCodeExpiresAt = &expirationTime
+	switch channel {
+	case "", entities.TwoFAMethodEmail:
+		channel = entities.TwoFAMethodEmail
+	case entities.OTPChannelSMS, entities.OTPChannelVoice:
+		if user.PhoneNumber == nil || !user.PhoneVerified {
+			return errors.NewServiceError("no verified phone number")
+		}
+	default:
+		return errors.NewServiceError("unsupported recovery channel")
+	}
 
-	err = s.userRepo.UpdatePasswordRecoveryCode(user)
+	code, err := s.codes.Issue(user.ID, entities.VerificationPurposePasswordRecovery, channel, passwordRecoveryTTL)
 	if err != nil {
-		return errors.NewServiceError("failed to save recovery code")
+		return err
+	}
+
+	if channel != entities.TwoFAMethodEmail {
+		err = sendOTP(s.otpSender, *user.PhoneNumber, channel, "password recovery", code)
+		if err != nil {
+			return errors.NewServiceError("failed to send recovery code")
+		}
+		return nil
 	}
 
 	err = s.sendPasswordRecoveryEmail(user.Email, code)
@@ -227,8 +646,15 @@ func (s *authService) ResetPassword(email, code, newPassword string) error {
 		return errors.NewServiceError("user not found")
 	}
 
-	if user.PasswordRecoveryCode == nil || *user.PasswordRecoveryCode != code || time.Now().After(*user.RecoveryCodeExpiresAt) {
-		return errors.NewServiceError("invalid or expired recovery code")
+	// Checked first so that a rejected password does not spend the code.
+	err = utils.GetPasswordPolicy().Check(newPassword, user.Username, user.Email)
+	if err != nil {
+		return err
+	}
+
+	recoveryCode, err := s.codes.Verify(user.ID, entities.VerificationPurposePasswordRecovery, code)
+	if err != nil {
+		return err
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
@@ -237,13 +663,31 @@ func (s *authService) ResetPassword(email, code, newPassword string) error {
 	}
 
 	user.Password = string(hashedPassword)
-	user.PasswordRecoveryCode = nil
-	user.RecoveryCodeExpiresAt = nil
 
 	err = s.userRepo.UpdatePassword(user)
 	if err != nil {
 		return errors.NewServiceError("failed to update password")
 	}
 
+	err = s.trustedDevices.RevokeAll(user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.sessionService.LogoutAll(user.ID)
+	if err != nil {
+		return err
+	}
+
+	// A code that went to the phone says nothing about the email address.
+	// The password is already reset, so failing to record the address only
+	// leaves it to be verified again.
+	if recoveryCode.Channel == entities.TwoFAMethodEmail && !user.EmailVerified {
+		err = s.emailVerification.MarkVerified(user)
+		if err != nil {
+			utils.GetLogger().WithError(err).Errorf("Failed to mark the email of user %d as verified", user.ID)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/repositories"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type EmailChangeService interface {
+	RequestChange(userID int, newEmail string) error
+	ConfirmChange(userID int, code string) error
+	CancelChange(token string) error
+}
+
+type emailChangeService struct {
+	changeRepo        repositories.EmailChangeRepository
+	userRepo          repositories.UserRepository
+	codes             VerificationCodeService
+	sessionService    SessionService
+	emailVerification EmailVerificationService
+}
+
+func NewEmailChangeService(changeRepo repositories.EmailChangeRepository, userRepo repositories.UserRepository, codes VerificationCodeService, sessions SessionService, emailVerification EmailVerificationService) EmailChangeService {
+	return &emailChangeService{
+		changeRepo:        changeRepo,
+		userRepo:          userRepo,
+		codes:             codes,
+		sessionService:    sessions,
+		emailVerification: emailVerification,
+	}
+}
+
+// RequestChange starts a change of the user's email address. The old address
+// is told about it first, with a link that cancels it, and only then is the
+// code that confirms it sent to the new address. Requesting another change
+// replaces the pending one.
+func (s *emailChangeService) RequestChange(userID int, newEmail string) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.NewServiceError("user not found")
+	}
+
+	newEmail = strings.TrimSpace(newEmail)
+	err = entities.ValidateEmail(newEmail)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(newEmail, user.Email) {
+		return errors.NewServiceError("new email is the same as the current one")
+	}
+
+	_, err = s.userRepo.FindByEmail(newEmail)
+	if err == nil {
+		return errors.NewServiceError("email is already in use")
+	}
+
+	cancelToken, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return errors.NewServiceError("failed to start email change")
+	}
+
+	ttl := utils.GetEmailChangeTTL()
+	err = s.changeRepo.Save(entities.EmailChange{
+		UserID:          user.ID,
+		NewEmail:        newEmail,
+		CancelTokenHash: utils.HashToken(cancelToken),
+		ExpiresAt:       time.Now().Add(ttl),
+	})
+	if err != nil {
+		return errors.NewServiceError("failed to start email change")
+	}
+
+	code, err := s.codes.Issue(user.ID, entities.VerificationPurposeEmailChange, entities.TwoFAMethodEmail, ttl)
+	if err != nil {
+		return err
+	}
+
+	cancelURL := utils.GetEmailChangeCancelURL() + "?token=" + url.QueryEscape(cancelToken)
+	err = s.sendEmailChangeNotice(user.Email, newEmail, cancelURL)
+	if err != nil {
+		return errors.NewServiceError("failed to notify current email")
+	}
+
+	err = s.sendEmailChangeConfirmation(newEmail, code)
+	if err != nil {
+		return errors.NewServiceError("failed to send confirmation email")
+	}
+
+	return nil
+}
+
+// ConfirmChange swaps in the new address with the code sent to it, and
+// revokes all of the user's sessions, which have to log in again with it.
+func (s *emailChangeService) ConfirmChange(userID int, code string) error {
+	change, err := s.changeRepo.FindActive(userID)
+	if err != nil {
+		return errors.NewServiceError("no pending email change")
+	}
+
+	_, err = s.codes.Verify(userID, entities.VerificationPurposeEmailChange, code)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.changeRepo.Delete(change.ID)
+	if err != nil {
+		return errors.NewServiceError("failed to change email")
+	}
+	if !deleted {
+		return errors.NewServiceError("no pending email change")
+	}
+
+	// The address may have been registered since the change was requested.
+	_, err = s.userRepo.FindByEmail(change.NewEmail)
+	if err == nil {
+		return errors.NewServiceError("email is already in use")
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.NewServiceError("user not found")
+	}
+
+	err = s.userRepo.UpdateEmail(userID, change.NewEmail)
+	if err != nil {
+		return errors.NewServiceError("failed to change email")
+	}
+
+	// The code proved the new address. When recording that fails the address
+	// stays unverified and can be verified again like a new one.
+	err = s.emailVerification.MarkVerified(user)
+	if err != nil {
+		utils.GetLogger().WithError(err).Errorf("Failed to mark the new email of user %d as verified", userID)
+	}
+
+	return s.sessionService.LogoutAll(userID)
+}
+
+// CancelChange drops a pending change with the token from the link sent to
+// the old address.
+func (s *emailChangeService) CancelChange(token string) error {
+	change, err := s.changeRepo.FindByCancelToken(utils.HashToken(token))
+	if err != nil {
+		return errors.NewServiceError("invalid or expired link")
+	}
+
+	_, err = s.changeRepo.Delete(change.ID)
+	if err != nil {
+		return errors.NewServiceError("failed to cancel email change")
+	}
+
+	return nil
+}
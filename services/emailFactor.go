@@ -0,0 +1,77 @@
+package services
+
+import (
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+// emailCodeTTL is how long a code sent by email can be used.
+const emailCodeTTL = 5 * time.Minute
+
+type emailFactor struct {
+	codes             VerificationCodeService
+	emailVerification EmailVerificationService
+}
+
+// NewEmailFactor returns the factor that emails a code to the user's
+// address. Entering a code also confirms that the address is the user's.
+func NewEmailFactor(codes VerificationCodeService, emailVerification EmailVerificationService) Factor {
+	return &emailFactor{
+		codes:             codes,
+		emailVerification: emailVerification,
+	}
+}
+
+func (f *emailFactor) Type() string {
+	return entities.TwoFAMethodEmail
+}
+
+func (f *emailFactor) AuthMethod() string {
+	return entities.AuthMethodOTP
+}
+
+func (f *emailFactor) Enroll(user *entities.User, factor *entities.UserFactor) (interface{}, error) {
+	return f.Challenge(user, factor)
+}
+
+// Challenge emails a new code, which replaces any code sent before.
+func (f *emailFactor) Challenge(user *entities.User, factor *entities.UserFactor) (interface{}, error) {
+	code, err := f.codes.Issue(user.ID, entities.VerificationPurposeFactor(f.Type()), entities.TwoFAMethodEmail, emailCodeTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.sendTwoFACodeEmail(user.Email, code)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to send 2FA code")
+	}
+
+	return nil, nil
+}
+
+func (f *emailFactor) Verify(user *entities.User, factor *entities.UserFactor, response entities.FactorResponse) error {
+	_, err := f.codes.Verify(user.ID, entities.VerificationPurposeFactor(f.Type()), response.Code)
+	if err != nil {
+		return err
+	}
+
+	if user.EmailVerified {
+		return nil
+	}
+
+	// The code was right, so the factor is verified even if recording the
+	// address fails; it is recorded the next time the address is proven.
+	err = f.emailVerification.MarkVerified(user)
+	if err != nil {
+		utils.GetLogger().WithError(err).Errorf("Failed to mark the email of user %d as verified", user.ID)
+	}
+
+	return nil
+}
+
+func (f *emailFactor) Remove(user *entities.User, factor *entities.UserFactor) error {
+	return nil
+}
@@ -2,6 +2,8 @@ package services
 
 import (
 	"fmt"
+	"net/url"
+	"time"
 
 	"github.com/Renan-Parise/auth/entities"
 	"github.com/Renan-Parise/auth/utils"
@@ -22,7 +24,44 @@ func (s *authService) sendPasswordRecoveryEmail(email, code string) error {
 	return nil
 }
 
-func (s *authService) sendTwoFACodeEmail(email, code string) error {
+func (s *authService) sendPasswordChangedEmail(email string) error {
+	emailEntity := entities.Email{
+		Address: email,
+		Subject: "Your Password Was Changed",
+		Body: "The password of your account was just changed and your other sessions were signed out. " +
+			"If this was not you, reset your password now and review your account's security settings.",
+	}
+
+	err := utils.SendEmail(emailEntity)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *authService) sendVerificationEmail(email, code string) error {
+	body := fmt.Sprintf("Your email verification code is: %s", code)
+	if verificationURL := utils.GetEmailVerificationURL(); verificationURL != "" {
+		query := url.Values{"email": {email}, "code": {code}}
+		body += fmt.Sprintf("\nOr verify your email address by opening this link: %s?%s", verificationURL, query.Encode())
+	}
+
+	emailEntity := entities.Email{
+		Address: email,
+		Subject: "Verify Your Email Address",
+		Body:    body,
+	}
+
+	err := utils.SendEmail(emailEntity)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (f *emailFactor) sendTwoFACodeEmail(email, code string) error {
 	emailEntity := entities.Email{
 		Address: email,
 		Subject: "Your Two-Factor Authentication Code",
@@ -36,3 +75,52 @@ func (s *authService) sendTwoFACodeEmail(email, code string) error {
 
 	return nil
 }
+
+func (s *loginThrottleService) sendLockoutEmail(email, unlockURL string, lockedUntil time.Time) error {
+	emailEntity := entities.Email{
+		Address: email,
+		Subject: "Your Account Has Been Locked",
+		Body: fmt.Sprintf("We locked your account until %s after too many failed login attempts. "+
+			"If this was you, you can unlock it now: %s\nIf it was not, consider changing your password.",
+			lockedUntil.UTC().Format("2006-01-02 15:04 MST"), unlockURL),
+	}
+
+	err := utils.SendEmail(emailEntity)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *emailChangeService) sendEmailChangeNotice(email, newEmail, cancelURL string) error {
+	emailEntity := entities.Email{
+		Address: email,
+		Subject: "Your Email Address Is Being Changed",
+		Body: fmt.Sprintf("A change of your account's email address to %s was requested. "+
+			"It takes effect once the new address is confirmed.\nIf this was not you, cancel it now and change your password: %s",
+			newEmail, cancelURL),
+	}
+
+	err := utils.SendEmail(emailEntity)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *emailChangeService) sendEmailChangeConfirmation(email, code string) error {
+	emailEntity := entities.Email{
+		Address: email,
+		Subject: "Confirm Your New Email Address",
+		Body:    fmt.Sprintf("Your email change confirmation code is: %s", code),
+	}
+
+	err := utils.SendEmail(emailEntity)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
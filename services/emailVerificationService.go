@@ -0,0 +1,75 @@
+package services
+
+import (
+	"github.com/Renan-Parise/auth/client"
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/repositories"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+// defaultCategoriesOnVerification is the DEFAULT_CATEGORIES_ON value that
+// waits for the email address to be verified.
+const defaultCategoriesOnVerification = "verification"
+
+// EmailVerificationService is the one place that records verified email
+// addresses, so that every way of proving an address creates the user's
+// default categories when DEFAULT_CATEGORIES_ON waits for it.
+type EmailVerificationService interface {
+	Registered(userID int) error
+	MarkVerified(user *entities.User) error
+}
+
+type emailVerificationService struct {
+	userRepo        repositories.UserRepository
+	financesService client.FinancesService
+}
+
+func NewEmailVerificationService(userRepo repositories.UserRepository, finances client.FinancesService) EmailVerificationService {
+	return &emailVerificationService{
+		userRepo:        userRepo,
+		financesService: finances,
+	}
+}
+
+// Registered creates the default categories of a new user, unless they wait
+// for the email address to be verified.
+func (s *emailVerificationService) Registered(userID int) error {
+	if utils.GetDefaultCategoriesOn() == defaultCategoriesOnVerification {
+		return nil
+	}
+
+	return s.createDefaultCategories(userID)
+}
+
+// MarkVerified records that the user proved access to their current email
+// address. The first time they do, their default categories are created when
+// they were waiting for it; if that fails the address is left unverified, so
+// that verifying it again retries.
+func (s *emailVerificationService) MarkVerified(user *entities.User) error {
+	if !user.EmailVerified && utils.GetDefaultCategoriesOn() == defaultCategoriesOnVerification {
+		err := s.createDefaultCategories(user.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := s.userRepo.MarkEmailVerified(user.ID)
+	if err != nil {
+		return errors.NewServiceError("failed to mark email as verified")
+	}
+
+	user.EmailVerified = true
+	return nil
+}
+
+func (s *emailVerificationService) createDefaultCategories(userID int) error {
+	err := s.financesService.CreateDefaultCategories(int64(userID))
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("failed to create default categories for user")
+
+		return errors.NewServiceError("failed to create default categories for user")
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+)
+
+// Factor is one kind of second factor. Enroll starts adding it for a user
+// and returns what the user needs to set it up, Challenge prepares a login
+// step, such as sending a code or creating WebAuthn options, and Verify
+// checks the user's answer. While the factor is not confirmed yet, Verify
+// completes its enrollment instead.
+type Factor interface {
+	Type() string
+	AuthMethod() string
+	Enroll(user *entities.User, factor *entities.UserFactor) (interface{}, error)
+	Challenge(user *entities.User, factor *entities.UserFactor) (interface{}, error)
+	Verify(user *entities.User, factor *entities.UserFactor, response entities.FactorResponse) error
+	Remove(user *entities.User, factor *entities.UserFactor) error
+}
+
+// FactorRegistry holds the kinds of factors users can add, by type.
+type FactorRegistry map[string]Factor
+
+func NewFactorRegistry(factors ...Factor) FactorRegistry {
+	registry := FactorRegistry{}
+	for _, factor := range factors {
+		registry[factor.Type()] = factor
+	}
+	return registry
+}
+
+func (r FactorRegistry) Get(factorType string) (Factor, error) {
+	factor, exists := r[factorType]
+	if !exists {
+		return nil, errors.NewServiceError("unsupported 2FA method")
+	}
+	return factor, nil
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/repositories"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type FactorService interface {
+	ListFactors(userID int) ([]entities.UserFactor, error)
+	AddFactor(userID int, factorType string) (interface{}, error)
+	ConfirmFactor(userID int, factorType string, response entities.FactorResponse) ([]string, error)
+	SetDefault(userID, ID int) error
+	RemoveFactor(userID, ID int, method string, response entities.FactorResponse) error
+	DefaultType(userID int) (string, error)
+	Challenge(userID int, factorType string) (interface{}, error)
+	Verify(userID int, factorType string, response entities.FactorResponse) (string, error)
+}
+
+type factorService struct {
+	factors       FactorRegistry
+	factorRepo    repositories.UserFactorRepository
+	userRepo      repositories.UserRepository
+	recoveryCodes RecoveryCodeService
+}
+
+func NewFactorService(factors FactorRegistry, factorRepo repositories.UserFactorRepository, userRepo repositories.UserRepository, recoveryCodes RecoveryCodeService) FactorService {
+	return &factorService{
+		factors:       factors,
+		factorRepo:    factorRepo,
+		userRepo:      userRepo,
+		recoveryCodes: recoveryCodes,
+	}
+}
+
+func (s *factorService) ListFactors(userID int) ([]entities.UserFactor, error) {
+	factors, err := s.factorRepo.FindByUser(userID)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to fetch 2FA methods")
+	}
+	return factors, nil
+}
+
+// AddFactor starts adding a factor and returns what the user needs to set
+// it up. Until ConfirmFactor succeeds the factor is not used for logins.
+func (s *factorService) AddFactor(userID int, factorType string) (interface{}, error) {
+	factor, err := s.factors.Get(factorType)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.NewServiceError("user not found")
+	}
+
+	userFactor, err := s.factorRepo.FindByType(userID, factorType)
+	if err == nil && userFactor.ConfirmedAt != nil {
+		return nil, errors.NewServiceError("this 2FA method is already set up. remove it before adding it again")
+	}
+
+	if err != nil {
+		err = s.factorRepo.Create(entities.UserFactor{UserID: userID, Type: factorType})
+		if err != nil {
+			return nil, errors.NewServiceError("failed to add 2FA method")
+		}
+
+		userFactor, err = s.factorRepo.FindByType(userID, factorType)
+		if err != nil {
+			return nil, errors.NewServiceError("failed to add 2FA method")
+		}
+	}
+
+	return factor.Enroll(user, userFactor)
+}
+
+// ConfirmFactor completes adding a factor with the user's first answer to
+// it. The first factor turns 2FA on, becomes the default and returns the
+// user's new recovery codes.
+func (s *factorService) ConfirmFactor(userID int, factorType string, response entities.FactorResponse) ([]string, error) {
+	factor, err := s.factors.Get(factorType)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.NewServiceError("user not found")
+	}
+
+	userFactor, err := s.factorRepo.FindByType(userID, factorType)
+	if err != nil || userFactor.ConfirmedAt != nil {
+		return nil, errors.NewServiceError("no pending enrollment for this 2FA method")
+	}
+
+	err = factor.Verify(user, userFactor, response)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.factorRepo.Confirm(userFactor.ID)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to confirm 2FA method")
+	}
+
+	if user.Is2FAEnabled {
+		return nil, nil
+	}
+
+	err = s.factorRepo.SetDefault(userID, userFactor.ID)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to set default 2FA method")
+	}
+
+	user.Is2FAEnabled = true
+	err = s.userRepo.UpdateTwoFASettings(user)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to update 2FA settings")
+	}
+
+	return s.recoveryCodes.Generate(userID)
+}
+
+// SetDefault selects the factor a login asks for when the client does not
+// choose one.
+func (s *factorService) SetDefault(userID, ID int) error {
+	userFactor, err := s.factorRepo.FindByID(userID, ID)
+	if err != nil {
+		return errors.NewServiceError("2FA method not found")
+	}
+
+	if userFactor.ConfirmedAt == nil {
+		return errors.NewServiceError("2FA method is not confirmed yet")
+	}
+
+	err = s.factorRepo.SetDefault(userID, ID)
+	if err != nil {
+		return errors.NewServiceError("failed to set default 2FA method")
+	}
+	return nil
+}
+
+// RemoveFactor removes a factor after the user answered one of their
+// factors, named by method, so that a stolen session alone cannot weaken
+// the account. Removing the default makes another factor the default, and
+// removing the last one turns 2FA off and removes the recovery codes.
+func (s *factorService) RemoveFactor(userID, ID int, method string, response entities.FactorResponse) error {
+	userFactor, err := s.factorRepo.FindByID(userID, ID)
+	if err != nil {
+		return errors.NewServiceError("2FA method not found")
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.NewServiceError("user not found")
+	}
+
+	if user.Is2FAEnabled {
+		_, err = s.Verify(userID, method, response)
+		if err != nil {
+			return err
+		}
+	}
+
+	deleted, err := s.factorRepo.Delete(userID, ID)
+	if err != nil || !deleted {
+		return errors.NewServiceError("failed to remove 2FA method")
+	}
+
+	// The factor's own data, such as a TOTP secret, goes only once the row is
+	// gone, so a failure never leaves a factor the user cannot answer. Data
+	// that fails to go is no longer used by any factor.
+	factor, err := s.factors.Get(userFactor.Type)
+	if err == nil {
+		err = factor.Remove(user, userFactor)
+		if err != nil {
+			utils.GetLogger().WithError(err).Errorf("Failed to remove the %s data of user %d", userFactor.Type, userID)
+		}
+	}
+
+	remaining, err := s.confirmedFactors(userID)
+	if err != nil {
+		return err
+	}
+
+	if len(remaining) > 0 {
+		if userFactor.IsDefault {
+			return s.SetDefault(userID, remaining[0].ID)
+		}
+		return nil
+	}
+
+	if !user.Is2FAEnabled {
+		return nil
+	}
+
+	user.Is2FAEnabled = false
+	err = s.userRepo.UpdateTwoFASettings(user)
+	if err != nil {
+		return errors.NewServiceError("failed to update 2FA settings")
+	}
+
+	return s.recoveryCodes.Remove(userID)
+}
+
+// DefaultType returns the type of the factor a login asks for by default.
+func (s *factorService) DefaultType(userID int) (string, error) {
+	factors, err := s.confirmedFactors(userID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(factors) == 0 {
+		return "", errors.NewServiceError("2FA is not set up for this account")
+	}
+
+	for _, factor := range factors {
+		if factor.IsDefault {
+			return factor.Type, nil
+		}
+	}
+	return factors[0].Type, nil
+}
+
+// Challenge prepares the user's factor of the given type to be answered and
+// returns what the client needs for that, if anything.
+func (s *factorService) Challenge(userID int, factorType string) (interface{}, error) {
+	factor, user, userFactor, err := s.confirmedFactor(userID, factorType)
+	if err != nil {
+		return nil, err
+	}
+
+	return factor.Challenge(user, userFactor)
+}
+
+// Verify checks the user's answer to their factor of the given type and
+// returns the amr value it adds to a session. A recovery code is accepted
+// in place of any factor.
+func (s *factorService) Verify(userID int, factorType string, response entities.FactorResponse) (string, error) {
+	if factorType == entities.TwoFAMethodRecovery {
+		err := s.recoveryCodes.Use(userID, response.Code)
+		if err != nil {
+			return "", err
+		}
+		return entities.AuthMethodOTP, nil
+	}
+
+	factor, user, userFactor, err := s.confirmedFactor(userID, factorType)
+	if err != nil {
+		return "", err
+	}
+
+	err = factor.Verify(user, userFactor, response)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.factorRepo.Touch(userFactor.ID, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to record 2FA method use")
+	}
+
+	return factor.AuthMethod(), nil
+}
+
+func (s *factorService) confirmedFactor(userID int, factorType string) (Factor, *entities.User, *entities.UserFactor, error) {
+	factor, err := s.factors.Get(factorType)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	userFactor, err := s.factorRepo.FindByType(userID, factorType)
+	if err != nil || userFactor.ConfirmedAt == nil {
+		return nil, nil, nil, errors.NewServiceError("this 2FA method is not set up for this account")
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, nil, nil, errors.NewServiceError("user not found")
+	}
+
+	return factor, user, userFactor, nil
+}
+
+func (s *factorService) confirmedFactors(userID int) ([]entities.UserFactor, error) {
+	factors, err := s.factorRepo.FindByUser(userID)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to fetch 2FA methods")
+	}
+
+	confirmed := []entities.UserFactor{}
+	for _, factor := range factors {
+		if factor.ConfirmedAt != nil {
+			confirmed = append(confirmed, factor)
+		}
+	}
+	return confirmed, nil
+}
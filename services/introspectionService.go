@@ -0,0 +1,130 @@
+package services
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/repositories"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+const (
+	TokenTypeAccessToken  = "access_token"
+	TokenTypeRefreshToken = "refresh_token"
+)
+
+type IntrospectionService interface {
+	Introspect(token, tokenTypeHint string) *entities.Introspection
+}
+
+type introspectionService struct {
+	userRepo         repositories.UserRepository
+	sessionRepo      repositories.SessionRepository
+	refreshTokenRepo repositories.RefreshTokenRepository
+}
+
+func NewIntrospectionService(userRepo repositories.UserRepository, sessionRepo repositories.SessionRepository, refreshTokenRepo repositories.RefreshTokenRepository) IntrospectionService {
+	return &introspectionService{
+		userRepo:         userRepo,
+		sessionRepo:      sessionRepo,
+		refreshTokenRepo: refreshTokenRepo,
+	}
+}
+
+// Introspect reports whether token is currently usable. The hint only decides
+// which token type is tried first, as RFC 7662 requires falling back to the
+// other types when it does not match.
+func (s *introspectionService) Introspect(token, tokenTypeHint string) *entities.Introspection {
+	if tokenTypeHint == TokenTypeRefreshToken {
+		if result := s.introspectRefreshToken(token); result != nil {
+			return result
+		}
+		if result := s.introspectAccessToken(token); result != nil {
+			return result
+		}
+	} else {
+		if result := s.introspectAccessToken(token); result != nil {
+			return result
+		}
+		if result := s.introspectRefreshToken(token); result != nil {
+			return result
+		}
+	}
+
+	return &entities.Introspection{Active: false}
+}
+
+func (s *introspectionService) introspectAccessToken(token string) *entities.Introspection {
+	claims, err := utils.ParseToken(token)
+	if err != nil {
+		return nil
+	}
+
+	result := &entities.Introspection{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		TokenType: TokenTypeAccessToken,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		NotBefore: claims.NotBefore,
+		ID:        claims.ID,
+		AuthTime:  claims.AuthTime,
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return result
+	}
+
+	return s.checkUserSession(result, userID, claims.ID)
+}
+
+func (s *introspectionService) introspectRefreshToken(token string) *entities.Introspection {
+	stored, err := s.refreshTokenRepo.FindByHash(utils.HashToken(token))
+	if err != nil {
+		return nil
+	}
+
+	if stored.RevokedAt != nil || stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return &entities.Introspection{Active: false}
+	}
+
+	result := &entities.Introspection{
+		Active:    true,
+		TokenType: TokenTypeRefreshToken,
+		Subject:   strconv.Itoa(stored.UserID),
+		Issuer:    utils.GetJWTIssuer(),
+		ExpiresAt: stored.ExpiresAt.Unix(),
+		IssuedAt:  stored.CreatedAt.Unix(),
+	}
+
+	return s.checkUserSession(result, stored.UserID, stored.SessionID)
+}
+
+func (s *introspectionService) checkUserSession(result *entities.Introspection, userID int, sessionID string) *entities.Introspection {
+	session, err := s.sessionRepo.FindByID(sessionID)
+	if err != nil || session.UserID != userID {
+		return &entities.Introspection{Active: false}
+	}
+
+	switch {
+	case session.RevokedAt != nil:
+		return &entities.Introspection{Active: false, SessionStatus: entities.SessionStatusRevoked}
+	case !session.IsActive():
+		return &entities.Introspection{Active: false, SessionStatus: entities.SessionStatusExpired}
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || !user.Active {
+		return &entities.Introspection{Active: false}
+	}
+
+	result.AuthTime = session.AuthTime.Unix()
+	result.SessionStatus = entities.SessionStatusActive
+	return result
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/repositories"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type KeyService interface {
+	LoadKeys() error
+	RotateKeys() (*entities.SigningKey, error)
+	ListKeys() ([]entities.SigningKey, error)
+}
+
+type keyService struct {
+	signingKeyRepo repositories.SigningKeyRepository
+}
+
+func NewKeyService(repo repositories.SigningKeyRepository) KeyService {
+	return &keyService{signingKeyRepo: repo}
+}
+
+// LoadKeys installs every key that can still verify tokens into the keyring.
+// The newest key that is active and not yet retired becomes the signing key.
+func (s *keyService) LoadKeys() error {
+	stored, err := s.signingKeyRepo.FindUsable()
+	if err != nil {
+		return errors.NewServiceError("failed to load signing keys")
+	}
+
+	now := time.Now()
+	keys := []*utils.SigningKey{}
+	signingKeyID := ""
+	for _, record := range stored {
+		key, err := utils.DecodeSigningKey(record.Algorithm, record.KeyID, []byte(record.PrivateKey))
+		if err != nil {
+			utils.GetLogger().WithError(err).Errorf("Failed to decode signing key %s", record.KeyID)
+			continue
+		}
+
+		keys = append(keys, key)
+		signs := !record.ActivatesAt.After(now) && (record.RetiredAt == nil || record.RetiredAt.After(now))
+		if signingKeyID == "" && signs {
+			signingKeyID = record.KeyID
+		}
+	}
+
+	err = utils.InstallKeys(keys, signingKeyID)
+	if err != nil {
+		return errors.NewServiceError("failed to install signing keys")
+	}
+
+	return nil
+}
+
+// RotateKeys publishes a freshly generated key, which becomes the signing key
+// once the activation delay passed. Previous keys are retired at that moment
+// but keep verifying tokens until the longest token lifetime passed. HS256
+// secrets cannot be rotated, as services verifying tokens only know JWT_SECRET.
+func (s *keyService) RotateKeys() (*entities.SigningKey, error) {
+	alg := utils.GetJWTSigningAlgorithm()
+	if !utils.SupportsKeyRotation(alg) {
+		return nil, entities.ErrKeyRotationUnsupported
+	}
+
+	key, encoded, err := utils.GenerateSigningKey(alg)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to generate signing key")
+	}
+
+	now := time.Now()
+	record := entities.SigningKey{
+		KeyID:       key.KeyID,
+		Algorithm:   alg,
+		PrivateKey:  string(encoded),
+		CreatedAt:   now,
+		ActivatesAt: now.Add(utils.GetKeyActivationDelay()),
+	}
+
+	err = s.signingKeyRepo.Create(record)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to store signing key")
+	}
+
+	err = s.signingKeyRepo.RetireAllExcept(record.KeyID, record.ActivatesAt, record.ActivatesAt.Add(utils.GetMaxTokenLifetime()))
+	if err != nil {
+		return nil, errors.NewServiceError("failed to retire previous signing keys")
+	}
+
+	err = s.LoadKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	utils.GetLogger().Infof("Rotated JWT signing key, new key ID is %s and signs from %s", record.KeyID, record.ActivatesAt.Format(time.RFC3339))
+
+	return &record, nil
+}
+
+func (s *keyService) ListKeys() ([]entities.SigningKey, error) {
+	keys, err := s.signingKeyRepo.FindUsable()
+	if err != nil {
+		return nil, errors.NewServiceError("failed to fetch signing keys")
+	}
+	return keys, nil
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/repositories"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type LoginThrottleService interface {
+	Check(userID int, client entities.ClientInfo) error
+	RecordFailure(user *entities.User, client entities.ClientInfo)
+	RecordSuccess(userID int)
+	Unlock(token string, client entities.ClientInfo) error
+	AdminUnlock(userID int, client entities.ClientInfo) error
+	ListEvents(userID int) ([]entities.SecurityEvent, error)
+}
+
+const (
+	// loginDelayAfter is the number of failures after which every further
+	// attempt has to wait, twice as long as the one before.
+	loginDelayAfter = 3
+	loginDelayBase  = time.Second
+	loginDelayMax   = time.Minute
+
+	// securityEventListLimit is how many of a user's latest events are listed.
+	securityEventListLimit = 100
+)
+
+type loginThrottleService struct {
+	throttleRepo repositories.LoginThrottleRepository
+	eventRepo    repositories.SecurityEventRepository
+}
+
+func NewLoginThrottleService(throttleRepo repositories.LoginThrottleRepository, eventRepo repositories.SecurityEventRepository) LoginThrottleService {
+	return &loginThrottleService{
+		throttleRepo: throttleRepo,
+		eventRepo:    eventRepo,
+	}
+}
+
+// Check returns a LoginThrottledError while the client's IP address or the
+// account, when userID is not zero, is locked, or while the account has to
+// wait after its last failure. IP addresses are not delayed, as many users
+// can share one.
+func (s *loginThrottleService) Check(userID int, client entities.ClientInfo) error {
+	now := time.Now()
+
+	throttle, err := s.throttleRepo.Find(entities.LoginThrottleIP, client.IPAddress)
+	if err == nil && isLocked(throttle, now) {
+		return &entities.LoginThrottledError{RetryAfter: throttle.LockedUntil.Sub(now), Locked: true}
+	}
+
+	if userID == 0 {
+		return nil
+	}
+
+	throttle, err = s.throttleRepo.Find(entities.LoginThrottleUser, entities.UserSubject(userID))
+	if err == nil {
+		if err := checkThrottle(throttle, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkThrottle(throttle *entities.LoginThrottle, now time.Time) error {
+	if isLocked(throttle, now) {
+		return &entities.LoginThrottledError{RetryAfter: throttle.LockedUntil.Sub(now), Locked: true}
+	}
+
+	if now.Sub(throttle.LastFailureAt) > utils.GetLoginFailureWindow() {
+		return nil
+	}
+
+	retryAfter := throttle.LastFailureAt.Add(loginDelay(throttle.Failures)).Sub(now)
+	if retryAfter > 0 {
+		return &entities.LoginThrottledError{RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+// loginDelay is how long to wait after the given number of failures: nothing
+// for the first few, then one second, doubling up to a minute.
+func loginDelay(failures int) time.Duration {
+	if failures < loginDelayAfter {
+		return 0
+	}
+
+	delay := loginDelayBase
+	for i := loginDelayAfter; i < failures && delay < loginDelayMax; i++ {
+		delay *= 2
+	}
+	return min(delay, loginDelayMax)
+}
+
+// RecordFailure counts a failed login against the client's IP address and,
+// when the email address belonged to an account, against that account, and
+// locks whichever reached its threshold. user is nil for unknown addresses.
+func (s *loginThrottleService) RecordFailure(user *entities.User, client entities.ClientInfo) {
+	now := time.Now()
+	windowStart := now.Add(-utils.GetLoginFailureWindow())
+
+	event := entities.SecurityEvent{Type: entities.SecurityEventLoginFailed, IPAddress: client.IPAddress, UserAgent: client.UserAgent}
+	if user != nil {
+		event.UserID = &user.ID
+	} else {
+		event.Details = "unknown email address"
+	}
+	s.record(event)
+
+	ipThrottle, err := s.throttleRepo.RecordFailure(entities.LoginThrottleIP, client.IPAddress, windowStart)
+	if err == nil && ipThrottle.Failures >= utils.GetLoginIPLockoutThreshold() && !isLocked(ipThrottle, now) {
+		lockedUntil := now.Add(utils.GetLoginLockoutDuration())
+		if err := s.throttleRepo.Lock(ipThrottle.ID, lockedUntil, nil); err == nil {
+			s.record(entities.SecurityEvent{
+				Type:      entities.SecurityEventIPLocked,
+				IPAddress: client.IPAddress,
+				UserAgent: client.UserAgent,
+				Details:   "locked until " + lockedUntil.UTC().Format(time.RFC3339),
+			})
+		}
+	}
+
+	if user == nil {
+		return
+	}
+
+	userThrottle, err := s.throttleRepo.RecordFailure(entities.LoginThrottleUser, entities.UserSubject(user.ID), windowStart)
+	if err == nil && userThrottle.Failures >= utils.GetLoginLockoutThreshold() && !isLocked(userThrottle, now) {
+		s.lockAccount(user, userThrottle, client, now)
+	}
+}
+
+func isLocked(throttle *entities.LoginThrottle, now time.Time) bool {
+	return throttle.LockedUntil != nil && now.Before(*throttle.LockedUntil)
+}
+
+// lockAccount locks the account and emails its owner a link that lifts the
+// lock, in case the failures were not theirs.
+func (s *loginThrottleService) lockAccount(user *entities.User, throttle *entities.LoginThrottle, client entities.ClientInfo, now time.Time) {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to generate unlock token in service method lockAccount: ", err)
+		return
+	}
+
+	tokenHash := utils.HashToken(token)
+	lockedUntil := now.Add(utils.GetLoginLockoutDuration())
+
+	err = s.throttleRepo.Lock(throttle.ID, lockedUntil, &tokenHash)
+	if err != nil {
+		return
+	}
+
+	s.record(entities.SecurityEvent{
+		UserID:    &user.ID,
+		Type:      entities.SecurityEventAccountLocked,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+		Details:   "locked until " + lockedUntil.UTC().Format(time.RFC3339),
+	})
+
+	unlockURL := utils.GetAccountUnlockURL() + "?token=" + url.QueryEscape(token)
+	err = s.sendLockoutEmail(user.Email, unlockURL, lockedUntil)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to send lockout email in service method lockAccount: ", err)
+	}
+}
+
+// RecordSuccess forgets the account's failures. Those of the IP address
+// keep counting, so one valid account cannot be used to reset them.
+func (s *loginThrottleService) RecordSuccess(userID int) {
+	err := s.throttleRepo.Clear(entities.LoginThrottleUser, entities.UserSubject(userID))
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to clear login failures in service method RecordSuccess: ", err)
+	}
+}
+
+// Unlock lifts the lock the token was emailed for.
+func (s *loginThrottleService) Unlock(token string, client entities.ClientInfo) error {
+	throttle, err := s.throttleRepo.FindByUnlockToken(utils.HashToken(token))
+	if err != nil {
+		return errors.NewServiceError("invalid or already used unlock link")
+	}
+
+	err = s.throttleRepo.Clear(throttle.SubjectType, throttle.Subject)
+	if err != nil {
+		return errors.NewServiceError("failed to unlock account")
+	}
+
+	event := entities.SecurityEvent{Type: entities.SecurityEventAccountUnlocked, IPAddress: client.IPAddress, UserAgent: client.UserAgent, Details: "unlock link"}
+	if userID, err := strconv.Atoi(throttle.Subject); err == nil {
+		event.UserID = &userID
+	}
+	s.record(event)
+
+	return nil
+}
+
+func (s *loginThrottleService) AdminUnlock(userID int, client entities.ClientInfo) error {
+	err := s.throttleRepo.Clear(entities.LoginThrottleUser, entities.UserSubject(userID))
+	if err != nil {
+		return errors.NewServiceError("failed to unlock account")
+	}
+
+	s.record(entities.SecurityEvent{
+		UserID:    &userID,
+		Type:      entities.SecurityEventAccountUnlocked,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+		Details:   "admin",
+	})
+
+	return nil
+}
+
+func (s *loginThrottleService) ListEvents(userID int) ([]entities.SecurityEvent, error) {
+	events, err := s.eventRepo.FindByUser(userID, securityEventListLimit)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to list security events")
+	}
+	return events, nil
+}
+
+// record stores an event. Failing to do so is logged but does not fail the
+// login it describes.
+func (s *loginThrottleService) record(event entities.SecurityEvent) {
+	err := s.eventRepo.Create(event)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to record security event in service method record: ", err)
+	}
+}
@@ -0,0 +1,390 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/repositories"
+	"github.com/Renan-Parise/auth/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// authorizationCodeTTL bounds how long the client has to exchange a code.
+const authorizationCodeTTL = 5 * time.Minute
+
+// codeVerifierPattern is the code_verifier syntax from RFC 7636 section 4.1.
+// An S256 code_challenge is always 43 characters of the same alphabet.
+var (
+	codeVerifierPattern  = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+	codeChallengePattern = regexp.MustCompile(`^[A-Za-z0-9\-_]{43}$`)
+)
+
+type OAuthService interface {
+	AuthenticateClient(clientID, secret string) (*entities.OAuthClient, error)
+	ClientCredentialsGrant(clientID, secret, scope string) (*entities.OAuthTokenResponse, error)
+	ValidateAuthorizationRequest(request entities.AuthorizationRequest, responseType string) (*entities.AuthorizationRequest, error)
+	CreateAuthorizationCode(request *entities.AuthorizationRequest, session *entities.Session) (string, error)
+	AuthorizationCodeGrant(clientID, secret, code, redirectURI, codeVerifier string) (*entities.OAuthTokenResponse, error)
+	RefreshTokenGrant(clientID, secret, refreshToken string) (*entities.OAuthTokenResponse, error)
+	UserInfo(userID int, scope string) (*entities.UserInfo, error)
+	RegisterClient(client entities.OAuthClient) (*entities.OAuthClient, string, error)
+	ListClients() ([]entities.OAuthClient, error)
+}
+
+type oauthService struct {
+	clientRepo     repositories.OAuthClientRepository
+	codeRepo       repositories.AuthorizationCodeRepository
+	sessionRepo    repositories.SessionRepository
+	userRepo       repositories.UserRepository
+	tokenService   TokenService
+	sessionService SessionService
+}
+
+func NewOAuthService(clientRepo repositories.OAuthClientRepository, codeRepo repositories.AuthorizationCodeRepository, sessionRepo repositories.SessionRepository, userRepo repositories.UserRepository, tokens TokenService, sessions SessionService) OAuthService {
+	return &oauthService{
+		clientRepo:     clientRepo,
+		codeRepo:       codeRepo,
+		sessionRepo:    sessionRepo,
+		userRepo:       userRepo,
+		tokenService:   tokens,
+		sessionService: sessions,
+	}
+}
+
+func (s *oauthService) AuthenticateClient(clientID, secret string) (*entities.OAuthClient, error) {
+	client, err := s.clientRepo.FindByID(clientID)
+	if err != nil || !client.Active || client.SecretHash == "" {
+		return nil, errors.NewOAuthError("invalid_client", "client authentication failed")
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(secret))
+	if err != nil {
+		return nil, errors.NewOAuthError("invalid_client", "client authentication failed")
+	}
+
+	return client, nil
+}
+
+func (s *oauthService) authenticateGrantClient(clientID, secret string) (*entities.OAuthClient, error) {
+	client, err := s.clientRepo.FindByID(clientID)
+	if err != nil || !client.Active {
+		return nil, errors.NewOAuthError("invalid_client", "client authentication failed")
+	}
+
+	if client.Public {
+		if secret != "" {
+			return nil, errors.NewOAuthError("invalid_client", "client authentication failed")
+		}
+		return client, nil
+	}
+
+	return s.AuthenticateClient(clientID, secret)
+}
+
+func (s *oauthService) ClientCredentialsGrant(clientID, secret, scope string) (*entities.OAuthTokenResponse, error) {
+	client, err := s.AuthenticateClient(clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.AllowsGrantType(entities.GrantTypeClientCredentials) {
+		return nil, errors.NewOAuthError("unauthorized_client", "client is not allowed to use this grant type")
+	}
+
+	scopes, ok := client.GrantScopes(scope)
+	if !ok {
+		return nil, errors.NewOAuthError("invalid_scope", "requested scope is not allowed for this client")
+	}
+	grantedScope := strings.Join(scopes, " ")
+
+	accessToken, err := utils.GenerateClientToken(client.ClientID, client.Audiences, grantedScope)
+	if err != nil {
+		return nil, errors.NewOAuthError("server_error", "failed to generate access token")
+	}
+
+	return &entities.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(utils.GetClientTokenTTL().Seconds()),
+		Scope:       grantedScope,
+	}, nil
+}
+
+// ValidateAuthorizationRequest checks an /oauth/authorize request against
+// the client registration. When the client or redirect URI cannot be trusted
+// no request is returned and the error must be shown to the user; otherwise
+// the error can be sent back to the redirect URI of the returned request.
+func (s *oauthService) ValidateAuthorizationRequest(request entities.AuthorizationRequest, responseType string) (*entities.AuthorizationRequest, error) {
+	client, err := s.clientRepo.FindByID(request.ClientID)
+	if err != nil || !client.Active {
+		return nil, errors.NewOAuthError("invalid_client", "unknown client")
+	}
+
+	if !client.AllowsRedirectURI(request.RedirectURI) {
+		return nil, errors.NewOAuthError("invalid_request", "redirect_uri is not registered for this client")
+	}
+
+	request.ClientName = client.Name
+
+	if responseType != "code" {
+		return &request, errors.NewOAuthError("unsupported_response_type", "only the code response type is supported")
+	}
+
+	if !client.AllowsGrantType(entities.GrantTypeAuthorizationCode) {
+		return &request, errors.NewOAuthError("unauthorized_client", "client is not allowed to use this grant type")
+	}
+
+	if request.CodeChallengeMethod != entities.CodeChallengeMethodS256 || !codeChallengePattern.MatchString(request.CodeChallenge) {
+		return &request, errors.NewOAuthError("invalid_request", "a PKCE code_challenge with the S256 method is required")
+	}
+
+	scopes, ok := client.GrantScopes(request.Scope)
+	if !ok {
+		return &request, errors.NewOAuthError("invalid_scope", "requested scope is not allowed for this client")
+	}
+	request.Scope = strings.Join(scopes, " ")
+
+	return &request, nil
+}
+
+// CreateAuthorizationCode issues the code that hands the authenticated
+// session to the client. The request must come from
+// ValidateAuthorizationRequest.
+func (s *oauthService) CreateAuthorizationCode(request *entities.AuthorizationRequest, session *entities.Session) (string, error) {
+	code, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.codeRepo.Create(entities.AuthorizationCode{
+		CodeHash:            utils.HashToken(code),
+		ClientID:            request.ClientID,
+		UserID:              session.UserID,
+		SessionID:           session.ID,
+		RedirectURI:         request.RedirectURI,
+		Scope:               request.Scope,
+		CodeChallenge:       request.CodeChallenge,
+		CodeChallengeMethod: request.CodeChallengeMethod,
+		Nonce:               request.Nonce,
+		ExpiresAt:           time.Now().Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		return "", errors.NewServiceError("failed to store authorization code")
+	}
+
+	return code, nil
+}
+
+// AuthorizationCodeGrant exchanges a code for tokens, including an ID token
+// when the openid scope was granted. A code can be exchanged once; presenting
+// it again means it leaked, so the session it started is revoked together
+// with every token issued from it.
+func (s *oauthService) AuthorizationCodeGrant(clientID, secret, code, redirectURI, codeVerifier string) (*entities.OAuthTokenResponse, error) {
+	client, err := s.authenticateGrantClient(clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.AllowsGrantType(entities.GrantTypeAuthorizationCode) {
+		return nil, errors.NewOAuthError("unauthorized_client", "client is not allowed to use this grant type")
+	}
+
+	invalidGrant := errors.NewOAuthError("invalid_grant", "authorization code is invalid or expired")
+
+	stored, err := s.codeRepo.FindByHash(utils.HashToken(code))
+	if err != nil || stored.ClientID != client.ClientID || time.Now().After(stored.ExpiresAt) {
+		return nil, invalidGrant
+	}
+
+	if stored.UsedAt != nil {
+		return nil, s.revokeReusedCode(stored)
+	}
+
+	marked, err := s.codeRepo.MarkUsed(stored.CodeHash)
+	if err != nil {
+		return nil, errors.NewOAuthError("server_error", "failed to consume authorization code")
+	}
+	if !marked {
+		return nil, s.revokeReusedCode(stored)
+	}
+
+	if stored.RedirectURI != redirectURI || !verifyCodeChallenge(stored.CodeChallenge, codeVerifier) {
+		return nil, invalidGrant
+	}
+
+	session, err := s.sessionRepo.FindByID(stored.SessionID)
+	if err != nil || !session.IsActive() {
+		return nil, invalidGrant
+	}
+
+	tokens, err := s.tokenService.IssueSessionTokens(session, client.ClientID, stored.Scope)
+	if err != nil {
+		return nil, errors.NewOAuthError("server_error", "failed to issue tokens")
+	}
+
+	response := newOAuthTokenResponse(tokens)
+	if entities.HasScope(stored.Scope, entities.ScopeOpenID) {
+		response.IDToken, err = utils.GenerateIDToken(utils.Claims{
+			Subject:  strconv.Itoa(session.UserID),
+			Audience: utils.Audience{client.ClientID},
+			AuthTime: session.AuthTime.Unix(),
+			AMR:      session.AMR,
+			Nonce:    stored.Nonce,
+		})
+		if err != nil {
+			return nil, errors.NewOAuthError("server_error", "failed to generate ID token")
+		}
+	}
+
+	return response, nil
+}
+
+// RefreshTokenGrant rotates a refresh token issued to the client through the
+// authorization code grant.
+func (s *oauthService) RefreshTokenGrant(clientID, secret, refreshToken string) (*entities.OAuthTokenResponse, error) {
+	client, err := s.authenticateGrantClient(clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.AllowsGrantType(entities.GrantTypeRefreshToken) {
+		return nil, errors.NewOAuthError("unauthorized_client", "client is not allowed to use this grant type")
+	}
+
+	tokens, err := s.tokenService.Refresh(refreshToken, client.ClientID)
+	if err != nil {
+		if err == entities.ErrInvalidRefreshToken || err == entities.ErrRefreshTokenReused {
+			return nil, errors.NewOAuthError("invalid_grant", "refresh token is invalid or expired")
+		}
+		return nil, errors.NewOAuthError("server_error", "failed to refresh tokens")
+	}
+
+	return newOAuthTokenResponse(tokens), nil
+}
+
+// UserInfo returns the OpenID Connect claims of the user that the scope of
+// their access token allows.
+func (s *oauthService) UserInfo(userID int, scope string) (*entities.UserInfo, error) {
+	if !entities.HasScope(scope, entities.ScopeOpenID) {
+		return nil, errors.NewOAuthError("insufficient_scope", "the access token was not granted the openid scope")
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.NewOAuthError("invalid_token", "the user of the access token no longer exists")
+	}
+
+	info := &entities.UserInfo{Subject: strconv.Itoa(user.ID)}
+	if entities.HasScope(scope, entities.ScopeProfile) {
+		info.PreferredUsername = user.Username
+	}
+	if entities.HasScope(scope, entities.ScopeEmail) {
+		info.Email = user.Email
+		info.EmailVerified = &user.EmailVerified
+	}
+
+	return info, nil
+}
+
+func (s *oauthService) revokeReusedCode(code *entities.AuthorizationCode) error {
+	utils.GetLogger().Warnf("Authorization code reuse detected for user %d, revoking session %s", code.UserID, code.SessionID)
+
+	err := s.sessionService.Logout(code.SessionID)
+	if err != nil {
+		return errors.NewOAuthError("server_error", "failed to revoke session")
+	}
+
+	return errors.NewOAuthError("invalid_grant", "authorization code is invalid or expired")
+}
+
+// verifyCodeChallenge checks an S256 PKCE verifier against the challenge
+// stored with the code.
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if !codeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+func newOAuthTokenResponse(tokens *entities.Tokens) *entities.OAuthTokenResponse {
+	return &entities.OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    tokens.ExpiresIn,
+		RefreshToken: tokens.RefreshToken,
+		Scope:        tokens.Scope,
+	}
+}
+
+// RegisterClient stores a new client and returns it with its secret. Only
+// the bcrypt hash of the secret is kept, so it cannot be shown again. Public
+// clients get no secret and may only use the authorization code flow.
+func (s *oauthService) RegisterClient(client entities.OAuthClient) (*entities.OAuthClient, string, error) {
+	if strings.TrimSpace(client.Name) == "" {
+		return nil, "", errors.NewValidationError("name", "name is required. please provide a client name")
+	}
+
+	if client.Public && client.AllowsGrantType(entities.GrantTypeClientCredentials) {
+		return nil, "", errors.NewValidationError("grantTypes", "public clients cannot use the client credentials grant")
+	}
+
+	if client.AllowsGrantType(entities.GrantTypeAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		return nil, "", errors.NewValidationError("redirectUris", "redirect URIs are required for the authorization code grant")
+	}
+
+	for _, redirectURI := range client.RedirectURIs {
+		parsed, err := url.Parse(redirectURI)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			return nil, "", errors.NewValidationError("redirectUris", "redirect URIs must be absolute and must not contain a fragment")
+		}
+	}
+
+	clientID, err := utils.GenerateSecureToken(12)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var secret string
+	if !client.Public {
+		secret, err = utils.GenerateSecureToken(32)
+		if err != nil {
+			return nil, "", err
+		}
+
+		secretHash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, "", errors.NewServiceError("failed to hash client secret")
+		}
+		client.SecretHash = string(secretHash)
+	}
+
+	client.ClientID = clientID
+	client.Active = true
+	client.CreatedAt = time.Now()
+
+	err = s.clientRepo.Create(client)
+	if err != nil {
+		return nil, "", errors.NewServiceError("failed to register client")
+	}
+
+	return &client, secret, nil
+}
+
+func (s *oauthService) ListClients() ([]entities.OAuthClient, error) {
+	clients, err := s.clientRepo.FindAll()
+	if err != nil {
+		return nil, errors.NewServiceError("failed to fetch clients")
+	}
+	return clients, nil
+}
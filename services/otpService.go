@@ -0,0 +1,27 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+// sendOTP sends a code to a phone number. Voice calls get the code spaced
+// out, so it is read one character at a time.
+func sendOTP(sender utils.OTPSender, phoneNumber, channel, purpose, code string) error {
+	spoken := code
+	if channel == entities.OTPChannelVoice {
+		spoken = strings.Join(strings.Split(code, ""), " ")
+	}
+
+	message := entities.OTPMessage{
+		PhoneNumber: phoneNumber,
+		Channel:     channel,
+		Code:        code,
+		Body:        fmt.Sprintf("Your %s code is: %s", purpose, spoken),
+	}
+
+	return sender.Send(message)
+}
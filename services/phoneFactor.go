@@ -0,0 +1,82 @@
+package services
+
+import (
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+// phoneCodeTTL is how long a code sent by text message or voice call can be
+// used.
+const phoneCodeTTL = 5 * time.Minute
+
+type phoneFactor struct {
+	factorType string
+	channel    string
+	codes      VerificationCodeService
+	sender     utils.OTPSender
+}
+
+// NewSMSFactor returns the factor that texts a code to the user's verified
+// phone number.
+func NewSMSFactor(codes VerificationCodeService, sender utils.OTPSender) Factor {
+	return &phoneFactor{
+		factorType: entities.TwoFAMethodSMS,
+		channel:    entities.OTPChannelSMS,
+		codes:      codes,
+		sender:     sender,
+	}
+}
+
+// NewVoiceFactor returns the factor that calls the user's verified phone
+// number and reads a code out.
+func NewVoiceFactor(codes VerificationCodeService, sender utils.OTPSender) Factor {
+	return &phoneFactor{
+		factorType: entities.TwoFAMethodVoice,
+		channel:    entities.OTPChannelVoice,
+		codes:      codes,
+		sender:     sender,
+	}
+}
+
+func (f *phoneFactor) Type() string {
+	return f.factorType
+}
+
+func (f *phoneFactor) AuthMethod() string {
+	return entities.AuthMethodOTP
+}
+
+func (f *phoneFactor) Enroll(user *entities.User, factor *entities.UserFactor) (interface{}, error) {
+	return f.Challenge(user, factor)
+}
+
+// Challenge sends a new code, which replaces any code sent before.
+func (f *phoneFactor) Challenge(user *entities.User, factor *entities.UserFactor) (interface{}, error) {
+	if user.PhoneNumber == nil || !user.PhoneVerified {
+		return nil, errors.NewServiceError("verify a phone number first")
+	}
+
+	code, err := f.codes.Issue(user.ID, entities.VerificationPurposeFactor(f.factorType), f.channel, phoneCodeTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sendOTP(f.sender, *user.PhoneNumber, f.channel, "Two-Factor Authentication", code)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to send 2FA code")
+	}
+
+	return nil, nil
+}
+
+func (f *phoneFactor) Verify(user *entities.User, factor *entities.UserFactor, response entities.FactorResponse) error {
+	_, err := f.codes.Verify(user.ID, entities.VerificationPurposeFactor(f.factorType), response.Code)
+	return err
+}
+
+func (f *phoneFactor) Remove(user *entities.User, factor *entities.UserFactor) error {
+	return nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/repositories"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type PhoneService interface {
+	SetPhoneNumber(userID int, phoneNumber, channel string) error
+	VerifyPhoneNumber(userID int, code string) error
+	RemovePhoneNumber(userID int) error
+}
+
+// phoneVerificationTTL is how long the code that verifies a new phone number
+// can be used.
+const phoneVerificationTTL = 10 * time.Minute
+
+type phoneService struct {
+	userRepo   repositories.UserRepository
+	factorRepo repositories.UserFactorRepository
+	codes      VerificationCodeService
+	sender     utils.OTPSender
+}
+
+func NewPhoneService(userRepo repositories.UserRepository, factorRepo repositories.UserFactorRepository, codes VerificationCodeService, sender utils.OTPSender) PhoneService {
+	return &phoneService{
+		userRepo:   userRepo,
+		factorRepo: factorRepo,
+		codes:      codes,
+		sender:     sender,
+	}
+}
+
+// SetPhoneNumber stores a new, unverified phone number and sends a code to
+// it through channel, sms unless voice is asked for. Calling it again with the
+// same number sends a new code.
+func (s *phoneService) SetPhoneNumber(userID int, phoneNumber, channel string) error {
+	if channel == "" {
+		channel = entities.OTPChannelSMS
+	}
+
+	err := entities.ValidatePhoneNumber(phoneNumber)
+	if err != nil {
+		return err
+	}
+
+	err = entities.ValidateOTPChannel(channel)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkNoPhoneFactors(userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.userRepo.UpdatePhoneNumber(userID, &phoneNumber)
+	if err != nil {
+		return errors.NewServiceError("failed to update phone number")
+	}
+
+	code, err := s.codes.Issue(userID, entities.VerificationPurposePhone, channel, phoneVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	err = sendOTP(s.sender, phoneNumber, channel, "phone verification", code)
+	if err != nil {
+		return errors.NewServiceError("failed to send verification code")
+	}
+
+	return nil
+}
+
+func (s *phoneService) VerifyPhoneNumber(userID int, code string) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.NewServiceError("user not found")
+	}
+	if user.PhoneNumber == nil {
+		return errors.NewServiceError("no phone number to verify")
+	}
+
+	_, err = s.codes.Verify(userID, entities.VerificationPurposePhone, code)
+	if err != nil {
+		return err
+	}
+
+	err = s.userRepo.MarkPhoneVerified(userID)
+	if err != nil {
+		return errors.NewServiceError("failed to verify phone number")
+	}
+
+	return nil
+}
+
+func (s *phoneService) RemovePhoneNumber(userID int) error {
+	err := s.checkNoPhoneFactors(userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.userRepo.UpdatePhoneNumber(userID, nil)
+	if err != nil {
+		return errors.NewServiceError("failed to remove phone number")
+	}
+
+	return nil
+}
+
+func (s *phoneService) checkNoPhoneFactors(userID int) error {
+	factors, err := s.factorRepo.FindByUser(userID)
+	if err != nil {
+		return errors.NewServiceError("failed to load 2FA factors")
+	}
+
+	for _, factor := range factors {
+		if factor.Type == entities.TwoFAMethodSMS || factor.Type == entities.TwoFAMethodVoice {
+			return errors.NewServiceError("remove the sms and voice factors before changing the phone number")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/repositories"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+// recoveryCodeCount is how many codes a user receives at a time.
+const recoveryCodeCount = 10
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type RecoveryCodeService interface {
+	Generate(userID int) ([]string, error)
+	Use(userID int, code string) error
+	Remaining(userID int) (int, error)
+	Remove(userID int) error
+}
+
+type recoveryCodeService struct {
+	recoveryCodeRepo repositories.RecoveryCodeRepository
+}
+
+func NewRecoveryCodeService(recoveryCodeRepo repositories.RecoveryCodeRepository) RecoveryCodeService {
+	return &recoveryCodeService{recoveryCodeRepo: recoveryCodeRepo}
+}
+
+// Generate replaces the user's recovery codes with a new set and returns
+// them. Only their hashes are stored, so this is the only time they are seen.
+func (s *recoveryCodeService) Generate(userID int) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		buffer := make([]byte, 10)
+		if _, err := rand.Read(buffer); err != nil {
+			return nil, errors.NewServiceError("failed to generate recovery codes")
+		}
+
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(buffer))
+		codes[i] = code[:8] + "-" + code[8:]
+		hashes[i] = utils.HashToken(code)
+	}
+
+	err := s.recoveryCodeRepo.ReplaceAll(userID, hashes)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to store recovery codes")
+	}
+
+	return codes, nil
+}
+
+// Use consumes one recovery code. Dashes, spaces and case are ignored, so
+// codes can be typed the way they were written down.
+func (s *recoveryCodeService) Use(userID int, code string) error {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+
+	used, err := s.recoveryCodeRepo.MarkUsed(userID, utils.HashToken(normalized))
+	if err != nil {
+		return errors.NewServiceError("failed to verify recovery code")
+	}
+	if !used {
+		return errors.NewServiceError("invalid or already used recovery code")
+	}
+
+	return nil
+}
+
+func (s *recoveryCodeService) Remaining(userID int) (int, error) {
+	count, err := s.recoveryCodeRepo.CountUnused(userID)
+	if err != nil {
+		return 0, errors.NewServiceError("failed to count recovery codes")
+	}
+	return count, nil
+}
+
+func (s *recoveryCodeService) Remove(userID int) error {
+	err := s.recoveryCodeRepo.DeleteByUser(userID)
+	if err != nil {
+		return errors.NewServiceError("failed to remove recovery codes")
+	}
+	return nil
+}
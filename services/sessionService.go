@@ -0,0 +1,98 @@
+package services
+
+import (
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/repositories"
+)
+
+type SessionService interface {
+	ListSessions(userID int, currentSessionID string) ([]entities.Session, error)
+	RevokeSession(userID int, sessionID string) error
+	Logout(sessionID string) error
+	LogoutAll(userID int) error
+	LogoutOthers(userID int, currentSessionID string) error
+}
+
+type sessionService struct {
+	sessionRepo      repositories.SessionRepository
+	refreshTokenRepo repositories.RefreshTokenRepository
+}
+
+func NewSessionService(sessionRepo repositories.SessionRepository, refreshTokenRepo repositories.RefreshTokenRepository) SessionService {
+	return &sessionService{
+		sessionRepo:      sessionRepo,
+		refreshTokenRepo: refreshTokenRepo,
+	}
+}
+
+func (s *sessionService) ListSessions(userID int, currentSessionID string) ([]entities.Session, error) {
+	sessions, err := s.sessionRepo.FindActiveByUser(userID)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to fetch sessions")
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+
+	return sessions, nil
+}
+
+func (s *sessionService) RevokeSession(userID int, sessionID string) error {
+	session, err := s.sessionRepo.FindByID(sessionID)
+	if err != nil || session.UserID != userID {
+		return errors.NewServiceError("session not found")
+	}
+
+	return s.Logout(sessionID)
+}
+
+func (s *sessionService) Logout(sessionID string) error {
+	err := s.sessionRepo.Revoke(sessionID)
+	if err != nil {
+		return errors.NewServiceError("failed to revoke session")
+	}
+
+	err = s.refreshTokenRepo.RevokeBySession(sessionID)
+	if err != nil {
+		return errors.NewServiceError("failed to revoke refresh tokens")
+	}
+
+	return nil
+}
+
+func (s *sessionService) LogoutAll(userID int) error {
+	err := s.sessionRepo.RevokeAllByUser(userID)
+	if err != nil {
+		return errors.NewServiceError("failed to revoke sessions")
+	}
+
+	err = s.refreshTokenRepo.RevokeByUser(userID)
+	if err != nil {
+		return errors.NewServiceError("failed to revoke refresh tokens")
+	}
+
+	return nil
+}
+
+// LogoutOthers revokes every session of the user but the current one.
+func (s *sessionService) LogoutOthers(userID int, currentSessionID string) error {
+	sessions, err := s.sessionRepo.FindActiveByUser(userID)
+	if err != nil {
+		return errors.NewServiceError("failed to fetch sessions")
+	}
+
+	for _, session := range sessions {
+		if session.ID == currentSessionID {
+			continue
+		}
+
+		err = s.Logout(session.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
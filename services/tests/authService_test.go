@@ -1,11 +1,36 @@
 package services
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/Renan-Parise/auth/controllers"
 	"github.com/Renan-Parise/auth/entities"
 	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/middlewares"
 	"github.com/Renan-Parise/auth/services"
+	"github.com/Renan-Parise/auth/templates"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/golang-jwt/jwt"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -13,32 +38,78 @@ type mockUserRepository struct {
 	users map[string]entities.User
 }
 
-func (m *mockUserRepository) UpdatePasswordRecoveryCode(user *entities.User) error {
-	panic("unimplemented")
-}
-
 func (m *mockUserRepository) UpdatePassword(user *entities.User) error {
-	panic("unimplemented")
+	stored := m.users[user.Email]
+	stored.Password = user.Password
+	m.users[user.Email] = stored
+	return nil
 }
 
 func (m *mockUserRepository) FindByID(id int) (*entities.User, error) {
-	panic("unimplemented")
+	for _, user := range m.users {
+		if user.ID == id {
+			return &user, nil
+		}
+	}
+	return nil, errors.NewQueryError("user not found")
 }
 
-func (m *mockUserRepository) DeactivateUser(ID int) error {
-	panic("unimplemented")
+func (m *mockUserRepository) MarkEmailVerified(ID int) error {
+	for email, user := range m.users {
+		if user.ID == ID {
+			user.EmailVerified = true
+			m.users[email] = user
+		}
+	}
+	return nil
 }
 
-func (m *mockUserRepository) DeleteInactiveUsers() error {
+func (m *mockUserRepository) UpdateEmail(ID int, email string) error {
+	for oldEmail, user := range m.users {
+		if user.ID == ID {
+			delete(m.users, oldEmail)
+			user.Email = email
+			user.EmailVerified = false
+			m.users[email] = user
+		}
+	}
+	return nil
+}
+
+func (m *mockUserRepository) UpdatePhoneNumber(ID int, phoneNumber *string) error {
+	for email, user := range m.users {
+		if user.ID == ID {
+			user.PhoneNumber = phoneNumber
+			user.PhoneVerified = false
+			m.users[email] = user
+		}
+	}
+	return nil
+}
+
+func (m *mockUserRepository) MarkPhoneVerified(ID int) error {
+	for email, user := range m.users {
+		if user.ID == ID && user.PhoneNumber != nil {
+			user.PhoneVerified = true
+			m.users[email] = user
+		}
+	}
+	return nil
+}
+
+func (m *mockUserRepository) DeactivateUser(ID int) error {
 	panic("unimplemented")
 }
 
-func (m *mockUserRepository) UpdateTwoFACode(user *entities.User) error {
+func (m *mockUserRepository) DeleteInactiveUsers() error {
 	panic("unimplemented")
 }
 
 func (m *mockUserRepository) UpdateTwoFASettings(user *entities.User) error {
-	panic("unimplemented")
+	stored := m.users[user.Email]
+	stored.Is2FAEnabled = user.Is2FAEnabled
+	m.users[user.Email] = stored
+	return nil
 }
 
 func (m *mockUserRepository) FindByEmail(email string) (*entities.User, error) {
@@ -50,80 +121,2797 @@ func (m *mockUserRepository) FindByEmail(email string) (*entities.User, error) {
 }
 
 func (m *mockUserRepository) Create(user entities.User) error {
-	if _, exists := m.users[user.Username]; exists {
+	if _, exists := m.users[user.Email]; exists {
 		return errors.NewQueryError("user already exists")
 	}
-	m.users[user.Username] = user
+	user.ID = len(m.users) + 1
+	user.Active = true
+	m.users[user.Email] = user
 	return nil
 }
 
 func (m *mockUserRepository) Update(ID int, user entities.User) error {
-	if _, exists := m.users[user.Username]; !exists {
-		return errors.NewQueryError("user not found")
+	for email, stored := range m.users {
+		if stored.ID == ID {
+			stored.Username = user.Username
+			m.users[email] = stored
+			return nil
+		}
+	}
+	return errors.NewQueryError("user not found")
+}
+
+type mockRefreshTokenRepository struct {
+	tokens []entities.RefreshToken
+}
+
+func (m *mockRefreshTokenRepository) Create(token entities.RefreshToken) error {
+	token.ID = len(m.tokens) + 1
+	token.CreatedAt = time.Now()
+	m.tokens = append(m.tokens, token)
+	return nil
+}
+
+func (m *mockRefreshTokenRepository) FindByHash(hash string) (*entities.RefreshToken, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == hash {
+			return &token, nil
+		}
+	}
+	return nil, errors.NewQueryError("refresh token not found")
+}
+
+func (m *mockRefreshTokenRepository) MarkUsed(ID int) (bool, error) {
+	token := &m.tokens[ID-1]
+	if token.UsedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.UsedAt = &now
+	return true, nil
+}
+
+func (m *mockRefreshTokenRepository) RevokeFamily(familyID string) error {
+	now := time.Now()
+	for i := range m.tokens {
+		if m.tokens[i].FamilyID == familyID {
+			m.tokens[i].RevokedAt = &now
+		}
 	}
-	m.users[user.Username] = user
 	return nil
 }
 
-func TestRegister(t *testing.T) {
-	repo := &mockUserRepository{users: make(map[string]entities.User)}
-	service := services.NewAuthService(repo, nil)
+func (m *mockRefreshTokenRepository) RevokeBySession(sessionID string) error {
+	now := time.Now()
+	for i := range m.tokens {
+		if m.tokens[i].SessionID == sessionID {
+			m.tokens[i].RevokedAt = &now
+		}
+	}
+	return nil
+}
 
-	user := entities.User{
-		Username: "testuser",
-		Password: "password123",
-		Email:    "testuser@example.com",
+func (m *mockRefreshTokenRepository) RevokeByUser(userID int) error {
+	now := time.Now()
+	for i := range m.tokens {
+		if m.tokens[i].UserID == userID {
+			m.tokens[i].RevokedAt = &now
+		}
 	}
+	return nil
+}
 
-	err := service.Register(user)
-	assert.Nil(t, err)
+func (m *mockRefreshTokenRepository) DeleteExpired() error {
+	panic("unimplemented")
+}
 
-	err = service.Register(user)
-	assert.NotNil(t, err)
+type mockSessionRepository struct {
+	sessions map[string]entities.Session
 }
 
-func TestLogin(t *testing.T) {
-	repo := &mockUserRepository{users: make(map[string]entities.User)}
-	service := services.NewAuthService(repo, nil)
+func (m *mockSessionRepository) Create(session entities.Session) error {
+	m.sessions[session.ID] = session
+	return nil
+}
 
-	user := entities.User{
-		Username: "testuser",
-		Password: "password123",
+func (m *mockSessionRepository) FindByID(ID string) (*entities.Session, error) {
+	session, exists := m.sessions[ID]
+	if !exists {
+		return nil, errors.NewQueryError("session not found")
 	}
+	return &session, nil
+}
 
-	err := service.Register(user)
-	assert.Nil(t, err)
+func (m *mockSessionRepository) FindActiveByUser(userID int) ([]entities.Session, error) {
+	sessions := []entities.Session{}
+	for _, session := range m.sessions {
+		if session.UserID == userID && session.IsActive() {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
 
-	token, err := service.Login("testuser", "password123")
-	assert.Nil(t, err)
-	assert.NotEmpty(t, token)
+func (m *mockSessionRepository) Touch(ID string, lastSeenAt time.Time) error {
+	session := m.sessions[ID]
+	session.LastSeenAt = lastSeenAt
+	m.sessions[ID] = session
+	return nil
+}
 
-	_, err = service.Login("testuser", "wrongpassword")
-	assert.NotNil(t, err)
+func (m *mockSessionRepository) Reauthenticate(ID string, authTime time.Time, amr []string) error {
+	session := m.sessions[ID]
+	session.AuthTime = authTime
+	session.AMR = amr
+	m.sessions[ID] = session
+	return nil
 }
 
-func TestUpdate(t *testing.T) {
-	repo := &mockUserRepository{users: make(map[string]entities.User)}
-	service := services.NewAuthService(repo, nil)
+func (m *mockSessionRepository) Extend(ID string, expiresAt time.Time) error {
+	session := m.sessions[ID]
+	session.ExpiresAt = expiresAt
+	m.sessions[ID] = session
+	return nil
+}
 
-	user := entities.User{
-		Username: "testuser",
-		Password: "password123",
+func (m *mockSessionRepository) Revoke(ID string) error {
+	session := m.sessions[ID]
+	now := time.Now()
+	session.RevokedAt = &now
+	m.sessions[ID] = session
+	return nil
+}
+
+func (m *mockSessionRepository) RevokeAllByUser(userID int) error {
+	for ID, session := range m.sessions {
+		if session.UserID == userID {
+			now := time.Now()
+			session.RevokedAt = &now
+			m.sessions[ID] = session
+		}
 	}
+	return nil
+}
 
-	err := service.Register(user)
-	assert.Nil(t, err)
+func (m *mockSessionRepository) DeleteExpired() error {
+	panic("unimplemented")
+}
 
-	ID := 0
+type mockOAuthClientRepository struct {
+	clients map[string]entities.OAuthClient
+}
 
-	user.Password = "newpassword123"
-	err = service.Update(ID, user)
-	assert.Nil(t, err)
+func (m *mockOAuthClientRepository) FindByID(clientID string) (*entities.OAuthClient, error) {
+	client, exists := m.clients[clientID]
+	if !exists {
+		return nil, errors.NewQueryError("client not found")
+	}
+	return &client, nil
+}
 
-	_, err = service.Login("testuser", "password123")
-	assert.NotNil(t, err)
+func (m *mockOAuthClientRepository) FindAll() ([]entities.OAuthClient, error) {
+	clients := []entities.OAuthClient{}
+	for _, client := range m.clients {
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
 
-	token, err := service.Login("testuser", "newpassword123")
-	assert.Nil(t, err)
-	assert.NotEmpty(t, token)
+func (m *mockOAuthClientRepository) Create(client entities.OAuthClient) error {
+	client.Public = client.SecretHash == ""
+	m.clients[client.ClientID] = client
+	return nil
+}
+
+type mockAuthorizationCodeRepository struct {
+	codes map[string]entities.AuthorizationCode
+}
+
+func (m *mockAuthorizationCodeRepository) Create(code entities.AuthorizationCode) error {
+	code.CreatedAt = time.Now()
+	m.codes[code.CodeHash] = code
+	return nil
+}
+
+func (m *mockAuthorizationCodeRepository) FindByHash(hash string) (*entities.AuthorizationCode, error) {
+	code, exists := m.codes[hash]
+	if !exists {
+		return nil, errors.NewQueryError("authorization code not found")
+	}
+	return &code, nil
+}
+
+func (m *mockAuthorizationCodeRepository) MarkUsed(hash string) (bool, error) {
+	code := m.codes[hash]
+	if code.UsedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	code.UsedAt = &now
+	m.codes[hash] = code
+	return true, nil
+}
+
+func (m *mockAuthorizationCodeRepository) DeleteExpired() error {
+	panic("unimplemented")
+}
+
+type mockTOTPRepository struct {
+	enrollments map[int]entities.TOTP
+}
+
+func newMockTOTPRepository() *mockTOTPRepository {
+	return &mockTOTPRepository{enrollments: make(map[int]entities.TOTP)}
+}
+
+func (m *mockTOTPRepository) FindByUser(userID int) (*entities.TOTP, error) {
+	totp, exists := m.enrollments[userID]
+	if !exists {
+		return nil, errors.NewQueryError("TOTP enrollment not found")
+	}
+	return &totp, nil
+}
+
+func (m *mockTOTPRepository) Save(totp entities.TOTP) error {
+	m.enrollments[totp.UserID] = totp
+	return nil
+}
+
+func (m *mockTOTPRepository) Confirm(userID int, step int64) error {
+	totp := m.enrollments[userID]
+	now := time.Now()
+	totp.ConfirmedAt = &now
+	totp.LastUsedStep = &step
+	m.enrollments[userID] = totp
+	return nil
+}
+
+func (m *mockTOTPRepository) UseStep(userID int, step int64) (bool, error) {
+	totp := m.enrollments[userID]
+	if totp.LastUsedStep != nil && *totp.LastUsedStep >= step {
+		return false, nil
+	}
+	totp.LastUsedStep = &step
+	m.enrollments[userID] = totp
+	return true, nil
+}
+
+func (m *mockTOTPRepository) Delete(userID int) error {
+	delete(m.enrollments, userID)
+	return nil
+}
+
+type mockRecoveryCodeRepository struct {
+	codes map[int]map[string]bool
+}
+
+func (m *mockRecoveryCodeRepository) ReplaceAll(userID int, codeHashes []string) error {
+	m.codes[userID] = make(map[string]bool)
+	for _, codeHash := range codeHashes {
+		m.codes[userID][codeHash] = false
+	}
+	return nil
+}
+
+func (m *mockRecoveryCodeRepository) MarkUsed(userID int, codeHash string) (bool, error) {
+	used, exists := m.codes[userID][codeHash]
+	if !exists || used {
+		return false, nil
+	}
+	m.codes[userID][codeHash] = true
+	return true, nil
+}
+
+func (m *mockRecoveryCodeRepository) CountUnused(userID int) (int, error) {
+	count := 0
+	for _, used := range m.codes[userID] {
+		if !used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockRecoveryCodeRepository) DeleteByUser(userID int) error {
+	delete(m.codes, userID)
+	return nil
+}
+
+type mockWebAuthnCredentialRepository struct {
+	credentials []entities.WebAuthnCredential
+}
+
+func (m *mockWebAuthnCredentialRepository) Create(credential entities.WebAuthnCredential) error {
+	credential.ID = len(m.credentials) + 1
+	credential.CreatedAt = time.Now()
+	m.credentials = append(m.credentials, credential)
+	return nil
+}
+
+func (m *mockWebAuthnCredentialRepository) FindByUser(userID int) ([]entities.WebAuthnCredential, error) {
+	credentials := []entities.WebAuthnCredential{}
+	for _, credential := range m.credentials {
+		if credential.UserID == userID {
+			credentials = append(credentials, credential)
+		}
+	}
+	return credentials, nil
+}
+
+func (m *mockWebAuthnCredentialRepository) FindByCredentialID(credentialID []byte) (*entities.WebAuthnCredential, error) {
+	for _, credential := range m.credentials {
+		if bytes.Equal(credential.CredentialID, credentialID) {
+			return &credential, nil
+		}
+	}
+	return nil, errors.NewQueryError("WebAuthn credential not found")
+}
+
+func (m *mockWebAuthnCredentialRepository) UpdateSignCount(ID int, signCount uint32, backupState bool) (bool, error) {
+	credential := &m.credentials[ID-1]
+	if credential.SignCount >= signCount && (credential.SignCount != 0 || signCount != 0) {
+		return false, nil
+	}
+	now := time.Now()
+	credential.SignCount = signCount
+	credential.BackupState = backupState
+	credential.LastUsedAt = &now
+	return true, nil
+}
+
+func (m *mockWebAuthnCredentialRepository) Delete(userID, ID int) (bool, error) {
+	for i := range m.credentials {
+		if m.credentials[i].ID == ID && m.credentials[i].UserID == userID {
+			m.credentials[i].UserID = 0
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type mockWebAuthnCeremonyRepository struct {
+	ceremonies map[string]entities.WebAuthnCeremony
+}
+
+func (m *mockWebAuthnCeremonyRepository) Create(ceremony entities.WebAuthnCeremony) error {
+	m.ceremonies[ceremony.ID] = ceremony
+	return nil
+}
+
+func (m *mockWebAuthnCeremonyRepository) FindByID(ID string) (*entities.WebAuthnCeremony, error) {
+	ceremony, exists := m.ceremonies[ID]
+	if !exists {
+		return nil, errors.NewQueryError("WebAuthn ceremony not found")
+	}
+	return &ceremony, nil
+}
+
+func (m *mockWebAuthnCeremonyRepository) Delete(ID string) (bool, error) {
+	_, exists := m.ceremonies[ID]
+	delete(m.ceremonies, ID)
+	return exists, nil
+}
+
+func (m *mockWebAuthnCeremonyRepository) DeleteExpired() error {
+	panic("unimplemented")
+}
+
+type mockTwoFAChallengeRepository struct {
+	challenges map[string]entities.TwoFAChallenge
+}
+
+func newMockTwoFAChallengeRepository() *mockTwoFAChallengeRepository {
+	return &mockTwoFAChallengeRepository{challenges: make(map[string]entities.TwoFAChallenge)}
+}
+
+func (m *mockTwoFAChallengeRepository) Create(challenge entities.TwoFAChallenge) error {
+	challenge.CreatedAt = time.Now()
+	m.challenges[challenge.ID] = challenge
+	return nil
+}
+
+func (m *mockTwoFAChallengeRepository) FindByID(ID string) (*entities.TwoFAChallenge, error) {
+	challenge, exists := m.challenges[ID]
+	if !exists {
+		return nil, errors.NewQueryError("2FA challenge not found")
+	}
+	return &challenge, nil
+}
+
+func (m *mockTwoFAChallengeRepository) CountAttempt(ID string, maxAttempts int) (bool, error) {
+	challenge := m.challenges[ID]
+	if challenge.UsedAt != nil || challenge.Attempts >= maxAttempts {
+		return false, nil
+	}
+	challenge.Attempts++
+	m.challenges[ID] = challenge
+	return true, nil
+}
+
+func (m *mockTwoFAChallengeRepository) MarkUsed(ID string) (bool, error) {
+	challenge := m.challenges[ID]
+	if challenge.UsedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	challenge.UsedAt = &now
+	m.challenges[ID] = challenge
+	return true, nil
+}
+
+func (m *mockTwoFAChallengeRepository) DeleteExpired() error {
+	panic("unimplemented")
+}
+
+type mockTrustedDeviceRepository struct {
+	devices []entities.TrustedDevice
+}
+
+func (m *mockTrustedDeviceRepository) Create(device entities.TrustedDevice) error {
+	device.ID = len(m.devices) + 1
+	device.CreatedAt = time.Now()
+	m.devices = append(m.devices, device)
+	return nil
+}
+
+func (m *mockTrustedDeviceRepository) FindByHash(hash string) (*entities.TrustedDevice, error) {
+	for _, device := range m.devices {
+		if device.TokenHash == hash {
+			return &device, nil
+		}
+	}
+	return nil, errors.NewQueryError("trusted device not found")
+}
+
+func (m *mockTrustedDeviceRepository) FindActiveByUser(userID int) ([]entities.TrustedDevice, error) {
+	devices := []entities.TrustedDevice{}
+	for _, device := range m.devices {
+		if device.UserID == userID && time.Now().Before(device.ExpiresAt) {
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+func (m *mockTrustedDeviceRepository) Touch(ID int, lastUsedAt time.Time) error {
+	for i := range m.devices {
+		if m.devices[i].ID == ID {
+			m.devices[i].LastUsedAt = &lastUsedAt
+		}
+	}
+	return nil
+}
+
+func (m *mockTrustedDeviceRepository) Delete(userID, ID int) (bool, error) {
+	for i, device := range m.devices {
+		if device.ID == ID && device.UserID == userID {
+			m.devices = append(m.devices[:i], m.devices[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockTrustedDeviceRepository) DeleteByUser(userID int) error {
+	devices := []entities.TrustedDevice{}
+	for _, device := range m.devices {
+		if device.UserID != userID {
+			devices = append(devices, device)
+		}
+	}
+	m.devices = devices
+	return nil
+}
+
+func (m *mockTrustedDeviceRepository) DeleteExpired() error {
+	panic("unimplemented")
+}
+
+func newTestTrustedDeviceService() services.TrustedDeviceService {
+	return services.NewTrustedDeviceService(&mockTrustedDeviceRepository{})
+}
+
+type mockUserFactorRepository struct {
+	factors []entities.UserFactor
+}
+
+func (m *mockUserFactorRepository) Create(factor entities.UserFactor) error {
+	factor.ID = len(m.factors) + 1
+	factor.CreatedAt = time.Now()
+	m.factors = append(m.factors, factor)
+	return nil
+}
+
+func (m *mockUserFactorRepository) FindByUser(userID int) ([]entities.UserFactor, error) {
+	factors := []entities.UserFactor{}
+	for _, factor := range m.factors {
+		if factor.UserID == userID && factor.ID != 0 {
+			factors = append(factors, factor)
+		}
+	}
+	return factors, nil
+}
+
+func (m *mockUserFactorRepository) find(match func(entities.UserFactor) bool) (*entities.UserFactor, error) {
+	for _, factor := range m.factors {
+		if factor.ID != 0 && match(factor) {
+			return &factor, nil
+		}
+	}
+	return nil, errors.NewQueryError("user factor not found")
+}
+
+func (m *mockUserFactorRepository) FindByID(userID, ID int) (*entities.UserFactor, error) {
+	return m.find(func(factor entities.UserFactor) bool { return factor.UserID == userID && factor.ID == ID })
+}
+
+func (m *mockUserFactorRepository) FindByType(userID int, factorType string) (*entities.UserFactor, error) {
+	return m.find(func(factor entities.UserFactor) bool { return factor.UserID == userID && factor.Type == factorType })
+}
+
+func (m *mockUserFactorRepository) Confirm(ID int) error {
+	now := time.Now()
+	m.factors[ID-1].ConfirmedAt = &now
+	return nil
+}
+
+func (m *mockUserFactorRepository) SetDefault(userID, ID int) error {
+	for i := range m.factors {
+		if m.factors[i].UserID == userID {
+			m.factors[i].IsDefault = m.factors[i].ID == ID
+		}
+	}
+	return nil
+}
+
+func (m *mockUserFactorRepository) Touch(ID int, lastUsedAt time.Time) error {
+	m.factors[ID-1].LastUsedAt = &lastUsedAt
+	return nil
+}
+
+// Delete keeps a zeroed entry, so that the IDs of the other factors stay
+// their index plus one.
+func (m *mockUserFactorRepository) Delete(userID, ID int) (bool, error) {
+	if ID < 1 || ID > len(m.factors) || m.factors[ID-1].UserID != userID || m.factors[ID-1].ID == 0 {
+		return false, nil
+	}
+	m.factors[ID-1] = entities.UserFactor{}
+	return true, nil
+}
+
+type mockEmailChangeRepository struct {
+	changes []entities.EmailChange
+}
+
+func (m *mockEmailChangeRepository) Save(change entities.EmailChange) error {
+	for i, existing := range m.changes {
+		if existing.UserID == change.UserID {
+			change.ID = existing.ID
+			m.changes[i] = change
+			return nil
+		}
+	}
+	change.ID = len(m.changes) + 1
+	m.changes = append(m.changes, change)
+	return nil
+}
+
+func (m *mockEmailChangeRepository) find(match func(entities.EmailChange) bool) (*entities.EmailChange, error) {
+	for _, change := range m.changes {
+		if change.ID != 0 && match(change) && time.Now().Before(change.ExpiresAt) {
+			return &change, nil
+		}
+	}
+	return nil, errors.NewQueryError("email change not found")
+}
+
+func (m *mockEmailChangeRepository) FindActive(userID int) (*entities.EmailChange, error) {
+	return m.find(func(change entities.EmailChange) bool { return change.UserID == userID })
+}
+
+func (m *mockEmailChangeRepository) FindByCancelToken(tokenHash string) (*entities.EmailChange, error) {
+	return m.find(func(change entities.EmailChange) bool { return change.CancelTokenHash == tokenHash })
+}
+
+func (m *mockEmailChangeRepository) Delete(ID int) (bool, error) {
+	if ID < 1 || ID > len(m.changes) || m.changes[ID-1].ID == 0 {
+		return false, nil
+	}
+	m.changes[ID-1] = entities.EmailChange{}
+	return true, nil
+}
+
+func (m *mockEmailChangeRepository) DeleteExpired() error {
+	return nil
+}
+
+// startMailStandIn points MAIL_SERVICE_URL at a server that keeps the emails
+// it is sent, and returns a function that reads the last one sent to an
+// address.
+func startMailStandIn(t *testing.T) func(address string) entities.Email {
+	var mu sync.Mutex
+	emails := make(map[string]entities.Email)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var email entities.Email
+		if err := json.NewDecoder(r.Body).Decode(&email); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		emails[email.Address] = email
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("MAIL_SERVICE_URL", server.URL)
+
+	return func(address string) entities.Email {
+		mu.Lock()
+		defer mu.Unlock()
+		return emails[address]
+	}
+}
+
+type mockFinancesService struct {
+	created []int64
+	err     error
+}
+
+func (m *mockFinancesService) CreateDefaultCategories(userID int64) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.created = append(m.created, userID)
+	return nil
+}
+
+var testClient = entities.ClientInfo{UserAgent: "go-test", IPAddress: "127.0.0.1"}
+
+// softAuthenticator is a software passkey. It holds one ES256 credential,
+// uses "none" attestation and signs assertions with an increasing counter,
+// the way a browser and a security key answer WebAuthn options.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	credentialID := make([]byte, 32)
+	_, err = rand.Read(credentialID)
+	assert.Nil(t, err)
+
+	return &softAuthenticator{key: key, credentialID: credentialID}
+}
+
+func (a *softAuthenticator) create(t *testing.T, challenge *entities.WebAuthnChallenge) []byte {
+	var options struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			User      struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	}
+	a.readOptions(t, challenge, &options)
+
+	userHandle, err := base64.RawURLEncoding.DecodeString(options.PublicKey.User.ID)
+	assert.Nil(t, err)
+	a.userHandle = userHandle
+
+	publicKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,
+		3:  -7,
+		-1: 1,
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	assert.Nil(t, err)
+
+	attestedCredential := make([]byte, 16)
+	attestedCredential = binary.BigEndian.AppendUint16(attestedCredential, uint16(len(a.credentialID)))
+	attestedCredential = append(attestedCredential, a.credentialID...)
+	attestedCredential = append(attestedCredential, publicKey...)
+
+	a.signCount++
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(0x45, attestedCredential),
+	})
+	assert.Nil(t, err)
+
+	return a.response(t, map[string]string{
+		"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(a.clientData(t, "webauthn.create", options.PublicKey.Challenge)),
+	})
+}
+
+func (a *softAuthenticator) get(t *testing.T, challenge *entities.WebAuthnChallenge) []byte {
+	var options struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	}
+	a.readOptions(t, challenge, &options)
+
+	a.signCount++
+	authenticatorData := a.authenticatorData(0x05, nil)
+	clientData := a.clientData(t, "webauthn.get", options.PublicKey.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authenticatorData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	assert.Nil(t, err)
+
+	return a.response(t, map[string]string{
+		"authenticatorData": base64.RawURLEncoding.EncodeToString(authenticatorData),
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+		"signature":         base64.RawURLEncoding.EncodeToString(signature),
+		"userHandle":        base64.RawURLEncoding.EncodeToString(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) readOptions(t *testing.T, challenge *entities.WebAuthnChallenge, options interface{}) {
+	encoded, err := json.Marshal(challenge.Options)
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(encoded, options))
+}
+
+func (a *softAuthenticator) authenticatorData(flags byte, attestedCredential []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(utils.GetWebAuthnRPID()))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attestedCredential...)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremonyType, challenge string) []byte {
+	clientData, err := json.Marshal(map[string]string{
+		"type":      ceremonyType,
+		"challenge": challenge,
+		"origin":    utils.GetWebAuthnRPOrigins()[0],
+	})
+	assert.Nil(t, err)
+	return clientData
+}
+
+func (a *softAuthenticator) response(t *testing.T, response map[string]string) []byte {
+	credentialID := base64.RawURLEncoding.EncodeToString(a.credentialID)
+	encoded, err := json.Marshal(map[string]interface{}{
+		"id":       credentialID,
+		"rawId":    credentialID,
+		"type":     "public-key",
+		"response": response,
+	})
+	assert.Nil(t, err)
+	return encoded
+}
+
+// twoFAChallenge returns the challenge of a login that stopped to ask for
+// the second factor with method.
+func twoFAChallenge(t *testing.T, err error, method string) string {
+	required, ok := err.(*entities.TwoFARequiredError)
+	if !assert.True(t, ok) {
+		t.FailNow()
+	}
+	assert.Equal(t, method, required.Method)
+	return required.Challenge
+}
+
+type mockVerificationCodeRepository struct {
+	codes []entities.VerificationCode
+}
+
+func (m *mockVerificationCodeRepository) Save(code entities.VerificationCode) error {
+	for i := range m.codes {
+		if m.codes[i].UserID == code.UserID && m.codes[i].Purpose == code.Purpose {
+			code.ID = m.codes[i].ID
+			m.codes[i] = code
+			return nil
+		}
+	}
+	code.ID = len(m.codes) + 1
+	m.codes = append(m.codes, code)
+	return nil
+}
+
+func (m *mockVerificationCodeRepository) FindActive(userID int, purpose string) (*entities.VerificationCode, error) {
+	for _, code := range m.codes {
+		if code.UserID == userID && code.Purpose == purpose && code.CodeHash != "" && time.Now().Before(code.ExpiresAt) {
+			return &code, nil
+		}
+	}
+	return nil, errors.NewQueryError("verification code not found")
+}
+
+func (m *mockVerificationCodeRepository) CountAttempt(ID int, maxAttempts int) (bool, error) {
+	code := &m.codes[ID-1]
+	if code.Attempts >= maxAttempts {
+		return false, nil
+	}
+	code.Attempts++
+	return true, nil
+}
+
+func (m *mockVerificationCodeRepository) Consume(ID int, codeHash string) (bool, error) {
+	code := &m.codes[ID-1]
+	if code.CodeHash == "" || code.CodeHash != codeHash || time.Now().After(code.ExpiresAt) {
+		return false, nil
+	}
+	code.CodeHash = ""
+	return true, nil
+}
+
+func (m *mockVerificationCodeRepository) DeleteExpired() error {
+	return nil
+}
+
+func newTestVerificationCodeService() services.VerificationCodeService {
+	return services.NewVerificationCodeService(&mockVerificationCodeRepository{})
+}
+
+type mockLoginThrottleRepository struct {
+	throttles map[string]entities.LoginThrottle
+}
+
+func (m *mockLoginThrottleRepository) Find(subjectType, subject string) (*entities.LoginThrottle, error) {
+	throttle, exists := m.throttles[subjectType+":"+subject]
+	if !exists {
+		return nil, errors.NewQueryError("login throttle not found")
+	}
+	return &throttle, nil
+}
+
+func (m *mockLoginThrottleRepository) FindByUnlockToken(tokenHash string) (*entities.LoginThrottle, error) {
+	for _, throttle := range m.throttles {
+		if throttle.UnlockTokenHash != nil && *throttle.UnlockTokenHash == tokenHash {
+			return &throttle, nil
+		}
+	}
+	return nil, errors.NewQueryError("login throttle not found")
+}
+
+func (m *mockLoginThrottleRepository) RecordFailure(subjectType, subject string, windowStart time.Time) (*entities.LoginThrottle, error) {
+	key := subjectType + ":" + subject
+	throttle, exists := m.throttles[key]
+	if !exists {
+		throttle = entities.LoginThrottle{ID: len(m.throttles) + 1, SubjectType: subjectType, Subject: subject}
+	}
+	if throttle.LastFailureAt.Before(windowStart) {
+		throttle.Failures = 0
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = time.Now()
+	m.throttles[key] = throttle
+	return &throttle, nil
+}
+
+func (m *mockLoginThrottleRepository) Lock(ID int, lockedUntil time.Time, unlockTokenHash *string) error {
+	for key, throttle := range m.throttles {
+		if throttle.ID == ID {
+			throttle.LockedUntil = &lockedUntil
+			throttle.UnlockTokenHash = unlockTokenHash
+			m.throttles[key] = throttle
+		}
+	}
+	return nil
+}
+
+func (m *mockLoginThrottleRepository) Clear(subjectType, subject string) error {
+	delete(m.throttles, subjectType+":"+subject)
+	return nil
+}
+
+func (m *mockLoginThrottleRepository) DeleteExpired(windowStart time.Time) error {
+	return nil
+}
+
+// backdate moves every failure into the past, so tests do not have to wait
+// out the delays between attempts.
+func (m *mockLoginThrottleRepository) backdate(by time.Duration) {
+	for key, throttle := range m.throttles {
+		throttle.LastFailureAt = throttle.LastFailureAt.Add(-by)
+		m.throttles[key] = throttle
+	}
+}
+
+type mockSecurityEventRepository struct {
+	events []entities.SecurityEvent
+}
+
+func (m *mockSecurityEventRepository) Create(event entities.SecurityEvent) error {
+	event.ID = len(m.events) + 1
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *mockSecurityEventRepository) FindByUser(userID int, limit int) ([]entities.SecurityEvent, error) {
+	events := []entities.SecurityEvent{}
+	for i := len(m.events) - 1; i >= 0 && len(events) < limit; i-- {
+		if m.events[i].UserID != nil && *m.events[i].UserID == userID {
+			events = append(events, m.events[i])
+		}
+	}
+	return events, nil
+}
+
+func newTestLoginThrottleService() services.LoginThrottleService {
+	return services.NewLoginThrottleService(&mockLoginThrottleRepository{throttles: make(map[string]entities.LoginThrottle)}, &mockSecurityEventRepository{})
+}
+
+// testOTPSender keeps the codes sent to phone numbers so tests can enter them.
+var testOTPSender = utils.NewFakeOTPSender()
+
+type mockSigningKeyRepository struct {
+	keys []entities.SigningKey
+}
+
+func (m *mockSigningKeyRepository) Create(key entities.SigningKey) error {
+	m.keys = append([]entities.SigningKey{key}, m.keys...)
+	return nil
+}
+
+func (m *mockSigningKeyRepository) FindUsable() ([]entities.SigningKey, error) {
+	keys := []entities.SigningKey{}
+	for _, key := range m.keys {
+		if key.ExpiresAt == nil || key.ExpiresAt.After(time.Now()) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *mockSigningKeyRepository) RetireAllExcept(keyID string, retiredAt, expiresAt time.Time) error {
+	for i := range m.keys {
+		if m.keys[i].KeyID != keyID && m.keys[i].RetiredAt == nil {
+			m.keys[i].RetiredAt = &retiredAt
+			m.keys[i].ExpiresAt = &expiresAt
+		}
+	}
+	return nil
+}
+
+func (m *mockSigningKeyRepository) DeleteExpired() error {
+	panic("unimplemented")
+}
+
+func newTestTwoFAServices(repo *mockUserRepository, factorRepo *mockUserFactorRepository, webauthn services.WebAuthnService, emailVerification services.EmailVerificationService) (services.FactorService, services.RecoveryCodeService) {
+	recoveryCodes := services.NewRecoveryCodeService(&mockRecoveryCodeRepository{codes: make(map[int]map[string]bool)})
+	codes := newTestVerificationCodeService()
+	factors := services.NewFactorRegistry(
+		services.NewEmailFactor(codes, emailVerification),
+		services.NewTOTPFactor(services.NewTOTPService(newMockTOTPRepository(), repo)),
+		services.NewWebAuthnFactor(webauthn),
+		services.NewSMSFactor(codes, testOTPSender),
+		services.NewVoiceFactor(codes, testOTPSender),
+	)
+	return services.NewFactorService(factors, factorRepo, repo, recoveryCodes), recoveryCodes
+}
+
+func newTestWebAuthnService(repo *mockUserRepository, factorRepo *mockUserFactorRepository) services.WebAuthnService {
+	return services.NewWebAuthnService(
+		&mockWebAuthnCredentialRepository{},
+		&mockWebAuthnCeremonyRepository{ceremonies: make(map[string]entities.WebAuthnCeremony)},
+		repo,
+		factorRepo,
+	)
+}
+
+// testAuth is an AuthService wired to in-memory mocks, along with the
+// collaborators tests reach into to arrange state or check side effects.
+type testAuth struct {
+	service           services.AuthService
+	sessionRepo       *mockSessionRepository
+	refreshRepo       *mockRefreshTokenRepository
+	factorRepo        *mockUserFactorRepository
+	tokens            services.TokenService
+	sessions          services.SessionService
+	factors           services.FactorService
+	recoveryCodes     services.RecoveryCodeService
+	webauthn          services.WebAuthnService
+	trustedDevices    services.TrustedDeviceService
+	loginThrottle     services.LoginThrottleService
+	codes             services.VerificationCodeService
+	finances          *mockFinancesService
+	emailVerification services.EmailVerificationService
+}
+
+// newTestAuth builds the AuthService under test. Options run before the
+// service is constructed, so a test can swap in its own collaborators.
+func newTestAuth(repo *mockUserRepository, options ...func(*testAuth)) *testAuth {
+	auth := &testAuth{
+		sessionRepo:    &mockSessionRepository{sessions: make(map[string]entities.Session)},
+		refreshRepo:    &mockRefreshTokenRepository{},
+		factorRepo:     &mockUserFactorRepository{},
+		trustedDevices: newTestTrustedDeviceService(),
+		loginThrottle:  newTestLoginThrottleService(),
+		codes:          newTestVerificationCodeService(),
+		finances:       &mockFinancesService{},
+	}
+	auth.webauthn = newTestWebAuthnService(repo, auth.factorRepo)
+	auth.tokens = services.NewTokenService(repo, auth.sessionRepo, auth.refreshRepo)
+	auth.sessions = services.NewSessionService(auth.sessionRepo, auth.refreshRepo)
+	auth.emailVerification = services.NewEmailVerificationService(repo, auth.finances)
+	auth.factors, auth.recoveryCodes = newTestTwoFAServices(repo, auth.factorRepo, auth.webauthn, auth.emailVerification)
+	for _, option := range options {
+		option(auth)
+	}
+	auth.service = services.NewAuthService(repo, newMockTwoFAChallengeRepository(), auth.tokens, auth.sessions, auth.factors, auth.recoveryCodes, auth.webauthn, auth.trustedDevices, auth.loginThrottle, auth.codes, testOTPSender, auth.emailVerification)
+	return auth
+}
+
+func newTestAuthService(repo *mockUserRepository) services.AuthService {
+	return newTestAuth(repo).service
+}
+
+func TestRegister(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	service := newTestAuthService(repo)
+
+	user := entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	}
+
+	err := service.Register(user)
+	assert.Nil(t, err)
+
+	err = service.Register(user)
+	assert.NotNil(t, err)
+}
+
+func TestLogin(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	service := newTestAuthService(repo)
+
+	user := entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	}
+
+	err := service.Register(user)
+	assert.Nil(t, err)
+
+	tokens, err := service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+
+	_, err = service.Login("testuser@example.com", "wrongpassword", "", testClient)
+	assert.NotNil(t, err)
+}
+
+func TestAccessTokenClaims(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	service := newTestAuthService(repo)
+
+	user := entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	}
+
+	err := service.Register(user)
+	assert.Nil(t, err)
+
+	tokens, err := service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+
+	claims, err := utils.ValidateToken(tokens.AccessToken, utils.GetJWTAudience())
+	assert.Nil(t, err)
+	assert.Equal(t, utils.GetJWTIssuer(), claims.Issuer)
+	assert.Equal(t, "1", claims.Subject)
+	assert.NotEmpty(t, claims.ID)
+	assert.Equal(t, []string{entities.AuthMethodPassword}, claims.AMR)
+	assert.NotZero(t, claims.AuthTime)
+
+	_, err = utils.ValidateToken(tokens.AccessToken, "another-service")
+	assert.NotNil(t, err)
+}
+
+func TestUpdate(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	service := newTestAuthService(repo)
+
+	user := entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	}
+
+	err := service.Register(user)
+	assert.Nil(t, err)
+
+	ID := 1
+
+	user.Username = "renamed"
+	user.Password = "Velvet-Harbor-Lantern-82"
+	err = service.Update(ID, user)
+	assert.Nil(t, err)
+	assert.Equal(t, "renamed", repo.users["testuser@example.com"].Username)
+
+	user.Username = ""
+	err = service.Update(ID, user)
+	assert.NotNil(t, err)
+
+	_, err = service.Login("testuser@example.com", "Velvet-Harbor-Lantern-82", "", testClient)
+	assert.NotNil(t, err, "the password is not a profile field")
+
+	tokens, err := service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+}
+
+func TestChangePassword(t *testing.T) {
+	lastEmail := startMailStandIn(t)
+
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	auth := newTestAuth(repo)
+	service := auth.service
+
+	err := service.Register(entities.User{Username: "testuser", Password: "Plum-Orbit-Canyon-47", Email: "testuser@example.com"})
+	assert.Nil(t, err)
+
+	current, err := service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+	other, err := service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+
+	claims, err := utils.ValidateToken(current.AccessToken, utils.GetJWTAudience())
+	assert.Nil(t, err)
+
+	err = service.ChangePassword(1, claims.ID, "wrongpassword", "Velvet-Harbor-Lantern-82")
+	assert.NotNil(t, err)
+	err = service.ChangePassword(1, claims.ID, "Plum-Orbit-Canyon-47", "")
+	assert.NotNil(t, err)
+	err = service.ChangePassword(1, claims.ID, "Plum-Orbit-Canyon-47", "Plum-Orbit-Canyon-47")
+	assert.NotNil(t, err)
+
+	err = service.ChangePassword(1, claims.ID, "Plum-Orbit-Canyon-47", "Velvet-Harbor-Lantern-82")
+	assert.Nil(t, err)
+	assert.Equal(t, "Your Password Was Changed", lastEmail("testuser@example.com").Subject)
+
+	_, err = auth.tokens.Refresh(other.RefreshToken, "")
+	assert.NotNil(t, err, "other sessions are revoked")
+	_, err = auth.tokens.Refresh(current.RefreshToken, "")
+	assert.Nil(t, err, "the current session is kept")
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.NotNil(t, err)
+	_, err = service.Login("testuser@example.com", "Velvet-Harbor-Lantern-82", "", testClient)
+	assert.Nil(t, err)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	auth := newTestAuth(repo)
+	service := auth.service
+
+	user := entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	}
+
+	err := service.Register(user)
+	assert.Nil(t, err)
+
+	issued, err := service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+
+	rotated, err := auth.tokens.Refresh(issued.RefreshToken, "")
+	assert.Nil(t, err)
+	assert.NotEqual(t, issued.RefreshToken, rotated.RefreshToken)
+
+	_, err = auth.tokens.Refresh(issued.RefreshToken, "")
+	assert.Equal(t, entities.ErrRefreshTokenReused, err)
+
+	_, err = auth.tokens.Refresh(rotated.RefreshToken, "")
+	assert.Equal(t, entities.ErrInvalidRefreshToken, err)
+}
+
+func TestLogoutAllRevokesRefreshTokens(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	auth := newTestAuth(repo)
+	service := auth.service
+
+	user := entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	}
+
+	err := service.Register(user)
+	assert.Nil(t, err)
+
+	first, err := service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+	second, err := service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+
+	sessions, err := auth.sessions.ListSessions(1, "")
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 2)
+
+	err = auth.sessions.LogoutAll(1)
+	assert.Nil(t, err)
+
+	for _, session := range auth.sessionRepo.sessions {
+		assert.False(t, session.IsActive())
+	}
+
+	_, err = auth.tokens.Refresh(first.RefreshToken, "")
+	assert.NotNil(t, err)
+	_, err = auth.tokens.Refresh(second.RefreshToken, "")
+	assert.NotNil(t, err)
+}
+
+func TestSessionManagement(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	auth := newTestAuth(repo)
+	service := auth.service
+	introspectionService := services.NewIntrospectionService(repo, auth.sessionRepo, auth.refreshRepo)
+
+	assert.Nil(t, service.Register(entities.User{Username: "testuser", Password: "Plum-Orbit-Canyon-47", Email: "testuser@example.com"}))
+	assert.Nil(t, service.Register(entities.User{Username: "otheruser", Password: "Plum-Orbit-Canyon-47", Email: "otheruser@example.com"}))
+
+	sessionID := func(tokens *entities.Tokens) string {
+		claims, err := utils.ValidateToken(tokens.AccessToken, utils.GetJWTAudience())
+		assert.Nil(t, err)
+		return claims.ID
+	}
+
+	current, err := service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+	other, err := service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", entities.ClientInfo{UserAgent: "another-browser", IPAddress: "10.0.0.1"})
+	assert.Nil(t, err)
+	foreign, err := service.Login("otheruser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+
+	sessions, err := auth.sessions.ListSessions(1, sessionID(current))
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 2)
+	for _, session := range sessions {
+		assert.Equal(t, session.ID == sessionID(current), session.Current)
+		assert.Equal(t, 1, session.UserID)
+	}
+
+	err = auth.sessions.RevokeSession(1, sessionID(foreign))
+	assert.NotNil(t, err, "another user's session cannot be revoked")
+	assert.True(t, introspectionService.Introspect(foreign.AccessToken, "").Active)
+
+	err = auth.sessions.RevokeSession(1, sessionID(other))
+	assert.Nil(t, err)
+
+	result := introspectionService.Introspect(other.AccessToken, "")
+	assert.False(t, result.Active)
+	assert.Equal(t, entities.SessionStatusRevoked, result.SessionStatus)
+	_, err = auth.tokens.Refresh(other.RefreshToken, "")
+	assert.NotNil(t, err)
+
+	assert.True(t, introspectionService.Introspect(current.AccessToken, "").Active)
+	sessions, err = auth.sessions.ListSessions(1, sessionID(current))
+	assert.Nil(t, err)
+	if assert.Len(t, sessions, 1) {
+		assert.True(t, sessions[0].Current)
+	}
+}
+
+func TestIntrospectReflectsSessionRevocation(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	auth := newTestAuth(repo)
+	service := auth.service
+	introspectionService := services.NewIntrospectionService(repo, auth.sessionRepo, auth.refreshRepo)
+
+	user := entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	}
+
+	err := service.Register(user)
+	assert.Nil(t, err)
+
+	tokens, err := service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+
+	result := introspectionService.Introspect(tokens.AccessToken, "")
+	assert.True(t, result.Active)
+	assert.Equal(t, "1", result.Subject)
+	assert.Equal(t, entities.SessionStatusActive, result.SessionStatus)
+
+	result = introspectionService.Introspect(tokens.RefreshToken, services.TokenTypeRefreshToken)
+	assert.True(t, result.Active)
+	assert.Equal(t, services.TokenTypeRefreshToken, result.TokenType)
+
+	claims, err := utils.ValidateToken(tokens.AccessToken, utils.GetJWTAudience())
+	assert.Nil(t, err)
+
+	err = auth.sessions.Logout(claims.ID)
+	assert.Nil(t, err)
+
+	result = introspectionService.Introspect(tokens.AccessToken, "")
+	assert.False(t, result.Active)
+	assert.Equal(t, entities.SessionStatusRevoked, result.SessionStatus)
+
+	result = introspectionService.Introspect("not-a-token", "")
+	assert.False(t, result.Active)
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	auth := newTestAuth(repo)
+	service := auth.service
+	oauthService := services.NewOAuthService(
+		&mockOAuthClientRepository{clients: make(map[string]entities.OAuthClient)},
+		&mockAuthorizationCodeRepository{codes: make(map[string]entities.AuthorizationCode)},
+		auth.sessionRepo,
+		repo,
+		auth.tokens,
+		auth.sessions,
+	)
+
+	client, secret, err := oauthService.RegisterClient(entities.OAuthClient{
+		Name:         "web",
+		Public:       true,
+		Scopes:       []string{"openid", "profile", "email"},
+		GrantTypes:   []string{entities.GrantTypeAuthorizationCode, entities.GrantTypeRefreshToken},
+		RedirectURIs: []string{"https://app.example.com/callback"},
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, secret)
+
+	user := entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	}
+
+	err = service.Register(user)
+	assert.Nil(t, err)
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	authorization := entities.AuthorizationRequest{
+		ClientID:            client.ClientID,
+		RedirectURI:         "https://app.example.com/callback",
+		Scope:               "openid email",
+		State:               "xyz",
+		Nonce:               "n-0S6_WzA2Mj",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: entities.CodeChallengeMethodS256,
+	}
+
+	_, err = oauthService.ValidateAuthorizationRequest(entities.AuthorizationRequest{ClientID: client.ClientID, RedirectURI: "https://evil.example.com/callback"}, "code")
+	assert.NotNil(t, err)
+
+	request, err := oauthService.ValidateAuthorizationRequest(authorization, "code")
+	assert.Nil(t, err)
+	assert.Equal(t, "openid email", request.Scope)
+
+	session, err := service.LoginSession("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+
+	code, err := oauthService.CreateAuthorizationCode(request, session)
+	assert.Nil(t, err)
+
+	_, err = oauthService.AuthorizationCodeGrant(client.ClientID, "", "unknown-code", request.RedirectURI, verifier)
+	assert.NotNil(t, err)
+
+	tokens, err := oauthService.AuthorizationCodeGrant(client.ClientID, "", code, request.RedirectURI, verifier)
+	assert.Nil(t, err)
+	assert.Equal(t, "openid email", tokens.Scope)
+
+	claims, err := utils.ValidateToken(tokens.AccessToken, utils.GetJWTAudience())
+	assert.Nil(t, err)
+	assert.Equal(t, client.ClientID, claims.ClientID)
+
+	// The account routes stop client tokens before they look the session up.
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/auth/me", middlewares.AuthMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	recorder := httptest.NewRecorder()
+	httpRequest := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+	httpRequest.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	router.ServeHTTP(recorder, httpRequest)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	idClaims, err := utils.ValidateToken(tokens.IDToken, client.ClientID)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", idClaims.Subject)
+	assert.Equal(t, "n-0S6_WzA2Mj", idClaims.Nonce)
+	assert.Equal(t, []string{entities.AuthMethodPassword}, idClaims.AMR)
+	assert.Equal(t, session.AuthTime.Unix(), idClaims.AuthTime)
+
+	info, err := oauthService.UserInfo(1, claims.Scope)
+	assert.Nil(t, err)
+	assert.Equal(t, "testuser@example.com", info.Email)
+	assert.Empty(t, info.PreferredUsername)
+	assert.False(t, *info.EmailVerified)
+
+	refreshed, err := oauthService.RefreshTokenGrant(client.ClientID, "", tokens.RefreshToken)
+	assert.Nil(t, err)
+	assert.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+
+	_, err = oauthService.AuthorizationCodeGrant(client.ClientID, "", code, request.RedirectURI, verifier)
+	assert.NotNil(t, err)
+	revoked := auth.sessionRepo.sessions[session.ID]
+	assert.False(t, revoked.IsActive())
+}
+
+func TestTOTPLogin(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	auth := newTestAuth(repo)
+	service := auth.service
+
+	user := entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	}
+
+	err := service.Register(user)
+	assert.Nil(t, err)
+
+	added, err := auth.factors.AddFactor(1, entities.TwoFAMethodTOTP)
+	assert.Nil(t, err)
+	enrollment := added.(*entities.TOTPEnrollment)
+	assert.Contains(t, enrollment.ProvisioningURI, "otpauth://totp/")
+	assert.NotEmpty(t, enrollment.QRCode)
+
+	now := time.Now()
+	code, err := utils.TOTPCode(enrollment.Secret, utils.TOTPStep(now))
+	assert.Nil(t, err)
+
+	recoveryCodes, err := auth.factors.ConfirmFactor(1, entities.TwoFAMethodTOTP, entities.FactorResponse{Code: code})
+	assert.Nil(t, err)
+	assert.Len(t, recoveryCodes, 10)
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	challenge := twoFAChallenge(t, err, entities.TwoFAMethodTOTP)
+
+	_, err = service.VerifyTwoFACode(challenge, code, entities.TwoFAMethodTOTP, false, testClient)
+	assert.NotNil(t, err)
+
+	next, err := utils.TOTPCode(enrollment.Secret, utils.TOTPStep(now)+1)
+	assert.Nil(t, err)
+
+	_, err = service.VerifyTwoFACode(challenge, next, entities.TwoFAMethodTOTP, false, entities.ClientInfo{UserAgent: "another-browser", IPAddress: "10.0.0.1"})
+	assert.NotNil(t, err)
+
+	tokens, err := service.VerifyTwoFACode(challenge, next, entities.TwoFAMethodTOTP, false, testClient)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+
+	_, err = service.VerifyTwoFACode(challenge, next, entities.TwoFAMethodTOTP, false, testClient)
+	assert.NotNil(t, err)
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	challenge = twoFAChallenge(t, err, entities.TwoFAMethodTOTP)
+	_, err = service.VerifyTwoFACode(challenge, next, entities.TwoFAMethodTOTP, false, testClient)
+	if assert.NotNil(t, err, "a TOTP step cannot be replayed on a new challenge") {
+		assert.Contains(t, err.Error(), "already used")
+	}
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	challenge = twoFAChallenge(t, err, entities.TwoFAMethodTOTP)
+
+	for i := 0; i < entities.TwoFAChallengeMaxAttempts; i++ {
+		_, err = service.VerifyTwoFACode(challenge, "invalid", entities.TwoFAMethodTOTP, false, testClient)
+		assert.NotNil(t, err)
+	}
+
+	_, err = service.VerifyTwoFACode(challenge, recoveryCodes[0], entities.TwoFAMethodRecovery, false, testClient)
+	assert.NotNil(t, err)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	auth := newTestAuth(repo)
+	service := auth.service
+
+	user := entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	}
+
+	err := service.Register(user)
+	assert.Nil(t, err)
+
+	added, err := auth.factors.AddFactor(1, entities.TwoFAMethodTOTP)
+	assert.Nil(t, err)
+	enrollment := added.(*entities.TOTPEnrollment)
+	code, err := utils.TOTPCode(enrollment.Secret, utils.TOTPStep(time.Now()))
+	assert.Nil(t, err)
+	recoveryCodes, err := auth.factors.ConfirmFactor(1, entities.TwoFAMethodTOTP, entities.FactorResponse{Code: code})
+	assert.Nil(t, err)
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	challenge := twoFAChallenge(t, err, entities.TwoFAMethodTOTP)
+
+	tokens, err := service.VerifyTwoFACode(challenge, strings.ToUpper(recoveryCodes[0]), entities.TwoFAMethodRecovery, false, testClient)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+
+	remaining, err := auth.recoveryCodes.Remaining(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 9, remaining)
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	challenge = twoFAChallenge(t, err, entities.TwoFAMethodTOTP)
+
+	_, err = service.VerifyTwoFACode(challenge, recoveryCodes[0], entities.TwoFAMethodRecovery, false, testClient)
+	assert.NotNil(t, err)
+
+	_, err = service.RegenerateRecoveryCodes(1, entities.TwoFAMethodTOTP, entities.FactorResponse{Code: "invalid"})
+	assert.NotNil(t, err)
+
+	next, err := utils.TOTPCode(enrollment.Secret, utils.TOTPStep(time.Now())+1)
+	assert.Nil(t, err)
+	regenerated, err := service.RegenerateRecoveryCodes(1, entities.TwoFAMethodTOTP, entities.FactorResponse{Code: next})
+	assert.Nil(t, err)
+	assert.Len(t, regenerated, 10)
+
+	remaining, err = auth.recoveryCodes.Remaining(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, remaining)
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	auth := newTestAuth(repo)
+	service := auth.service
+
+	user := entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	}
+
+	err := service.Register(user)
+	assert.Nil(t, err)
+
+	authenticator := newSoftAuthenticator(t)
+
+	options, err := auth.webauthn.BeginRegistration(1)
+	assert.Nil(t, err)
+	response := authenticator.create(t, options)
+
+	credential, err := auth.webauthn.FinishRegistration(1, options.CeremonyID, "laptop", response)
+	assert.Nil(t, err)
+	assert.Equal(t, "laptop", credential.Name)
+
+	_, err = auth.webauthn.FinishRegistration(1, options.CeremonyID, "laptop", response)
+	assert.NotNil(t, err)
+
+	options, err = auth.webauthn.BeginLogin(0)
+	assert.Nil(t, err)
+	assertion := authenticator.get(t, options)
+
+	tokens, err := service.PasskeyLogin(options.CeremonyID, assertion, testClient)
+	assert.Nil(t, err)
+
+	claims, err := utils.ValidateToken(tokens.AccessToken, utils.GetJWTAudience())
+	assert.Nil(t, err)
+	assert.Equal(t, "1", claims.Subject)
+	assert.Equal(t, []string{entities.AuthMethodHardware, entities.AuthMethodMFA}, claims.AMR)
+
+	_, err = service.PasskeyLogin(options.CeremonyID, assertion, testClient)
+	assert.NotNil(t, err)
+
+	options, err = auth.webauthn.BeginLogin(0)
+	assert.Nil(t, err)
+	authenticator.signCount--
+	_, err = service.PasskeyLogin(options.CeremonyID, authenticator.get(t, options), testClient)
+	assert.NotNil(t, err)
+
+	securityKey := newSoftAuthenticator(t)
+
+	added, err := auth.factors.AddFactor(1, entities.TwoFAMethodWebAuthn)
+	assert.Nil(t, err)
+	options = added.(*entities.WebAuthnChallenge)
+
+	recoveryCodes, err := auth.factors.ConfirmFactor(1, entities.TwoFAMethodWebAuthn, entities.FactorResponse{
+		CeremonyID: options.CeremonyID,
+		Credential: securityKey.create(t, options),
+		Name:       "security key",
+	})
+	assert.Nil(t, err)
+	assert.Len(t, recoveryCodes, 10)
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	challenge := twoFAChallenge(t, err, entities.TwoFAMethodWebAuthn)
+
+	began, err := service.ChallengeTwoFA(challenge, entities.TwoFAMethodWebAuthn, testClient)
+	assert.Nil(t, err)
+	options = began.(*entities.WebAuthnChallenge)
+
+	tokens, err = service.VerifyPasskeyTwoFA(challenge, options.CeremonyID, securityKey.get(t, options), false, testClient)
+	assert.Nil(t, err)
+
+	claims, err = utils.ValidateToken(tokens.AccessToken, utils.GetJWTAudience())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{entities.AuthMethodPassword, entities.AuthMethodHardware, entities.AuthMethodMFA}, claims.AMR)
+
+	challenged, err := auth.factors.Challenge(1, entities.TwoFAMethodWebAuthn)
+	assert.Nil(t, err)
+	options = challenged.(*entities.WebAuthnChallenge)
+	regenerated, err := service.RegenerateRecoveryCodes(1, "", entities.FactorResponse{CeremonyID: options.CeremonyID, Credential: securityKey.get(t, options)})
+	assert.Nil(t, err, "passkey only users can replace their recovery codes")
+	assert.Len(t, regenerated, 10)
+}
+
+func TestClientCredentialsGrant(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	auth := newTestAuth(repo)
+	oauthService := services.NewOAuthService(
+		&mockOAuthClientRepository{clients: make(map[string]entities.OAuthClient)},
+		&mockAuthorizationCodeRepository{codes: make(map[string]entities.AuthorizationCode)},
+		auth.sessionRepo,
+		repo,
+		auth.tokens,
+		auth.sessions,
+	)
+
+	client, secret, err := oauthService.RegisterClient(entities.OAuthClient{
+		Name:       "reports",
+		Scopes:     []string{"finances:read"},
+		GrantTypes: []string{entities.GrantTypeClientCredentials},
+		Audiences:  []string{"finances", utils.GetJWTAudience()},
+	})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, secret)
+
+	oauthError := func(err error) string {
+		oauthErr, ok := err.(*errors.OAuthError)
+		if !assert.True(t, ok) {
+			return ""
+		}
+		return oauthErr.Code
+	}
+
+	_, err = oauthService.ClientCredentialsGrant(client.ClientID, "wrong-secret", "finances:read")
+	assert.Equal(t, "invalid_client", oauthError(err))
+
+	_, err = oauthService.ClientCredentialsGrant(client.ClientID, secret, "finances:write")
+	assert.Equal(t, "invalid_scope", oauthError(err))
+
+	response, err := oauthService.ClientCredentialsGrant(client.ClientID, secret, "finances:read")
+	assert.Nil(t, err)
+	assert.Equal(t, "finances:read", response.Scope)
+	assert.Equal(t, int64(utils.GetClientTokenTTL().Seconds()), response.ExpiresIn)
+
+	claims, err := utils.ValidateToken(response.AccessToken, "finances")
+	assert.Nil(t, err)
+	assert.Equal(t, client.ClientID, claims.Subject)
+	assert.Equal(t, client.ClientID, claims.ClientID)
+	assert.Equal(t, "finances:read", claims.Scope)
+	assert.Equal(t, int64(utils.GetClientTokenTTL().Seconds()), claims.ExpiresAt-claims.IssuedAt)
+	_, err = utils.ValidateToken(response.AccessToken, "reports")
+	assert.NotNil(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/auth/me", middlewares.AuthMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/oauth/userinfo", middlewares.ClientAuthMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	request := func(path string) int {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Header.Set("Authorization", "Bearer "+response.AccessToken)
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	assert.Equal(t, http.StatusForbidden, request("/auth/me"))
+	assert.Equal(t, http.StatusUnauthorized, request("/oauth/userinfo"), "a client acting on its own behalf has no user")
+}
+
+func TestAuthorizeTwoFAPage(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	auth := newTestAuth(repo)
+	oauthService := services.NewOAuthService(
+		&mockOAuthClientRepository{clients: make(map[string]entities.OAuthClient)},
+		&mockAuthorizationCodeRepository{codes: make(map[string]entities.AuthorizationCode)},
+		auth.sessionRepo,
+		repo,
+		auth.tokens,
+		auth.sessions,
+	)
+
+	client, _, err := oauthService.RegisterClient(entities.OAuthClient{
+		Name:         "web",
+		Public:       true,
+		Scopes:       []string{"openid"},
+		GrantTypes:   []string{entities.GrantTypeAuthorizationCode},
+		RedirectURIs: []string{"https://app.example.com/callback"},
+	})
+	assert.Nil(t, err)
+
+	err = auth.service.Register(entities.User{Username: "testuser", Password: "Plum-Orbit-Canyon-47", Email: "testuser@example.com"})
+	assert.Nil(t, err)
+
+	added, err := auth.factors.AddFactor(1, entities.TwoFAMethodTOTP)
+	assert.Nil(t, err)
+	code, err := utils.TOTPCode(added.(*entities.TOTPEnrollment).Secret, utils.TOTPStep(time.Now()))
+	assert.Nil(t, err)
+	_, err = auth.factors.ConfirmFactor(1, entities.TwoFAMethodTOTP, entities.FactorResponse{Code: code})
+	assert.Nil(t, err)
+
+	securityKey := newSoftAuthenticator(t)
+	added, err = auth.factors.AddFactor(1, entities.TwoFAMethodWebAuthn)
+	assert.Nil(t, err)
+	options := added.(*entities.WebAuthnChallenge)
+	_, err = auth.factors.ConfirmFactor(1, entities.TwoFAMethodWebAuthn, entities.FactorResponse{CeremonyID: options.CeremonyID, Credential: securityKey.create(t, options)})
+	assert.Nil(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.SetHTMLTemplate(templates.Load())
+	authorizeController := controllers.NewAuthorizeController(oauthService, auth.service)
+	router.POST("/oauth/authorize", authorizeController.Login)
+	router.POST("/oauth/authorize/2fa", authorizeController.ConfirmTwoFA)
+
+	sum := sha256.Sum256([]byte("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+	post := func(path string, fields url.Values) *httptest.ResponseRecorder {
+		fields.Set("client_id", client.ClientID)
+		fields.Set("redirect_uri", "https://app.example.com/callback")
+		fields.Set("response_type", "code")
+		fields.Set("scope", "openid")
+		fields.Set("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:]))
+		fields.Set("code_challenge_method", entities.CodeChallengeMethodS256)
+
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(fields.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("User-Agent", testClient.UserAgent)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	passkeyOptions := func(recorder *httptest.ResponseRecorder) *entities.WebAuthnChallenge {
+		assert.Contains(t, recorder.Header().Get("Content-Security-Policy"), "script-src 'nonce-")
+		body := recorder.Body.String()
+		start := strings.Index(body, `<script type="application/json" id="webauthn-options">`)
+		if !assert.NotEqual(t, -1, start) {
+			t.FailNow()
+		}
+		body = body[start+len(`<script type="application/json" id="webauthn-options">`):]
+		var challenge struct {
+			CeremonyID string          `json:"ceremonyId"`
+			Options    json.RawMessage `json:"options"`
+		}
+		assert.Nil(t, json.Unmarshal([]byte(body[:strings.Index(body, "</script>")]), &challenge))
+		var options interface{}
+		assert.Nil(t, json.Unmarshal(challenge.Options, &options))
+		return &entities.WebAuthnChallenge{CeremonyID: challenge.CeremonyID, Options: options}
+	}
+
+	recorder := post("/oauth/authorize", url.Values{"action": {"allow"}, "email": {"testuser@example.com"}, "password": {"Plum-Orbit-Canyon-47"}})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	body := recorder.Body.String()
+	assert.Contains(t, body, "authenticator app")
+	assert.Contains(t, body, `<option value="webauthn">Passkey</option>`)
+	assert.NotContains(t, recorder.Header().Get("Content-Security-Policy"), "script-src")
+	challenge := body[strings.Index(body, `name="challenge" value="`)+len(`name="challenge" value="`):]
+	challenge = challenge[:strings.Index(challenge, `"`)]
+	methods := []string{entities.TwoFAMethodTOTP, entities.TwoFAMethodWebAuthn}
+
+	recorder = post("/oauth/authorize/2fa", url.Values{"action": {"switch"}, "challenge": {challenge}, "methods": methods, "method": {entities.TwoFAMethodWebAuthn}})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "Confirm with your passkey")
+	options = passkeyOptions(recorder)
+
+	recorder = post("/oauth/authorize/2fa", url.Values{"challenge": {challenge}, "methods": methods, "method": {entities.TwoFAMethodWebAuthn}, "ceremony_id": {options.CeremonyID}, "credential": {"{}"}})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	options = passkeyOptions(recorder)
+
+	recorder = post("/oauth/authorize/2fa", url.Values{"challenge": {challenge}, "methods": methods, "method": {entities.TwoFAMethodWebAuthn}, "ceremony_id": {options.CeremonyID}, "credential": {string(securityKey.get(t, options))}})
+	assert.Equal(t, http.StatusFound, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Location"), "code=")
+}
+
+func TestTrustedDevices(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	auth := newTestAuth(repo)
+	service := auth.service
+
+	err := service.Register(entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	})
+	assert.Nil(t, err)
+
+	added, err := auth.factors.AddFactor(1, entities.TwoFAMethodTOTP)
+	assert.Nil(t, err)
+	enrollment := added.(*entities.TOTPEnrollment)
+	code, err := utils.TOTPCode(enrollment.Secret, utils.TOTPStep(time.Now()))
+	assert.Nil(t, err)
+	recoveryCodes, err := auth.factors.ConfirmFactor(1, entities.TwoFAMethodTOTP, entities.FactorResponse{Code: code})
+	assert.Nil(t, err)
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	challenge := twoFAChallenge(t, err, entities.TwoFAMethodTOTP)
+
+	tokens, err := service.VerifyTwoFACode(challenge, recoveryCodes[0], entities.TwoFAMethodRecovery, true, testClient)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tokens.DeviceToken)
+
+	trusted := testClient
+	trusted.DeviceToken = tokens.DeviceToken
+
+	tokens, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", trusted)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.Empty(t, tokens.DeviceToken)
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", entities.ClientInfo{UserAgent: "another-browser", IPAddress: "10.0.0.1", DeviceToken: trusted.DeviceToken})
+	twoFAChallenge(t, err, entities.TwoFAMethodTOTP)
+
+	devices, err := auth.trustedDevices.ListDevices(1, trusted)
+	assert.Nil(t, err)
+	assert.Len(t, devices, 1)
+	assert.True(t, devices[0].Current)
+	assert.NotNil(t, devices[0].LastUsedAt)
+
+	err = auth.trustedDevices.RevokeDevice(1, devices[0].ID)
+	assert.Nil(t, err)
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", trusted)
+	twoFAChallenge(t, err, entities.TwoFAMethodTOTP)
+}
+
+func TestFactorManagement(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	auth := newTestAuth(repo)
+	service := auth.service
+
+	err := service.Register(entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	})
+	assert.Nil(t, err)
+
+	added, err := auth.factors.AddFactor(1, entities.TwoFAMethodTOTP)
+	assert.Nil(t, err)
+	enrollment := added.(*entities.TOTPEnrollment)
+	now := time.Now()
+	code, err := utils.TOTPCode(enrollment.Secret, utils.TOTPStep(now))
+	assert.Nil(t, err)
+	recoveryCodes, err := auth.factors.ConfirmFactor(1, entities.TwoFAMethodTOTP, entities.FactorResponse{Code: code})
+	assert.Nil(t, err)
+	assert.Len(t, recoveryCodes, 10)
+
+	_, err = auth.factors.AddFactor(1, entities.TwoFAMethodTOTP)
+	assert.NotNil(t, err)
+
+	_, err = auth.factors.AddFactor(1, "carrier-pigeon")
+	assert.NotNil(t, err)
+
+	securityKey := newSoftAuthenticator(t)
+	added, err = auth.factors.AddFactor(1, entities.TwoFAMethodWebAuthn)
+	assert.Nil(t, err)
+	options := added.(*entities.WebAuthnChallenge)
+	codes, err := auth.factors.ConfirmFactor(1, entities.TwoFAMethodWebAuthn, entities.FactorResponse{CeremonyID: options.CeremonyID, Credential: securityKey.create(t, options)})
+	assert.Nil(t, err)
+	assert.Nil(t, codes)
+
+	factors, err := auth.factors.ListFactors(1)
+	assert.Nil(t, err)
+	assert.Len(t, factors, 2)
+	assert.True(t, factors[0].IsDefault)
+	assert.False(t, factors[1].IsDefault)
+
+	err = auth.factors.SetDefault(1, factors[1].ID)
+	assert.Nil(t, err)
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	required, ok := err.(*entities.TwoFARequiredError)
+	assert.True(t, ok)
+	assert.Equal(t, entities.TwoFAMethodWebAuthn, required.Method)
+	assert.NotNil(t, required.Options)
+
+	credentials, err := auth.webauthn.ListCredentials(1)
+	assert.Nil(t, err)
+	assert.Len(t, credentials, 1)
+	err = auth.webauthn.DeleteCredential(1, credentials[0].ID)
+	assert.Equal(t, entities.ErrLastPasskey, err)
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", entities.TwoFAMethodRecovery, testClient)
+	required, ok = err.(*entities.TwoFARequiredError)
+	if !assert.True(t, ok) {
+		t.FailNow()
+	}
+	assert.Equal(t, entities.TwoFAMethodRecovery, required.Method)
+	assert.Nil(t, required.Options, "recovery codes need no challenge")
+	_, err = service.VerifyTwoFACode(required.Challenge, recoveryCodes[1], entities.TwoFAMethodRecovery, false, testClient)
+	assert.Nil(t, err)
+
+	next, err := utils.TOTPCode(enrollment.Secret, utils.TOTPStep(now)+1)
+	assert.Nil(t, err)
+	err = auth.factors.RemoveFactor(1, factors[1].ID, entities.TwoFAMethodTOTP, entities.FactorResponse{Code: next})
+	assert.Nil(t, err)
+	err = auth.webauthn.DeleteCredential(1, credentials[0].ID)
+	assert.Nil(t, err)
+
+	factors, err = auth.factors.ListFactors(1)
+	assert.Nil(t, err)
+	assert.Len(t, factors, 1)
+	assert.True(t, factors[0].IsDefault)
+
+	err = auth.factors.RemoveFactor(1, factors[0].ID, entities.TwoFAMethodTOTP, entities.FactorResponse{Code: "invalid"})
+	assert.NotNil(t, err)
+
+	err = auth.factors.RemoveFactor(1, factors[0].ID, entities.TwoFAMethodRecovery, entities.FactorResponse{Code: recoveryCodes[0]})
+	assert.Nil(t, err)
+
+	remaining, err := auth.recoveryCodes.Remaining(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, remaining)
+
+	tokens, err := service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+}
+
+func TestReauthenticate(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	throttleRepo := &mockLoginThrottleRepository{throttles: make(map[string]entities.LoginThrottle)}
+	auth := newTestAuth(repo, func(auth *testAuth) {
+		auth.loginThrottle = services.NewLoginThrottleService(throttleRepo, &mockSecurityEventRepository{})
+	})
+	service := auth.service
+
+	err := service.Register(entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	})
+	assert.Nil(t, err)
+
+	tokens, err := service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+	claims, err := utils.ValidateToken(tokens.AccessToken, utils.GetJWTAudience())
+	assert.Nil(t, err)
+
+	session := auth.sessionRepo.sessions[claims.ID]
+	session.AuthTime = time.Now().Add(-time.Hour)
+	auth.sessionRepo.sessions[claims.ID] = session
+
+	_, err = service.Reauthenticate(1, claims.ID, "", "", entities.FactorResponse{}, testClient)
+	assert.NotNil(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = service.Reauthenticate(1, claims.ID, "wrongpassword", "", entities.FactorResponse{}, testClient)
+		assert.NotNil(t, err)
+	}
+	_, err = service.Reauthenticate(1, claims.ID, "Plum-Orbit-Canyon-47", "", entities.FactorResponse{}, testClient)
+	_, throttled := err.(*entities.LoginThrottledError)
+	assert.True(t, throttled, "wrong passwords count as failed logins")
+	throttleRepo.backdate(time.Minute)
+
+	tokens, err = service.Reauthenticate(1, claims.ID, "Plum-Orbit-Canyon-47", "", entities.FactorResponse{}, testClient)
+	assert.Nil(t, err)
+	claims, err = utils.ValidateToken(tokens.AccessToken, utils.GetJWTAudience())
+	assert.Nil(t, err)
+	assert.WithinDuration(t, time.Now(), time.Unix(claims.AuthTime, 0), time.Minute)
+	assert.Equal(t, []string{entities.AuthMethodPassword}, claims.AMR)
+
+	added, err := auth.factors.AddFactor(1, entities.TwoFAMethodTOTP)
+	assert.Nil(t, err)
+	enrollment := added.(*entities.TOTPEnrollment)
+	now := time.Now()
+	code, err := utils.TOTPCode(enrollment.Secret, utils.TOTPStep(now))
+	assert.Nil(t, err)
+	_, err = auth.factors.ConfirmFactor(1, entities.TwoFAMethodTOTP, entities.FactorResponse{Code: code})
+	assert.Nil(t, err)
+
+	next, err := utils.TOTPCode(enrollment.Secret, utils.TOTPStep(now)+1)
+	assert.Nil(t, err)
+	tokens, err = service.Reauthenticate(1, claims.ID, "", entities.TwoFAMethodTOTP, entities.FactorResponse{Code: next}, testClient)
+	assert.Nil(t, err)
+	claims, err = utils.ValidateToken(tokens.AccessToken, utils.GetJWTAudience())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{entities.AuthMethodOTP, entities.AuthMethodMFA}, claims.AMR)
+
+	err = auth.sessions.Logout(claims.ID)
+	assert.Nil(t, err)
+
+	_, err = service.Reauthenticate(1, claims.ID, "Plum-Orbit-Canyon-47", "", entities.FactorResponse{}, testClient)
+	assert.NotNil(t, err)
+}
+
+func TestStepUpMiddleware(t *testing.T) {
+	repo := &mockUserRepository{users: map[string]entities.User{
+		"testuser@example.com": {ID: 1, Username: "testuser", Email: "testuser@example.com", Active: true},
+	}}
+
+	gin.SetMode(gin.TestMode)
+	request := func(claims *utils.Claims) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.GET("/auth/update", func(c *gin.Context) {
+			c.Set("ID", 1)
+			c.Set("Claims", claims)
+		}, middlewares.StepUpMiddleware(repo), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/auth/update", nil))
+		return recorder
+	}
+
+	fresh := time.Now().Add(-time.Minute).Unix()
+	stale := time.Now().Add(-utils.GetStepUpMaxAge() - time.Minute).Unix()
+
+	assert.Equal(t, http.StatusOK, request(&utils.Claims{AuthTime: fresh, AMR: []string{entities.AuthMethodPassword}}).Code)
+
+	recorder := request(&utils.Claims{AuthTime: stale, AMR: []string{entities.AuthMethodPassword}})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("WWW-Authenticate"), `error="insufficient_user_authentication"`)
+	assert.Contains(t, recorder.Body.String(), "step_up_required")
+
+	recorder = request(&utils.Claims{AMR: []string{entities.AuthMethodPassword}})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code, "tokens without auth_time need a step-up")
+	assert.Contains(t, recorder.Body.String(), "step_up_required")
+
+	user := repo.users["testuser@example.com"]
+	user.Is2FAEnabled = true
+	repo.users["testuser@example.com"] = user
+
+	recorder = request(&utils.Claims{AuthTime: fresh, AMR: []string{entities.AuthMethodPassword}})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code, "users with 2FA need to answer a factor")
+	assert.Contains(t, recorder.Body.String(), `"mfaRequired":true`)
+	assert.Equal(t, http.StatusOK, request(&utils.Claims{AuthTime: fresh, AMR: []string{entities.AuthMethodOTP, entities.AuthMethodMFA}}).Code)
+}
+
+func TestPhoneFactor(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	factorRepo := &mockUserFactorRepository{}
+	phoneService := services.NewPhoneService(repo, factorRepo, newTestVerificationCodeService(), testOTPSender)
+	service := newTestAuthService(repo)
+
+	err := service.Register(entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	})
+	assert.Nil(t, err)
+
+	err = phoneService.SetPhoneNumber(1, "11999990000", "")
+	assert.NotNil(t, err)
+
+	err = phoneService.SetPhoneNumber(1, "+5511999990000", "fax")
+	assert.NotNil(t, err)
+
+	err = service.InitiatePasswordRecovery("testuser@example.com", entities.OTPChannelSMS)
+	assert.NotNil(t, err)
+
+	err = phoneService.SetPhoneNumber(1, "+5511999990000", entities.OTPChannelVoice)
+	assert.Nil(t, err)
+	message, sent := testOTPSender.Last("+5511999990000")
+	assert.True(t, sent)
+	assert.Equal(t, entities.OTPChannelVoice, message.Channel)
+	assert.Contains(t, message.Body, strings.Join(strings.Split(message.Code, ""), " "))
+
+	err = phoneService.VerifyPhoneNumber(1, "WRONG1")
+	assert.NotNil(t, err)
+
+	err = phoneService.VerifyPhoneNumber(1, message.Code)
+	assert.Nil(t, err)
+	user, _ := repo.FindByID(1)
+	assert.True(t, user.PhoneVerified)
+
+	err = phoneService.VerifyPhoneNumber(1, message.Code)
+	assert.NotNil(t, err)
+
+	err = service.InitiatePasswordRecovery("testuser@example.com", entities.OTPChannelSMS)
+	assert.Nil(t, err)
+	message, _ = testOTPSender.Last("+5511999990000")
+	assert.Equal(t, entities.OTPChannelSMS, message.Channel)
+	err = service.ResetPassword("testuser@example.com", message.Code, "Velvet-Harbor-Lantern-82")
+	assert.Nil(t, err)
+	user, _ = repo.FindByID(1)
+	assert.False(t, user.EmailVerified)
+
+	factorService := services.NewFactorService(
+		services.NewFactorRegistry(services.NewSMSFactor(newTestVerificationCodeService(), testOTPSender)),
+		factorRepo, repo,
+		services.NewRecoveryCodeService(&mockRecoveryCodeRepository{codes: make(map[int]map[string]bool)}),
+	)
+
+	_, err = factorService.AddFactor(1, entities.TwoFAMethodSMS)
+	assert.Nil(t, err)
+	message, _ = testOTPSender.Last("+5511999990000")
+	codes, err := factorService.ConfirmFactor(1, entities.TwoFAMethodSMS, entities.FactorResponse{Code: message.Code})
+	assert.Nil(t, err)
+	assert.Len(t, codes, 10)
+
+	err = phoneService.SetPhoneNumber(1, "+5511988880000", "")
+	assert.NotNil(t, err)
+	err = phoneService.RemovePhoneNumber(1)
+	assert.NotNil(t, err)
+
+	_, err = factorService.Challenge(1, entities.TwoFAMethodSMS)
+	assert.Nil(t, err)
+	message, _ = testOTPSender.Last("+5511999990000")
+
+	amr, err := factorService.Verify(1, entities.TwoFAMethodSMS, entities.FactorResponse{Code: "WRONG1"})
+	assert.NotNil(t, err)
+	amr, err = factorService.Verify(1, entities.TwoFAMethodSMS, entities.FactorResponse{Code: message.Code})
+	assert.Nil(t, err)
+	assert.Equal(t, entities.AuthMethodOTP, amr)
+}
+
+func TestVerificationCodes(t *testing.T) {
+	codes := newTestVerificationCodeService()
+
+	code, err := codes.Issue(1, entities.VerificationPurposePhone, entities.OTPChannelSMS, time.Minute)
+	assert.Nil(t, err)
+	assert.Len(t, code, 6)
+
+	_, err = codes.Verify(2, entities.VerificationPurposePhone, code)
+	assert.NotNil(t, err)
+	_, err = codes.Verify(1, entities.VerificationPurposePasswordRecovery, code)
+	assert.NotNil(t, err)
+
+	verified, err := codes.Verify(1, entities.VerificationPurposePhone, " "+strings.ToLower(code)+" ")
+	assert.Nil(t, err)
+	assert.Equal(t, entities.OTPChannelSMS, verified.Channel)
+
+	_, err = codes.Verify(1, entities.VerificationPurposePhone, code)
+	assert.NotNil(t, err)
+
+	code, err = codes.Issue(1, entities.VerificationPurposePhone, entities.OTPChannelSMS, time.Minute)
+	assert.Nil(t, err)
+	for i := 0; i < entities.VerificationCodeMaxAttempts; i++ {
+		_, err = codes.Verify(1, entities.VerificationPurposePhone, "WRONG!")
+		assert.NotNil(t, err)
+	}
+	_, err = codes.Verify(1, entities.VerificationPurposePhone, code)
+	assert.NotNil(t, err)
+
+	code, err = codes.Issue(1, entities.VerificationPurposePhone, entities.OTPChannelSMS, time.Minute)
+	assert.Nil(t, err)
+	_, err = codes.Verify(1, entities.VerificationPurposePhone, code)
+	assert.Nil(t, err)
+
+	code, err = codes.Issue(1, entities.VerificationPurposePhone, entities.OTPChannelSMS, -time.Minute)
+	assert.Nil(t, err)
+	_, err = codes.Verify(1, entities.VerificationPurposePhone, code)
+	assert.NotNil(t, err)
+}
+
+func TestLoginLockout(t *testing.T) {
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	throttleRepo := &mockLoginThrottleRepository{throttles: make(map[string]entities.LoginThrottle)}
+	eventRepo := &mockSecurityEventRepository{}
+	throttle := services.NewLoginThrottleService(throttleRepo, eventRepo)
+	service := newTestAuth(repo, func(auth *testAuth) { auth.loginThrottle = throttle }).service
+
+	err := service.Register(entities.User{
+		Username: "testuser",
+		Password: "Plum-Orbit-Canyon-47",
+		Email:    "testuser@example.com",
+	})
+	assert.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = service.Login("testuser@example.com", "wrongpassword", "", testClient)
+		_, throttled := err.(*entities.LoginThrottledError)
+		assert.False(t, throttled)
+	}
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	delayed, ok := err.(*entities.LoginThrottledError)
+	assert.True(t, ok)
+	assert.False(t, delayed.Locked)
+	assert.Greater(t, delayed.RetryAfter, time.Duration(0))
+
+	for i := 3; i < utils.GetLoginLockoutThreshold(); i++ {
+		throttleRepo.backdate(2 * time.Minute)
+		_, err = service.Login("testuser@example.com", "wrongpassword", "", testClient)
+		assert.NotNil(t, err)
+	}
+
+	throttleRepo.backdate(2 * time.Minute)
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	locked, ok := err.(*entities.LoginThrottledError)
+	assert.True(t, ok)
+	assert.True(t, locked.Locked)
+
+	events, err := throttle.ListEvents(1)
+	assert.Nil(t, err)
+	assert.Equal(t, entities.SecurityEventAccountLocked, events[0].Type)
+	assert.Len(t, events, utils.GetLoginLockoutThreshold()+1)
+
+	err = throttle.Unlock("not-a-token", testClient)
+	assert.NotNil(t, err)
+
+	err = throttle.AdminUnlock(1, testClient)
+	assert.Nil(t, err)
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+
+	events, _ = throttle.ListEvents(1)
+	assert.Equal(t, entities.SecurityEventAccountUnlocked, events[0].Type)
+	_, err = throttleRepo.Find(entities.LoginThrottleUser, entities.UserSubject(1))
+	assert.NotNil(t, err)
+	ipThrottle, err := throttleRepo.Find(entities.LoginThrottleIP, testClient.IPAddress)
+	assert.Nil(t, err)
+	assert.Equal(t, utils.GetLoginLockoutThreshold(), ipThrottle.Failures)
+}
+
+// startRedisStandIn serves the few Redis commands the rate limiter sends, so
+// its Redis store is tested without a Redis server.
+func startRedisStandIn(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	var mu sync.Mutex
+	values := make(map[string]int64)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+
+					args := make([]string, count)
+					for i := range args {
+						reader.ReadString('\n')
+						arg, _ := reader.ReadString('\n')
+						args[i] = strings.TrimSpace(arg)
+					}
+
+					mu.Lock()
+					value, exists := values[args[1]]
+					switch strings.ToUpper(args[0]) {
+					case "SET":
+						if !exists {
+							values[args[1]], _ = strconv.ParseInt(args[2], 10, 64)
+						}
+						fmt.Fprint(conn, "+OK\r\n")
+					case "INCR":
+						values[args[1]] = value + 1
+						fmt.Fprintf(conn, ":%d\r\n", value+1)
+					case "GET":
+						if !exists {
+							fmt.Fprint(conn, "$-1\r\n")
+						} else {
+							reply := strconv.FormatInt(value, 10)
+							fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(reply), reply)
+						}
+					default:
+						fmt.Fprint(conn, "-ERR unknown command\r\n")
+					}
+					mu.Unlock()
+				}
+			}(conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestRateLimit(t *testing.T) {
+	redisStore, err := utils.NewRedisRateLimitStore("redis://" + startRedisStandIn(t) + "/0")
+	assert.NoError(t, err)
+
+	stores := map[string]utils.RateLimitStore{
+		"memory": utils.NewMemoryRateLimitStore(),
+		"redis":  redisStore,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			limiter := utils.NewRateLimiter(store)
+			policy := utils.RateLimitPolicy{Name: "test", Limit: 3, Window: time.Hour}
+
+			for i := 0; i < 3; i++ {
+				result, err := limiter.Allow(policy, "ip:10.0.0.1")
+				assert.NoError(t, err)
+				assert.True(t, result.Allowed)
+				assert.Equal(t, 2-i, result.Remaining)
+			}
+
+			result, err := limiter.Allow(policy, "ip:10.0.0.1")
+			assert.NoError(t, err)
+			assert.False(t, result.Allowed)
+			assert.Equal(t, 0, result.Remaining)
+			assert.True(t, result.RetryAfter > 0)
+
+			result, err = limiter.Allow(policy, "ip:10.0.0.2")
+			assert.NoError(t, err)
+			assert.True(t, result.Allowed, "other keys keep their own limit")
+		})
+	}
+
+	t.Run("middleware", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		limiter := utils.NewRateLimiter(utils.NewMemoryRateLimitStore())
+		byIP := utils.RateLimitPolicy{Name: "ip", Limit: 3, Window: time.Minute}
+		byEmail := utils.RateLimitPolicy{Name: "email", Limit: 1, Window: time.Minute}
+
+		router := gin.New()
+		router.POST("/login",
+			middlewares.RateLimitMiddleware(limiter, byIP, middlewares.RateLimitByIP),
+			middlewares.RateLimitMiddleware(limiter, byEmail, middlewares.RateLimitByEmail),
+			func(c *gin.Context) {
+				var request struct {
+					Email string `json:"email"`
+				}
+				assert.NoError(t, c.ShouldBindJSON(&request), "the body is left for the handler")
+				c.JSON(http.StatusOK, gin.H{"email": request.Email})
+			})
+
+		login := func(email string) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"`+email+`"}`))
+			router.ServeHTTP(recorder, request)
+			return recorder
+		}
+
+		recorder := login("john@example.com")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "john@example.com")
+		assert.Equal(t, "1", recorder.Header().Get("RateLimit-Limit"), "the most restrictive policy is shown")
+		assert.Equal(t, "0", recorder.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "1;w=60", recorder.Header().Get("RateLimit-Policy"))
+
+		recorder = login(" John@Example.com")
+		assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+		assert.NotEmpty(t, recorder.Header().Get("Retry-After"))
+
+		recorder = login("jane@example.com")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		recorder = login("ann@example.com")
+		assert.Equal(t, http.StatusTooManyRequests, recorder.Code, "the IP counts every request")
+		assert.Equal(t, "3", recorder.Header().Get("RateLimit-Limit"))
+	})
+
+	t.Run("forwarded for", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		limiter := utils.NewRateLimiter(utils.NewMemoryRateLimitStore())
+		policy := utils.RateLimitPolicy{Name: "ip", Limit: 1, Window: time.Minute}
+
+		request := func(router *gin.Engine, forwardedFor string) int {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = "10.0.0.1:1234"
+			request.Header.Set("X-Forwarded-For", forwardedFor)
+			router.ServeHTTP(recorder, request)
+			return recorder.Code
+		}
+
+		router := gin.New()
+		assert.NoError(t, router.SetTrustedProxies(nil))
+		router.GET("/", middlewares.RateLimitMiddleware(limiter, policy, middlewares.RateLimitByIP), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		assert.Equal(t, http.StatusOK, request(router, "203.0.113.1"))
+		assert.Equal(t, http.StatusTooManyRequests, request(router, "203.0.113.2"), "untrusted forwarded addresses are ignored")
+
+		router = gin.New()
+		assert.NoError(t, router.SetTrustedProxies([]string{"10.0.0.1"}))
+		router.GET("/", middlewares.RateLimitMiddleware(limiter, policy, middlewares.RateLimitByIP), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		assert.Equal(t, http.StatusOK, request(router, "203.0.113.3"), "a trusted proxy forwards the client address")
+	})
+}
+
+func TestUnlockLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	router := gin.New()
+	router.SetHTMLTemplate(templates.Load())
+	authController := controllers.NewAuthController(newTestAuthService(repo), newTestLoginThrottleService())
+	router.GET("/auth/unlock", authController.ConfirmUnlock)
+	router.POST("/auth/unlock", authController.Unlock)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/auth/unlock?token=abc%22def", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code, "opening the link only shows the page")
+	assert.Contains(t, recorder.Body.String(), `method="post" action="/auth/unlock"`)
+	assert.Contains(t, recorder.Body.String(), `name="token" value="abc&#34;def"`)
+
+	recorder = httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/auth/unlock", strings.NewReader("token=not-a-token"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "invalid or has expired")
+
+	recorder = httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodPost, "/auth/unlock", strings.NewReader(`{"token":"not-a-token"}`))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"error"`)
+}
+
+func TestEmailLinks(t *testing.T) {
+	t.Setenv("PUBLIC_URL", "")
+	t.Setenv("ACCOUNT_UNLOCK_URL", "")
+	t.Setenv("EMAIL_CHANGE_CANCEL_URL", "")
+	assert.NotNil(t, utils.CheckEmailLinks(), "relative links are refused")
+
+	t.Setenv("PUBLIC_URL", "https://auth.example.com/")
+	assert.Nil(t, utils.CheckEmailLinks())
+	assert.Equal(t, "https://auth.example.com/auth/unlock", utils.GetAccountUnlockURL())
+	assert.Equal(t, "https://auth.example.com/auth/email/change/cancel", utils.GetEmailChangeCancelURL())
+
+	t.Setenv("ACCOUNT_UNLOCK_URL", "auth.example.com/unlock")
+	assert.NotNil(t, utils.CheckEmailLinks())
+	t.Setenv("ACCOUNT_UNLOCK_URL", "")
+
+	t.Setenv("EMAIL_CHANGE_CANCEL_URL", "/auth/email/change/cancel")
+	assert.NotNil(t, utils.CheckEmailLinks())
+}
+
+func TestEmailVerification(t *testing.T) {
+	t.Setenv("LOGIN_REQUIRES_VERIFIED_EMAIL", "true")
+	t.Setenv("DEFAULT_CATEGORIES_ON", "verification")
+
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	auth := newTestAuth(repo)
+	service := auth.service
+	codes := auth.codes
+	finances := auth.finances
+
+	err := service.Register(entities.User{
+		Username:      "testuser",
+		Password:      "Plum-Orbit-Canyon-47",
+		Email:         "testuser@example.com",
+		EmailVerified: true,
+	})
+	assert.Nil(t, err)
+	assert.False(t, repo.users["testuser@example.com"].EmailVerified)
+	assert.Empty(t, finances.created, "categories wait for the verification")
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	_, unverified := err.(*entities.EmailNotVerifiedError)
+	assert.True(t, unverified)
+
+	// The email holding the code cannot be read here, so issue the code the
+	// resend would.
+	code, err := codes.Issue(1, entities.VerificationPurposeEmail, entities.TwoFAMethodEmail, time.Hour)
+	assert.Nil(t, err)
+
+	err = service.VerifyEmail("testuser@example.com", "WRONG1")
+	assert.NotNil(t, err)
+
+	finances.err = fmt.Errorf("finances service unavailable")
+	err = service.VerifyEmail("testuser@example.com", code)
+	assert.NotNil(t, err)
+	assert.False(t, repo.users["testuser@example.com"].EmailVerified)
+	finances.err = nil
+
+	err = service.VerifyEmail("testuser@example.com", code)
+	assert.Nil(t, err, "the code is kept when creating the categories fails")
+	assert.True(t, repo.users["testuser@example.com"].EmailVerified)
+	assert.Equal(t, []int64{1}, finances.created)
+
+	err = service.VerifyEmail("testuser@example.com", code)
+	assert.NotNil(t, err)
+	err = service.ResendEmailVerification("testuser@example.com")
+	assert.NotNil(t, err, "verified addresses need no new code")
+
+	_, err = service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+
+	// A code sent by the email factor proves the address just the same.
+	err = service.Register(entities.User{Username: "otheruser", Password: "Plum-Orbit-Canyon-47", Email: "otheruser@example.com"})
+	assert.Nil(t, err)
+	other := repo.users["otheruser@example.com"]
+	code, err = codes.Issue(other.ID, entities.VerificationPurposeFactor(entities.TwoFAMethodEmail), entities.TwoFAMethodEmail, time.Hour)
+	assert.Nil(t, err)
+	err = services.NewEmailFactor(codes, auth.emailVerification).Verify(&other, nil, entities.FactorResponse{Code: code})
+	assert.Nil(t, err)
+	assert.True(t, repo.users["otheruser@example.com"].EmailVerified)
+	assert.Equal(t, []int64{1, int64(other.ID)}, finances.created)
+
+	// A password reset by email signs every session out even when recording
+	// the address fails afterwards.
+	t.Setenv("LOGIN_REQUIRES_VERIFIED_EMAIL", "false")
+	err = service.Register(entities.User{Username: "resetuser", Password: "Plum-Orbit-Canyon-47", Email: "resetuser@example.com"})
+	assert.Nil(t, err)
+	issued, err := service.Login("resetuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+	reset := repo.users["resetuser@example.com"]
+	code, err = codes.Issue(reset.ID, entities.VerificationPurposePasswordRecovery, entities.TwoFAMethodEmail, time.Hour)
+	assert.Nil(t, err)
+
+	finances.err = fmt.Errorf("finances service unavailable")
+	err = service.ResetPassword("resetuser@example.com", code, "Velvet-Harbor-Lantern-82")
+	assert.Nil(t, err)
+	finances.err = nil
+	_, err = auth.tokens.Refresh(issued.RefreshToken, "")
+	assert.NotNil(t, err)
+	assert.False(t, repo.users["resetuser@example.com"].EmailVerified, "the address is left to be verified again")
+}
+
+func TestEmailChange(t *testing.T) {
+	lastEmail := startMailStandIn(t)
+
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	auth := newTestAuth(repo)
+	service := auth.service
+	emailChanges := services.NewEmailChangeService(&mockEmailChangeRepository{}, repo, newTestVerificationCodeService(), auth.sessions, auth.emailVerification)
+
+	for _, email := range []string{"testuser@example.com", "taken@example.com"} {
+		err := service.Register(entities.User{Username: "testuser", Password: "Plum-Orbit-Canyon-47", Email: email})
+		assert.Nil(t, err)
+	}
+
+	issued, err := service.Login("testuser@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+
+	assert.NotNil(t, emailChanges.RequestChange(1, "not-an-email"))
+	assert.NotNil(t, emailChanges.RequestChange(1, "TestUser@example.com"))
+	assert.NotNil(t, emailChanges.RequestChange(1, "taken@example.com"))
+
+	cancelToken := func() string {
+		body := lastEmail("testuser@example.com").Body
+		token, err := url.QueryUnescape(body[strings.Index(body, "?token=")+len("?token="):])
+		assert.Nil(t, err)
+		return token
+	}
+	confirmationCode := func() string {
+		body := lastEmail("new@example.com").Body
+		return body[len(body)-6:]
+	}
+
+	err = emailChanges.RequestChange(1, "new@example.com")
+	assert.Nil(t, err)
+	assert.Contains(t, lastEmail("testuser@example.com").Body, "new@example.com")
+
+	// Opening the cancel link only shows a page, which posts the token back.
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.SetHTMLTemplate(templates.Load())
+	emailChangeController := controllers.NewEmailChangeController(emailChanges)
+	router.GET("/auth/email/change/cancel", emailChangeController.ConfirmCancelChange)
+	router.POST("/auth/email/change/cancel", emailChangeController.CancelChange)
+
+	token := cancelToken()
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/auth/email/change/cancel?token="+url.QueryEscape(token), nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `method="post"`)
+
+	recorder = httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/auth/email/change/cancel", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code, "the GET left the token to the POST")
+	assert.Contains(t, recorder.Body.String(), "The email change is cancelled.")
+	err = emailChanges.ConfirmChange(1, confirmationCode())
+	assert.NotNil(t, err, "a cancelled change cannot be confirmed")
+
+	err = emailChanges.RequestChange(1, "new@example.com")
+	assert.Nil(t, err)
+	staleToken := cancelToken()
+
+	err = emailChanges.ConfirmChange(1, "WRONG1")
+	assert.NotNil(t, err)
+	err = emailChanges.ConfirmChange(1, confirmationCode())
+	assert.Nil(t, err)
+
+	_, exists := repo.users["testuser@example.com"]
+	assert.False(t, exists)
+	assert.True(t, repo.users["new@example.com"].EmailVerified)
+	assert.Equal(t, 1, repo.users["new@example.com"].ID)
+	assert.Equal(t, []int64{1, 2}, auth.finances.created, "categories are only created once")
+
+	_, err = auth.tokens.Refresh(issued.RefreshToken, "")
+	assert.NotNil(t, err, "sessions are revoked")
+
+	err = emailChanges.CancelChange(staleToken)
+	assert.NotNil(t, err)
+
+	_, err = service.Login("new@example.com", "Plum-Orbit-Canyon-47", "", testClient)
+	assert.Nil(t, err)
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := entities.PasswordPolicy{MinLength: 8, MaxLength: 64, BlockCommon: true, RejectSimilar: true, MinStrength: 2}
+
+	codes := func(err error) []string {
+		failures, ok := err.(errors.ValidationErrors)
+		assert.True(t, ok)
+		result := []string{}
+		for _, failure := range failures {
+			assert.Equal(t, "password", failure.Field)
+			result = append(result, failure.Code)
+		}
+		return result
+	}
+
+	assert.Nil(t, policy.Check("Plum-Orbit-Canyon-47", "testuser", "testuser@example.com"))
+	assert.Equal(t, []string{"password_required"}, codes(policy.Check("")))
+	assert.Equal(t, []string{"password_too_short", "password_common", "password_weak"}, codes(policy.Check("hunter2")))
+	assert.Equal(t, []string{"password_too_long"}, codes(policy.Check(strings.Repeat("Plum-Orbit-Canyon-47", 4))))
+	assert.Equal(t, []string{"password_common", "password_weak"}, codes(policy.Check("P@ssw0rd!")))
+	assert.Equal(t, []string{"password_common", "password_weak"}, codes(policy.Check("Summer2024!")))
+	assert.Equal(t, []string{"password_similar", "password_weak"}, codes(policy.Check("testuser2024", "testuser", "testuser@example.com")))
+	assert.Contains(t, codes(policy.Check("t3stus3r!", "someone", "testuser@example.com")), "password_similar")
+	assert.Equal(t, []string{"password_weak"}, codes(policy.Check("mypassword")))
+
+	assert.Less(t, entities.PasswordStrength("aaaaaaaaaaaa"), 2)
+	assert.Less(t, entities.PasswordStrength("abcdefghijkl"), 2)
+	assert.Less(t, entities.PasswordStrength("1234567890"), 2)
+	assert.Equal(t, 4, entities.PasswordStrength("correcthorsebatterystaple"))
+
+	repo := &mockUserRepository{users: make(map[string]entities.User)}
+	service := newTestAuthService(repo)
+
+	err := service.Register(entities.User{Username: "testuser", Password: "password123", Email: "testuser@example.com"})
+	assert.Contains(t, codes(err), "password_common")
+	assert.Empty(t, repo.users)
+
+	t.Setenv("PASSWORD_BLOCK_COMMON", "false")
+	t.Setenv("PASSWORD_MIN_STRENGTH", "0")
+	err = service.Register(entities.User{Username: "testuser", Password: "password123", Email: "testuser@example.com"})
+	assert.Nil(t, err, "the policy is loaded from the config")
+}
+
+func TestKeyRotation(t *testing.T) {
+	repo := &mockSigningKeyRepository{}
+	keys := services.NewKeyService(repo)
+	t.Cleanup(func() { utils.InstallKeys(nil, "") })
+
+	keyID := func(token string) string {
+		header, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+		assert.Nil(t, err)
+		var fields struct {
+			KeyID string `json:"kid"`
+		}
+		assert.Nil(t, json.Unmarshal(header, &fields))
+		return fields.KeyID
+	}
+	published := func(kid string) bool {
+		set, err := utils.PublicJWKS()
+		assert.Nil(t, err)
+		for _, key := range set.Keys {
+			if key.KeyID == kid {
+				return true
+			}
+		}
+		return false
+	}
+
+	staticToken, err := utils.GenerateToken(utils.Claims{Subject: "1"})
+	assert.Nil(t, err)
+
+	_, err = keys.RotateKeys()
+	assert.Equal(t, entities.ErrKeyRotationUnsupported, err, "HS256 secrets are not rotated")
+	assert.Empty(t, repo.keys)
+
+	t.Setenv("JWT_SIGNING_ALG", "ES256")
+	first, err := keys.RotateKeys()
+	assert.Nil(t, err)
+	assert.True(t, first.ActivatesAt.After(time.Now()))
+	assert.True(t, published(first.KeyID), "the key is published before it signs")
+
+	token, err := utils.GenerateToken(utils.Claims{Subject: "1"})
+	assert.Nil(t, err)
+	assert.NotEqual(t, first.KeyID, keyID(token))
+
+	repo.keys[0].ActivatesAt = time.Now().Add(-time.Second)
+	assert.Nil(t, keys.LoadKeys())
+	firstToken, err := utils.GenerateToken(utils.Claims{Subject: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, first.KeyID, keyID(firstToken))
+	_, err = utils.ParseToken(staticToken)
+	assert.Nil(t, err, "the static key keeps verifying")
+
+	second, err := keys.RotateKeys()
+	assert.Nil(t, err)
+	token, err = utils.GenerateToken(utils.Claims{Subject: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, first.KeyID, keyID(token), "the current key signs until the next one activates")
+
+	activated := time.Now().Add(-time.Second)
+	repo.keys[0].ActivatesAt = activated
+	repo.keys[1].RetiredAt = &activated
+	assert.Nil(t, keys.LoadKeys())
+	token, err = utils.GenerateToken(utils.Claims{Subject: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, second.KeyID, keyID(token))
+	_, err = utils.ParseToken(firstToken)
+	assert.Nil(t, err, "a retired key keeps verifying")
+	assert.True(t, published(first.KeyID))
+
+	expired := time.Now().Add(-time.Second)
+	repo.keys[1].ExpiresAt = &expired
+	assert.Nil(t, keys.LoadKeys())
+	_, err = utils.ParseToken(firstToken)
+	assert.NotNil(t, err)
+	assert.False(t, published(first.KeyID))
+}
+
+func TestSigningAlgorithms(t *testing.T) {
+	t.Cleanup(func() { utils.InstallKeys(nil, "") })
+
+	set, err := utils.PublicJWKS()
+	assert.Nil(t, err)
+	assert.Empty(t, set.Keys, "the HS256 secret is never published")
+
+	_, _, err = utils.GenerateSigningKey("HS256")
+	assert.NotNil(t, err)
+
+	for _, alg := range []string{"RS256", "ES256", "EdDSA"} {
+		t.Run(alg, func(t *testing.T) {
+			key, _, err := utils.GenerateSigningKey(alg)
+			assert.Nil(t, err)
+			assert.Nil(t, utils.InstallKeys([]*utils.SigningKey{key}, key.KeyID))
+
+			token, err := utils.GenerateToken(utils.Claims{Subject: "1"})
+			assert.Nil(t, err)
+			claims, err := utils.ValidateToken(token, utils.GetJWTAudience())
+			assert.Nil(t, err)
+			assert.Equal(t, "1", claims.Subject)
+
+			set, err := utils.PublicJWKS()
+			assert.Nil(t, err)
+			if assert.Len(t, set.Keys, 1) {
+				assert.Equal(t, key.KeyID, set.Keys[0].KeyID)
+				assert.Equal(t, alg, set.Keys[0].Algorithm)
+			}
+
+			claims.ExpiresAt = time.Now().Add(time.Minute).Unix()
+			unknown := jwt.NewWithClaims(key.Method, claims)
+			unknown.Header["kid"] = "unknown"
+			signed, err := unknown.SignedString(key.PrivateKey)
+			assert.Nil(t, err)
+			_, err = utils.ParseToken(signed)
+			assert.NotNil(t, err, "a token with an unknown kid is rejected")
+
+			other, _, err := utils.GenerateSigningKey(alg)
+			assert.Nil(t, err)
+			forged := jwt.NewWithClaims(other.Method, claims)
+			forged.Header["kid"] = key.KeyID
+			signed, err = forged.SignedString(other.PrivateKey)
+			assert.Nil(t, err)
+			_, err = utils.ParseToken(signed)
+			assert.NotNil(t, err, "a token signed by another key is rejected")
+
+			confused := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+			confused.Header["kid"] = key.KeyID
+			signed, err = confused.SignedString([]byte(key.KeyID))
+			assert.Nil(t, err)
+			_, err = utils.ParseToken(signed)
+			assert.NotNil(t, err, "a token with another alg than its key is rejected")
+		})
+	}
 }
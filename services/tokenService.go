@@ -0,0 +1,204 @@
+package services
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/repositories"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type TokenService interface {
+	StartSession(userID int, client entities.ClientInfo, amr []string) (*entities.Session, error)
+	IssueTokens(userID int, client entities.ClientInfo, amr []string) (*entities.Tokens, error)
+	IssueSessionTokens(session *entities.Session, clientID, scope string) (*entities.Tokens, error)
+	Reauthenticate(sessionID string, amr []string) (*entities.Session, error)
+	Refresh(refreshToken, clientID string) (*entities.Tokens, error)
+}
+
+type tokenService struct {
+	userRepo         repositories.UserRepository
+	sessionRepo      repositories.SessionRepository
+	refreshTokenRepo repositories.RefreshTokenRepository
+}
+
+func NewTokenService(userRepo repositories.UserRepository, sessionRepo repositories.SessionRepository, refreshTokenRepo repositories.RefreshTokenRepository) TokenService {
+	return &tokenService{
+		userRepo:         userRepo,
+		sessionRepo:      sessionRepo,
+		refreshTokenRepo: refreshTokenRepo,
+	}
+}
+
+// StartSession records a new session for the user, authenticated now with
+// the methods in amr.
+func (s *tokenService) StartSession(userID int, client entities.ClientInfo, amr []string) (*entities.Session, error) {
+	sessionID, err := utils.GenerateSecureToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := entities.Session{
+		ID:         sessionID,
+		UserID:     userID,
+		UserAgent:  client.UserAgent,
+		IPAddress:  client.IPAddress,
+		AuthTime:   now,
+		AMR:        amr,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(utils.GetRefreshTokenTTL()),
+	}
+
+	err = s.sessionRepo.Create(session)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to create session")
+	}
+
+	return &session, nil
+}
+
+// IssueTokens starts a new session and returns its first access and refresh
+// token pair.
+func (s *tokenService) IssueTokens(userID int, client entities.ClientInfo, amr []string) (*entities.Tokens, error) {
+	session, err := s.StartSession(userID, client, amr)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.IssueSessionTokens(session, "", "")
+}
+
+// IssueSessionTokens starts a new refresh token family in an existing
+// session. clientID and scope are set when the tokens go to an OAuth client.
+func (s *tokenService) IssueSessionTokens(session *entities.Session, clientID, scope string) (*entities.Tokens, error) {
+	familyID, err := utils.GenerateSecureToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issue(session, clientID, scope, familyID)
+}
+
+// Reauthenticate moves the auth time of an active session to now and
+// replaces its amr with the methods the user just authenticated with, so
+// that tokens issued afterwards pass step-up checks.
+func (s *tokenService) Reauthenticate(sessionID string, amr []string) (*entities.Session, error) {
+	session, err := s.sessionRepo.FindByID(sessionID)
+	if err != nil || !session.IsActive() {
+		return nil, errors.NewServiceError("session has expired or was revoked")
+	}
+
+	session.AuthTime = time.Now()
+	session.AMR = amr
+
+	err = s.sessionRepo.Reauthenticate(session.ID, session.AuthTime, session.AMR)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to update session")
+	}
+
+	return session, nil
+}
+
+// Refresh rotates a refresh token: the presented token is consumed and a new
+// one is issued in the same family. Presenting a token that was already
+// rotated means it leaked, so the whole family and its session are revoked.
+// clientID must match the client the token was issued to, or be empty for
+// first-party tokens.
+func (s *tokenService) Refresh(refreshToken, clientID string) (*entities.Tokens, error) {
+	stored, err := s.refreshTokenRepo.FindByHash(utils.HashToken(refreshToken))
+	if err != nil {
+		return nil, entities.ErrInvalidRefreshToken
+	}
+
+	if stored.ClientID != clientID || stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, entities.ErrInvalidRefreshToken
+	}
+
+	if stored.UsedAt != nil {
+		return nil, s.revokeReusedFamily(stored)
+	}
+
+	marked, err := s.refreshTokenRepo.MarkUsed(stored.ID)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to rotate refresh token")
+	}
+	if !marked {
+		return nil, s.revokeReusedFamily(stored)
+	}
+
+	session, err := s.sessionRepo.FindByID(stored.SessionID)
+	if err != nil || !session.IsActive() {
+		return nil, entities.ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.FindByID(stored.UserID)
+	if err != nil || !user.Active {
+		return nil, entities.ErrInvalidRefreshToken
+	}
+
+	err = s.sessionRepo.Extend(session.ID, time.Now().Add(utils.GetRefreshTokenTTL()))
+	if err != nil {
+		return nil, errors.NewServiceError("failed to extend session")
+	}
+
+	return s.issue(session, stored.ClientID, stored.Scope, stored.FamilyID)
+}
+
+func (s *tokenService) issue(session *entities.Session, clientID, scope, familyID string) (*entities.Tokens, error) {
+	accessToken, err := utils.GenerateToken(utils.Claims{
+		Subject:  strconv.Itoa(session.UserID),
+		ID:       session.ID,
+		AuthTime: session.AuthTime.Unix(),
+		AMR:      session.AMR,
+		Scope:    scope,
+		ClientID: clientID,
+	})
+	if err != nil {
+		return nil, errors.NewServiceError("failed to generate access token")
+	}
+
+	refreshToken, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.refreshTokenRepo.Create(entities.RefreshToken{
+		UserID:    session.UserID,
+		SessionID: session.ID,
+		ClientID:  clientID,
+		Scope:     scope,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(utils.GetRefreshTokenTTL()),
+	})
+	if err != nil {
+		return nil, errors.NewServiceError("failed to store refresh token")
+	}
+
+	return &entities.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(utils.GetAccessTokenTTL().Seconds()),
+		Scope:        scope,
+	}, nil
+}
+
+func (s *tokenService) revokeReusedFamily(token *entities.RefreshToken) error {
+	utils.GetLogger().Warnf("Refresh token reuse detected for user %d, revoking session %s", token.UserID, token.SessionID)
+
+	err := s.refreshTokenRepo.RevokeFamily(token.FamilyID)
+	if err != nil {
+		return errors.NewServiceError("failed to revoke refresh tokens")
+	}
+
+	err = s.sessionRepo.Revoke(token.SessionID)
+	if err != nil {
+		return errors.NewServiceError("failed to revoke session")
+	}
+
+	return entities.ErrRefreshTokenReused
+}
@@ -0,0 +1,40 @@
+package services
+
+import "github.com/Renan-Parise/auth/entities"
+
+type totpFactor struct {
+	totpService TOTPService
+}
+
+// NewTOTPFactor returns the authenticator app factor.
+func NewTOTPFactor(totp TOTPService) Factor {
+	return &totpFactor{totpService: totp}
+}
+
+func (f *totpFactor) Type() string {
+	return entities.TwoFAMethodTOTP
+}
+
+func (f *totpFactor) AuthMethod() string {
+	return entities.AuthMethodOTP
+}
+
+func (f *totpFactor) Enroll(user *entities.User, factor *entities.UserFactor) (interface{}, error) {
+	return f.totpService.Enroll(user.ID)
+}
+
+// Challenge has nothing to prepare: the app shows a new code every step.
+func (f *totpFactor) Challenge(user *entities.User, factor *entities.UserFactor) (interface{}, error) {
+	return nil, nil
+}
+
+func (f *totpFactor) Verify(user *entities.User, factor *entities.UserFactor, response entities.FactorResponse) error {
+	if factor.ConfirmedAt == nil {
+		return f.totpService.Confirm(user.ID, response.Code)
+	}
+	return f.totpService.Verify(user.ID, response.Code)
+}
+
+func (f *totpFactor) Remove(user *entities.User, factor *entities.UserFactor) error {
+	return f.totpService.Remove(user.ID)
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/repositories"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/skip2/go-qrcode"
+)
+
+type TOTPService interface {
+	Enroll(userID int) (*entities.TOTPEnrollment, error)
+	Confirm(userID int, code string) error
+	Verify(userID int, code string) error
+	Remove(userID int) error
+	IsEnabled(userID int) bool
+}
+
+type totpService struct {
+	totpRepo repositories.TOTPRepository
+	userRepo repositories.UserRepository
+}
+
+func NewTOTPService(totpRepo repositories.TOTPRepository, userRepo repositories.UserRepository) TOTPService {
+	return &totpService{
+		totpRepo: totpRepo,
+		userRepo: userRepo,
+	}
+}
+
+// Enroll starts authenticator app enrollment with a new secret. Until the
+// user confirms it with a first code, their current 2FA settings apply.
+func (s *totpService) Enroll(userID int) (*entities.TOTPEnrollment, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.NewServiceError("user not found")
+	}
+
+	if s.IsEnabled(userID) {
+		return nil, errors.NewServiceError("authenticator app is already set up. remove it before enrolling a new one")
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, errors.NewServiceError("failed to generate TOTP secret")
+	}
+
+	err = s.totpRepo.Save(entities.TOTP{
+		UserID:    userID,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, errors.NewServiceError("failed to save TOTP enrollment")
+	}
+
+	uri := utils.TOTPProvisioningURI(secret, user.Email)
+
+	qrCode, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to generate QR code")
+	}
+
+	return &entities.TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: uri,
+		QRCode:          qrCode,
+	}, nil
+}
+
+// Confirm completes enrollment with a first code from the app.
+func (s *totpService) Confirm(userID int, code string) error {
+	totp, err := s.totpRepo.FindByUser(userID)
+	if err != nil || totp.ConfirmedAt != nil {
+		return errors.NewServiceError("no pending authenticator app enrollment")
+	}
+
+	step, ok := utils.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return errors.NewServiceError("invalid TOTP code")
+	}
+
+	err = s.totpRepo.Confirm(userID, step)
+	if err != nil {
+		return errors.NewServiceError("failed to confirm TOTP enrollment")
+	}
+
+	return nil
+}
+
+// Verify checks a code from the user's confirmed app. Each time step is only
+// accepted once, so an observed code cannot be replayed.
+func (s *totpService) Verify(userID int, code string) error {
+	totp, err := s.totpRepo.FindByUser(userID)
+	if err != nil || totp.ConfirmedAt == nil {
+		return errors.NewServiceError("authenticator app is not set up for this account")
+	}
+
+	step, ok := utils.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return errors.NewServiceError("invalid or expired TOTP code")
+	}
+
+	used, err := s.totpRepo.UseStep(userID, step)
+	if err != nil {
+		return errors.NewServiceError("failed to verify TOTP code")
+	}
+	if !used {
+		return errors.NewServiceError("TOTP code was already used")
+	}
+
+	return nil
+}
+
+func (s *totpService) Remove(userID int) error {
+	err := s.totpRepo.Delete(userID)
+	if err != nil {
+		return errors.NewServiceError("failed to remove authenticator app")
+	}
+	return nil
+}
+
+func (s *totpService) IsEnabled(userID int) bool {
+	totp, err := s.totpRepo.FindByUser(userID)
+	return err == nil && totp.ConfirmedAt != nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/repositories"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type TrustedDeviceService interface {
+	Trust(userID int, client entities.ClientInfo) (string, error)
+	IsTrusted(userID int, client entities.ClientInfo) bool
+	ListDevices(userID int, client entities.ClientInfo) ([]entities.TrustedDevice, error)
+	RevokeDevice(userID, ID int) error
+	RevokeAll(userID int) error
+}
+
+type trustedDeviceService struct {
+	deviceRepo repositories.TrustedDeviceRepository
+}
+
+func NewTrustedDeviceService(deviceRepo repositories.TrustedDeviceRepository) TrustedDeviceService {
+	return &trustedDeviceService{deviceRepo: deviceRepo}
+}
+
+// Trust remembers the client as a device of the user and returns the token
+// it presents on later logins to skip 2FA.
+func (s *trustedDeviceService) Trust(userID int, client entities.ClientInfo) (string, error) {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.deviceRepo.Create(entities.TrustedDevice{
+		UserID:    userID,
+		TokenHash: utils.HashToken(token),
+		UserAgent: client.UserAgent,
+		IPAddress: client.IPAddress,
+		ExpiresAt: time.Now().Add(utils.GetTrustedDeviceTTL()),
+	})
+	if err != nil {
+		return "", errors.NewServiceError("failed to remember device")
+	}
+
+	return token, nil
+}
+
+// IsTrusted reports whether the client presents an unexpired device token
+// of the user with the User-Agent it was issued to. A copied token can send
+// the same User-Agent, so the token is a bearer secret: it spares the second
+// factor but never the password.
+func (s *trustedDeviceService) IsTrusted(userID int, client entities.ClientInfo) bool {
+	if client.DeviceToken == "" {
+		return false
+	}
+
+	device, err := s.deviceRepo.FindByHash(utils.HashToken(client.DeviceToken))
+	if err != nil || device.UserID != userID || device.UserAgent != client.UserAgent || time.Now().After(device.ExpiresAt) {
+		return false
+	}
+
+	err = s.deviceRepo.Touch(device.ID, time.Now())
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to record trusted device use")
+	}
+
+	return true
+}
+
+func (s *trustedDeviceService) ListDevices(userID int, client entities.ClientInfo) ([]entities.TrustedDevice, error) {
+	devices, err := s.deviceRepo.FindActiveByUser(userID)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to fetch trusted devices")
+	}
+
+	currentHash := ""
+	if client.DeviceToken != "" {
+		currentHash = utils.HashToken(client.DeviceToken)
+	}
+	for i := range devices {
+		devices[i].Current = devices[i].TokenHash == currentHash
+	}
+
+	return devices, nil
+}
+
+func (s *trustedDeviceService) RevokeDevice(userID, ID int) error {
+	deleted, err := s.deviceRepo.Delete(userID, ID)
+	if err != nil {
+		return errors.NewServiceError("failed to revoke trusted device")
+	}
+	if !deleted {
+		return errors.NewServiceError("trusted device not found")
+	}
+	return nil
+}
+
+func (s *trustedDeviceService) RevokeAll(userID int) error {
+	err := s.deviceRepo.DeleteByUser(userID)
+	if err != nil {
+		return errors.NewServiceError("failed to revoke trusted devices")
+	}
+	return nil
+}
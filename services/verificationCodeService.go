@@ -0,0 +1,108 @@
+package services
+
+import (
+	"crypto/hmac"
+	"strings"
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/repositories"
+	"github.com/Renan-Parise/auth/utils"
+)
+
+type VerificationCodeService interface {
+	Issue(userID int, purpose, channel string, ttl time.Duration) (string, error)
+	Verify(userID int, purpose, code string) (*entities.VerificationCode, error)
+	Check(userID int, purpose, code string) (*entities.VerificationCode, error)
+	Consume(code *entities.VerificationCode) error
+}
+
+// verificationCodeLength is the number of characters in a code, each one of
+// 36 digits and letters.
+const verificationCodeLength = 6
+
+type verificationCodeService struct {
+	codeRepo repositories.VerificationCodeRepository
+}
+
+func NewVerificationCodeService(codeRepo repositories.VerificationCodeRepository) VerificationCodeService {
+	return &verificationCodeService{codeRepo: codeRepo}
+}
+
+// Issue generates a code for the purpose, replacing any code issued for it
+// before, and returns it so it can be sent through channel.
+func (s *verificationCodeService) Issue(userID int, purpose, channel string, ttl time.Duration) (string, error) {
+	code, err := utils.GenerateCode(verificationCodeLength)
+	if err != nil {
+		return "", errors.NewServiceError("failed to generate verification code")
+	}
+
+	err = s.codeRepo.Save(entities.VerificationCode{
+		UserID:    userID,
+		Purpose:   purpose,
+		Channel:   channel,
+		CodeHash:  utils.HashCode(userID, purpose, code),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", errors.NewServiceError("failed to save verification code")
+	}
+
+	return code, nil
+}
+
+// Verify consumes the code issued for the purpose if it matches. Every
+// attempt counts, and after VerificationCodeMaxAttempts wrong ones the code
+// stops working. Case and surrounding spaces are ignored.
+func (s *verificationCodeService) Verify(userID int, purpose, code string) (*entities.VerificationCode, error) {
+	stored, err := s.Check(userID, purpose, code)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Consume(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+// Check is Verify without consuming the code, for callers that only spend it
+// with Consume once the action it confirms has succeeded.
+func (s *verificationCodeService) Check(userID int, purpose, code string) (*entities.VerificationCode, error) {
+	stored, err := s.codeRepo.FindActive(userID, purpose)
+	if err != nil {
+		return nil, errors.NewServiceError("invalid or expired code")
+	}
+
+	counted, err := s.codeRepo.CountAttempt(stored.ID, entities.VerificationCodeMaxAttempts)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to verify code")
+	}
+	if !counted {
+		return nil, errors.NewServiceError("too many attempts, request a new code")
+	}
+
+	codeHash := utils.HashCode(userID, purpose, strings.ToUpper(strings.TrimSpace(code)))
+	if !hmac.Equal([]byte(codeHash), []byte(stored.CodeHash)) {
+		return nil, errors.NewServiceError("invalid or expired code")
+	}
+
+	return stored, nil
+}
+
+// Consume spends a code returned by Check. It fails if the code was consumed
+// or replaced in the meantime.
+func (s *verificationCodeService) Consume(code *entities.VerificationCode) error {
+	consumed, err := s.codeRepo.Consume(code.ID, code.CodeHash)
+	if err != nil {
+		return errors.NewServiceError("failed to verify code")
+	}
+	if !consumed {
+		return errors.NewServiceError("invalid or expired code")
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package services
+
+import "github.com/Renan-Parise/auth/entities"
+
+type webauthnFactor struct {
+	webauthnService WebAuthnService
+}
+
+// NewWebAuthnFactor returns the passkey factor. Any of the user's passkeys
+// answers it, including those registered for passwordless login.
+func NewWebAuthnFactor(webauthn WebAuthnService) Factor {
+	return &webauthnFactor{webauthnService: webauthn}
+}
+
+func (f *webauthnFactor) Type() string {
+	return entities.TwoFAMethodWebAuthn
+}
+
+func (f *webauthnFactor) AuthMethod() string {
+	return entities.AuthMethodHardware
+}
+
+func (f *webauthnFactor) Enroll(user *entities.User, factor *entities.UserFactor) (interface{}, error) {
+	return f.webauthnService.BeginRegistration(user.ID)
+}
+
+func (f *webauthnFactor) Challenge(user *entities.User, factor *entities.UserFactor) (interface{}, error) {
+	return f.webauthnService.BeginLogin(user.ID)
+}
+
+func (f *webauthnFactor) Verify(user *entities.User, factor *entities.UserFactor, response entities.FactorResponse) error {
+	if factor.ConfirmedAt == nil {
+		_, err := f.webauthnService.FinishRegistration(user.ID, response.CeremonyID, response.Name, response.Credential)
+		return err
+	}
+
+	_, err := f.webauthnService.FinishLogin(user.ID, response.CeremonyID, response.Credential)
+	return err
+}
+
+// Remove keeps the user's passkeys, which still sign them in without a
+// password. They are managed under /auth/webauthn/credentials.
+func (f *webauthnFactor) Remove(user *entities.User, factor *entities.UserFactor) error {
+	return nil
+}
@@ -0,0 +1,418 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+	"github.com/Renan-Parise/auth/repositories"
+	"github.com/Renan-Parise/auth/utils"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const webauthnCeremonyTTL = 5 * time.Minute
+
+type WebAuthnService interface {
+	BeginRegistration(userID int) (*entities.WebAuthnChallenge, error)
+	FinishRegistration(userID int, ceremonyID, name string, response []byte) (*entities.WebAuthnCredential, error)
+	BeginLogin(userID int) (*entities.WebAuthnChallenge, error)
+	FinishLogin(userID int, ceremonyID string, response []byte) (int, error)
+	ListCredentials(userID int) ([]entities.WebAuthnCredential, error)
+	DeleteCredential(userID, ID int) error
+	IsEnabled(userID int) bool
+}
+
+type webauthnService struct {
+	credentialRepo repositories.WebAuthnCredentialRepository
+	ceremonyRepo   repositories.WebAuthnCeremonyRepository
+	userRepo       repositories.UserRepository
+	factorRepo     repositories.UserFactorRepository
+}
+
+func NewWebAuthnService(credentialRepo repositories.WebAuthnCredentialRepository, ceremonyRepo repositories.WebAuthnCeremonyRepository, userRepo repositories.UserRepository, factorRepo repositories.UserFactorRepository) WebAuthnService {
+	return &webauthnService{
+		credentialRepo: credentialRepo,
+		ceremonyRepo:   ceremonyRepo,
+		userRepo:       userRepo,
+		factorRepo:     factorRepo,
+	}
+}
+
+// BeginRegistration returns the options for creating a new passkey. Keys the
+// user already registered are excluded so one authenticator is not added
+// twice.
+func (s *webauthnService) BeginRegistration(userID int) (*entities.WebAuthnChallenge, error) {
+	rp, err := relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	exclusions := []protocol.CredentialDescriptor{}
+	for _, credential := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	options, session, err := rp.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		}),
+	)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to start passkey registration")
+	}
+
+	return s.startCeremony(userID, entities.WebAuthnCeremonyRegistration, session, options)
+}
+
+// FinishRegistration verifies the authenticator's response to a registration
+// ceremony and stores the new credential.
+func (s *webauthnService) FinishRegistration(userID int, ceremonyID, name string, response []byte) (*entities.WebAuthnCredential, error) {
+	rp, err := relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.consumeCeremony(ceremonyID, entities.WebAuthnCeremonyRegistration, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return nil, errors.NewServiceError("invalid passkey registration response")
+	}
+
+	credential, err := rp.CreateCredential(user, *session, parsed)
+	if err != nil {
+		utils.GetLogger().WithError(err).Warnf("Passkey registration failed for user %d", userID)
+		return nil, errors.NewServiceError("passkey registration failed")
+	}
+
+	if name == "" {
+		name = "Passkey"
+	}
+
+	transports := []string{}
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	err = s.credentialRepo.Create(entities.WebAuthnCredential{
+		UserID:          userID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Name:            name,
+	})
+	if err != nil {
+		return nil, errors.NewServiceError("failed to save passkey")
+	}
+
+	return s.credentialRepo.FindByCredentialID(credential.ID)
+}
+
+// BeginLogin returns the options for an assertion with one of the user's
+// credentials, used as a second factor after the password. With userID 0 it
+// starts a passwordless login instead, in which the browser offers any
+// discoverable passkey and user verification is required.
+func (s *webauthnService) BeginLogin(userID int) (*entities.WebAuthnChallenge, error) {
+	rp, err := relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	if userID == 0 {
+		options, session, err := rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+		if err != nil {
+			return nil, errors.NewServiceError("failed to start passkey login")
+		}
+
+		return s.startCeremony(0, entities.WebAuthnCeremonyLogin, session, options)
+	}
+
+	user, err := s.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(user.credentials) == 0 {
+		return nil, errors.NewServiceError("no passkey is registered for this account")
+	}
+
+	options, session, err := rp.BeginLogin(user, webauthn.WithUserVerification(protocol.VerificationPreferred))
+	if err != nil {
+		return nil, errors.NewServiceError("failed to start passkey login")
+	}
+
+	return s.startCeremony(userID, entities.WebAuthnCeremonyLogin, session, options)
+}
+
+// FinishLogin verifies an assertion for a ceremony started by BeginLogin with
+// the same userID, and returns the user the credential belongs to. The
+// signature counter must move forward, otherwise the key may have been cloned
+// and the assertion is rejected.
+func (s *webauthnService) FinishLogin(userID int, ceremonyID string, response []byte) (int, error) {
+	rp, err := relyingParty()
+	if err != nil {
+		return 0, err
+	}
+
+	session, err := s.consumeCeremony(ceremonyID, entities.WebAuthnCeremonyLogin, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return 0, errors.NewServiceError("invalid passkey response")
+	}
+
+	var user *webauthnUser
+	var credential *webauthn.Credential
+	if userID == 0 {
+		credential, err = rp.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			user, err = s.findDiscoverableUser(rawID, userHandle)
+			return user, err
+		}, *session, parsed)
+	} else {
+		user, err = s.loadUser(userID)
+		if err != nil {
+			return 0, err
+		}
+		credential, err = rp.ValidateLogin(user, *session, parsed)
+	}
+	if err != nil {
+		utils.GetLogger().WithError(err).Warn("Passkey assertion failed")
+		return 0, errors.NewServiceError("passkey verification failed")
+	}
+
+	stored := user.credential(credential.ID)
+	if stored == nil {
+		return 0, errors.NewServiceError("passkey verification failed")
+	}
+
+	if credential.Authenticator.CloneWarning {
+		utils.GetLogger().Warnf("Passkey signature counter did not increase for credential %d of user %d, the key may be cloned", stored.ID, stored.UserID)
+		return 0, errors.NewServiceError("passkey verification failed")
+	}
+
+	updated, err := s.credentialRepo.UpdateSignCount(stored.ID, credential.Authenticator.SignCount, credential.Flags.BackupState)
+	if err != nil {
+		return 0, errors.NewServiceError("failed to update passkey")
+	}
+	if !updated {
+		return 0, errors.NewServiceError("passkey assertion was already used")
+	}
+
+	return stored.UserID, nil
+}
+
+func (s *webauthnService) ListCredentials(userID int) ([]entities.WebAuthnCredential, error) {
+	credentials, err := s.credentialRepo.FindByUser(userID)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to list passkeys")
+	}
+	return credentials, nil
+}
+
+// DeleteCredential removes a passkey. The last one is kept while the passkey
+// factor is set up, as that factor could not be answered without it.
+func (s *webauthnService) DeleteCredential(userID, ID int) error {
+	credentials, err := s.credentialRepo.FindByUser(userID)
+	if err != nil {
+		return errors.NewServiceError("failed to remove passkey")
+	}
+
+	if len(credentials) == 1 && credentials[0].ID == ID {
+		factor, err := s.factorRepo.FindByType(userID, entities.TwoFAMethodWebAuthn)
+		if err == nil && factor.ConfirmedAt != nil {
+			return entities.ErrLastPasskey
+		}
+	}
+
+	deleted, err := s.credentialRepo.Delete(userID, ID)
+	if err != nil {
+		return errors.NewServiceError("failed to remove passkey")
+	}
+	if !deleted {
+		return errors.NewServiceError("passkey not found")
+	}
+	return nil
+}
+
+func (s *webauthnService) IsEnabled(userID int) bool {
+	credentials, err := s.credentialRepo.FindByUser(userID)
+	return err == nil && len(credentials) > 0
+}
+
+func (s *webauthnService) startCeremony(userID int, ceremonyType string, session *webauthn.SessionData, options interface{}) (*entities.WebAuthnChallenge, error) {
+	ceremonyID, err := utils.GenerateSecureToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionData, err := json.Marshal(session)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to store WebAuthn ceremony")
+	}
+
+	err = s.ceremonyRepo.Create(entities.WebAuthnCeremony{
+		ID:          ceremonyID,
+		UserID:      userID,
+		Type:        ceremonyType,
+		SessionData: sessionData,
+		ExpiresAt:   time.Now().Add(webauthnCeremonyTTL),
+	})
+	if err != nil {
+		return nil, errors.NewServiceError("failed to store WebAuthn ceremony")
+	}
+
+	return &entities.WebAuthnChallenge{CeremonyID: ceremonyID, Options: options}, nil
+}
+
+// consumeCeremony loads and deletes a ceremony, so that its challenge can be
+// answered only once whether or not the answer turns out to be valid.
+func (s *webauthnService) consumeCeremony(ceremonyID, ceremonyType string, userID int) (*webauthn.SessionData, error) {
+	ceremony, err := s.ceremonyRepo.FindByID(ceremonyID)
+	if err != nil || ceremony.Type != ceremonyType || ceremony.UserID != userID {
+		return nil, errors.NewServiceError("invalid or expired WebAuthn ceremony")
+	}
+
+	deleted, err := s.ceremonyRepo.Delete(ceremonyID)
+	if err != nil || !deleted || time.Now().After(ceremony.ExpiresAt) {
+		return nil, errors.NewServiceError("invalid or expired WebAuthn ceremony")
+	}
+
+	session := &webauthn.SessionData{}
+	err = json.Unmarshal(ceremony.SessionData, session)
+	if err != nil {
+		return nil, errors.NewServiceError("invalid or expired WebAuthn ceremony")
+	}
+
+	return session, nil
+}
+
+func (s *webauthnService) loadUser(userID int) (*webauthnUser, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.NewServiceError("user not found")
+	}
+
+	credentials, err := s.credentialRepo.FindByUser(userID)
+	if err != nil {
+		return nil, errors.NewServiceError("failed to load passkeys")
+	}
+
+	return &webauthnUser{user: user, credentials: credentials}, nil
+}
+
+func (s *webauthnService) findDiscoverableUser(rawID, userHandle []byte) (*webauthnUser, error) {
+	credential, err := s.credentialRepo.FindByCredentialID(rawID)
+	if err != nil {
+		return nil, errors.NewServiceError("unknown passkey")
+	}
+
+	if !bytes.Equal(userHandle, webauthnUserHandle(credential.UserID)) {
+		return nil, errors.NewServiceError("passkey does not belong to this user")
+	}
+
+	return s.loadUser(credential.UserID)
+}
+
+func relyingParty() (*webauthn.WebAuthn, error) {
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:          utils.GetWebAuthnRPID(),
+		RPDisplayName: utils.GetWebAuthnRPName(),
+		RPOrigins:     utils.GetWebAuthnRPOrigins(),
+	})
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Invalid WebAuthn relying party configuration")
+		return nil, errors.NewServiceError("passkeys are not available")
+	}
+	return rp, nil
+}
+
+// webauthnUserHandle is the user handle stored on the user's authenticators.
+// It is the user ID, which carries no personal information.
+func webauthnUserHandle(userID int) []byte {
+	return []byte(strconv.Itoa(userID))
+}
+
+// webauthnUser adapts a user and their stored credentials to the WebAuthn
+// library.
+type webauthnUser struct {
+	user        *entities.User
+	credentials []entities.WebAuthnCredential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte {
+	return webauthnUserHandle(u.user.ID)
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *webauthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := []webauthn.Credential{}
+	for _, credential := range u.credentials {
+		transports := []protocol.AuthenticatorTransport{}
+		for _, transport := range credential.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              credential.CredentialID,
+			PublicKey:       credential.PublicKey,
+			AttestationType: credential.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: credential.BackupEligible,
+				BackupState:    credential.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    credential.AAGUID,
+				SignCount: credential.SignCount,
+			},
+		})
+	}
+	return credentials
+}
+
+func (u *webauthnUser) credential(credentialID []byte) *entities.WebAuthnCredential {
+	for i := range u.credentials {
+		if bytes.Equal(u.credentials[i].CredentialID, credentialID) {
+			return &u.credentials[i]
+		}
+	}
+	return nil
+}
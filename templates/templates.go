@@ -0,0 +1,14 @@
+package templates
+
+import (
+	"embed"
+	"html/template"
+)
+
+//go:embed *.html
+var files embed.FS
+
+// Load parses the embedded pages of the authorization server and the email links.
+func Load() *template.Template {
+	return template.Must(template.ParseFS(files, "*.html"))
+}
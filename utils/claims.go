@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// clockSkew is the leeway granted when checking time based claims, so that
+// small clock differences between services do not reject fresh tokens.
+const clockSkew = 30 * time.Second
+
+// Audience is the aud claim. It accepts both the single string and the array
+// form allowed by RFC 7519 and is always written as an array.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func (a Audience) Contains(audience string) bool {
+	return Contains(a, audience)
+}
+
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	AuthTime  int64    `json:"auth_time,omitempty"`
+	AMR       []string `json:"amr,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Nonce     string   `json:"nonce,omitempty"`
+}
+
+// Valid checks the time based claims. The issuer is checked by ParseToken and
+// the audience, which depends on who verifies the token, by ValidateToken.
+func (c Claims) Valid() error {
+	now := time.Now()
+
+	if c.ExpiresAt == 0 || now.Add(-clockSkew).Unix() > c.ExpiresAt {
+		return errors.New("token is expired")
+	}
+	if c.NotBefore != 0 && now.Add(clockSkew).Unix() < c.NotBefore {
+		return errors.New("token is not valid yet")
+	}
+	if c.IssuedAt != 0 && now.Add(clockSkew).Unix() < c.IssuedAt {
+		return errors.New("token was issued in the future")
+	}
+
+	return nil
+}
+
+// UserID returns the user a user token was issued to.
+func (c Claims) UserID() (int, error) {
+	ID, err := strconv.Atoi(c.Subject)
+	if err != nil {
+		return 0, errors.New("token subject is not a user")
+	}
+	return ID, nil
+}
@@ -0,0 +1,282 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+)
+
+func GetJWTSigningAlgorithm() string {
+	return getEnv("JWT_SIGNING_ALG", "HS256")
+}
+
+func GetJWTIssuer() string {
+	return getEnv("JWT_ISSUER", "auth")
+}
+
+func GetJWTAudience() string {
+	return getEnv("JWT_AUDIENCE", "auth")
+}
+
+func GetAccessTokenAudiences() []string {
+	audiences := getEnvList("JWT_ACCESS_TOKEN_AUDIENCES")
+	if len(audiences) == 0 {
+		return []string{GetJWTAudience()}
+	}
+	return audiences
+}
+
+func GetAccessTokenTTL() time.Duration {
+	return getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+func GetRefreshTokenTTL() time.Duration {
+	return getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+func GetClientTokenTTL() time.Duration {
+	return getEnvDuration("CLIENT_TOKEN_TTL", time.Hour)
+}
+
+func GetKeyRotationInterval() time.Duration {
+	return getEnvDuration("JWT_KEY_ROTATION_INTERVAL", 0)
+}
+
+func GetKeyActivationDelay() time.Duration {
+	return getEnvDuration("JWT_KEY_ACTIVATION_DELAY", 10*time.Minute)
+}
+
+// GetMaxTokenLifetime is how long a retired key must keep verifying tokens.
+func GetMaxTokenLifetime() time.Duration {
+	return max(GetAccessTokenTTL(), GetClientTokenTTL())
+}
+
+func GetStepUpMaxAge() time.Duration {
+	return getEnvDuration("STEP_UP_MAX_AGE", 10*time.Minute)
+}
+
+func GetTrustedDeviceTTL() time.Duration {
+	return getEnvDuration("TRUSTED_DEVICE_TTL", 30*24*time.Hour)
+}
+
+// GetVerificationCodeSecret falls back to JWT_SECRET for existing deployments.
+func GetVerificationCodeSecret() []byte {
+	return []byte(getEnv("VERIFICATION_CODE_SECRET", os.Getenv("JWT_SECRET")))
+}
+
+func GetLoginLockoutThreshold() int {
+	return getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 10)
+}
+
+func GetLoginIPLockoutThreshold() int {
+	return getEnvInt("LOGIN_IP_LOCKOUT_THRESHOLD", 100)
+}
+
+func GetLoginLockoutDuration() time.Duration {
+	return getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+}
+
+func GetLoginFailureWindow() time.Duration {
+	return getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute)
+}
+
+func GetPublicURL() string {
+	return strings.TrimSuffix(getEnv("PUBLIC_URL", ""), "/")
+}
+
+func GetAccountUnlockURL() string {
+	return getEnv("ACCOUNT_UNLOCK_URL", GetPublicURL()+"/auth/unlock")
+}
+
+// CheckEmailLinks fails when a link sent by email is not an absolute URL.
+func CheckEmailLinks() error {
+	links := []struct{ key, value string }{
+		{"ACCOUNT_UNLOCK_URL", GetAccountUnlockURL()},
+		{"EMAIL_CHANGE_CANCEL_URL", GetEmailChangeCancelURL()},
+	}
+
+	for _, link := range links {
+		parsed, err := url.Parse(link.value)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%s must be an absolute URL, set it or PUBLIC_URL: %q", link.key, link.value)
+		}
+	}
+
+	return nil
+}
+
+func GetPasswordPolicy() entities.PasswordPolicy {
+	return entities.PasswordPolicy{
+		MinLength:     getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		MaxLength:     getEnvInt("PASSWORD_MAX_LENGTH", 64),
+		BlockCommon:   getEnvBool("PASSWORD_BLOCK_COMMON", true),
+		RejectSimilar: getEnvBool("PASSWORD_REJECT_SIMILAR", true),
+		MinStrength:   getEnvInt("PASSWORD_MIN_STRENGTH", 2),
+	}
+}
+
+func GetLoginRequiresVerifiedEmail() bool {
+	return getEnvBool("LOGIN_REQUIRES_VERIFIED_EMAIL", false)
+}
+
+func GetDefaultCategoriesOn() string {
+	return getEnv("DEFAULT_CATEGORIES_ON", "registration")
+}
+
+func GetEmailVerificationTTL() time.Duration {
+	return getEnvDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+}
+
+func GetEmailVerificationURL() string {
+	return getEnv("EMAIL_VERIFICATION_URL", "")
+}
+
+func GetEmailChangeTTL() time.Duration {
+	return getEnvDuration("EMAIL_CHANGE_TTL", 24*time.Hour)
+}
+
+func GetEmailChangeCancelURL() string {
+	return getEnv("EMAIL_CHANGE_CANCEL_URL", GetPublicURL()+"/auth/email/change/cancel")
+}
+
+func GetTrustedProxies() []string {
+	return getEnvList("TRUSTED_PROXIES")
+}
+
+func GetRateLimitStore() string {
+	return getEnv("RATE_LIMIT_STORE", "memory")
+}
+
+func GetRateLimitRedisURL() string {
+	return getEnv("RATE_LIMIT_REDIS_URL", "redis://localhost:6379/0")
+}
+
+// GetRateLimitPolicy reads a policy such as "10/15m" from key. "0" disables it.
+func GetRateLimitPolicy(name, key, fallback string) RateLimitPolicy {
+	policy, err := parseRateLimitPolicy(name, getEnv(key, fallback))
+	if err != nil {
+		GetLogger().WithError(err).Warnf("Invalid rate limit for %s, using default %s", key, fallback)
+		policy, _ = parseRateLimitPolicy(name, fallback)
+	}
+
+	return policy
+}
+
+func parseRateLimitPolicy(name, value string) (RateLimitPolicy, error) {
+	if value == "0" {
+		return RateLimitPolicy{Name: name}, nil
+	}
+
+	limit, window, found := strings.Cut(value, "/")
+	if !found {
+		return RateLimitPolicy{}, fmt.Errorf("expected requests/window, got %q", value)
+	}
+
+	requests, err := strconv.Atoi(limit)
+	if err != nil || requests < 0 {
+		return RateLimitPolicy{}, fmt.Errorf("invalid number of requests %q", limit)
+	}
+
+	duration, err := time.ParseDuration(window)
+	if err != nil || duration <= 0 {
+		return RateLimitPolicy{}, fmt.Errorf("invalid window %q", window)
+	}
+
+	return RateLimitPolicy{Name: name, Limit: requests, Window: duration}, nil
+}
+
+func GetOTPProvider() string {
+	return getEnv("OTP_PROVIDER", "http")
+}
+
+func GetTOTPIssuer() string {
+	return getEnv("TOTP_ISSUER", "Auth")
+}
+
+func GetWebAuthnRPID() string {
+	return getEnv("WEBAUTHN_RP_ID", "localhost")
+}
+
+func GetWebAuthnRPName() string {
+	return getEnv("WEBAUTHN_RP_NAME", "Auth")
+}
+
+func GetWebAuthnRPOrigins() []string {
+	origins := getEnvList("WEBAUTHN_RP_ORIGINS")
+	if len(origins) == 0 {
+		return []string{"http://localhost:8181"}
+	}
+	return origins
+}
+
+func GetAdminAPIKey() string {
+	return os.Getenv("ADMIN_API_KEY")
+}
+
+func getEnv(key, fallback string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func getEnvList(key string) []string {
+	values := []string{}
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		GetLogger().WithError(err).Warnf("Invalid number for %s, using default %d", key, fallback)
+		return fallback
+	}
+
+	return number
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		GetLogger().WithError(err).Warnf("Invalid boolean for %s, using default %t", key, fallback)
+		return fallback
+	}
+
+	return enabled
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		GetLogger().WithError(err).Warnf("Invalid duration for %s, using default %s", key, fallback)
+		return fallback
+	}
+
+	return duration
+}
@@ -1,30 +1,249 @@
 package utils
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
 	"errors"
+	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 )
 
-func GenerateToken(ID int) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": ID,
-		"exp":     time.Now().Add(72 * time.Hour).Unix(),
+// SigningKey is the key material used to sign and verify tokens. For HS256
+// the private and public key are the same shared secret.
+type SigningKey struct {
+	KeyID      string
+	Method     jwt.SigningMethod
+	PrivateKey interface{}
+	PublicKey  interface{}
+}
+
+var (
+	signingKey     *SigningKey
+	signingKeyErr  error
+	signingKeyOnce sync.Once
+)
+
+// LoadSigningKey reads the static key configured through JWT_SIGNING_ALG.
+func LoadSigningKey() error {
+	_, err := getSigningKey()
+	return err
+}
+
+func getSigningKey() (*SigningKey, error) {
+	signingKeyOnce.Do(func() {
+		signingKey, signingKeyErr = loadSigningKey()
+	})
+	return signingKey, signingKeyErr
+}
+
+func loadSigningKey() (*SigningKey, error) {
+	alg := GetJWTSigningAlgorithm()
+
+	if alg == jwt.SigningMethodHS256.Alg() {
+		secret := []byte(os.Getenv("JWT_SECRET"))
+		return &SigningKey{
+			KeyID:      os.Getenv("JWT_KEY_ID"),
+			Method:     jwt.SigningMethodHS256,
+			PrivateKey: secret,
+			PublicKey:  secret,
+		}, nil
+	}
+
+	pemBytes, err := os.ReadFile(os.Getenv("JWT_PRIVATE_KEY_PATH"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT private key: %w", err)
+	}
+
+	key, err := ParseSigningKey(alg, pemBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyID := os.Getenv("JWT_KEY_ID"); keyID != "" {
+		key.KeyID = keyID
+	}
+
+	return key, nil
+}
+
+func ParseSigningKey(alg string, pemBytes []byte) (*SigningKey, error) {
+	var method jwt.SigningMethod
+	var privateKey crypto.PrivateKey
+	var publicKey crypto.PublicKey
+
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RSA private key: %w", err)
+		}
+		method, privateKey, publicKey = jwt.SigningMethodRS256, key, &key.PublicKey
+	case jwt.SigningMethodES256.Alg():
+		key, err := jwt.ParseECPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse EC private key: %w", err)
+		}
+		if key.Curve != elliptic.P256() {
+			return nil, errors.New("ES256 requires a P-256 key")
+		}
+		method, privateKey, publicKey = jwt.SigningMethodES256, key, &key.PublicKey
+	case jwt.SigningMethodEdDSA.Alg():
+		key, err := jwt.ParseEdPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Ed25519 private key: %w", err)
+		}
+		edKey := key.(ed25519.PrivateKey)
+		method, privateKey, publicKey = jwt.SigningMethodEdDSA, edKey, edKey.Public()
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing algorithm %q", alg)
+	}
+
+	jwk, err := NewJWK(publicKey, method.Alg(), "")
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, err := jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		KeyID:      keyID,
+		Method:     method,
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+	}, nil
+}
+
+func signToken(claims jwt.Claims) (string, error) {
+	key, err := keyring.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.KeyID != "" {
+		token.Header["kid"] = key.KeyID
+	}
+	return token.SignedString(key.PrivateKey)
+}
+
+func GenerateToken(claims Claims) (string, error) {
+	now := time.Now()
+	claims.Issuer = GetJWTIssuer()
+	claims.Audience = GetAccessTokenAudiences()
+	claims.ExpiresAt = now.Add(GetAccessTokenTTL()).Unix()
+	claims.NotBefore = now.Unix()
+	claims.IssuedAt = now.Unix()
+	return signToken(claims)
+}
+
+// GenerateIDToken issues an OpenID Connect ID token. The caller provides the
+// subject, the client as audience and the authentication claims.
+func GenerateIDToken(claims Claims) (string, error) {
+	now := time.Now()
+	claims.Issuer = GetJWTIssuer()
+	claims.ExpiresAt = now.Add(GetAccessTokenTTL()).Unix()
+	claims.IssuedAt = now.Unix()
+	return signToken(claims)
+}
+
+// ChallengeTokenAudience is the audience of 2FA challenge tokens, which no
+// service accepts as an access token.
+const ChallengeTokenAudience = "2fa-challenge"
+
+func GenerateChallengeToken(subject, challengeID string, expiresAt time.Time) (string, error) {
+	now := time.Now()
+	return signToken(Claims{
+		Issuer:    GetJWTIssuer(),
+		Subject:   subject,
+		Audience:  Audience{ChallengeTokenAudience},
+		ExpiresAt: expiresAt.Unix(),
+		IssuedAt:  now.Unix(),
+		ID:        challengeID,
 	})
-	return token.SignedString([]byte(secret))
 }
 
-func ValidateToken(tokenString string) (jwt.MapClaims, error) {
-	secret := os.Getenv("JWT_SECRET")
-	claims := jwt.MapClaims{}
+// GenerateClientToken issues an access token to an OAuth client acting on its
+// own behalf, as in the client credentials grant.
+func GenerateClientToken(clientID string, audiences []string, scope string) (string, error) {
+	now := time.Now()
+	return signToken(Claims{
+		Issuer:    GetJWTIssuer(),
+		Subject:   clientID,
+		Audience:  audiences,
+		ExpiresAt: now.Add(GetClientTokenTTL()).Unix(),
+		NotBefore: now.Unix(),
+		IssuedAt:  now.Unix(),
+		Scope:     scope,
+		ClientID:  clientID,
+	})
+}
+
+// ValidateToken verifies the signature and time claims of a token and that it
+// was issued by this service for audience.
+func ValidateToken(tokenString, audience string) (*Claims, error) {
+	claims, err := ParseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.Audience.Contains(audience) {
+		return nil, errors.New("token was not issued for this audience")
+	}
+	return claims, nil
+}
+
+// ParseToken verifies the signature, time claims and issuer of a token
+// without restricting its audience.
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
+		keyID, _ := token.Header["kid"].(string)
+		key, err := keyring.verificationKey(keyID)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("unexpected signing algorithm")
+		}
+		return key.PublicKey, nil
 	})
 	if err != nil || !token.Valid {
 		return nil, errors.New("invalid token")
 	}
+	if claims.Issuer != GetJWTIssuer() {
+		return nil, errors.New("invalid token issuer")
+	}
 	return claims, nil
 }
+
+// PublicJWKS returns the verification keys in JWK Set form. Shared HS256
+// secrets are never published, so the set is empty in that mode.
+func PublicJWKS() (JWKSet, error) {
+	keys, err := keyring.verificationKeys()
+	if err != nil {
+		return JWKSet{}, err
+	}
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range keys {
+		switch key.PublicKey.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+			jwk, err := NewJWK(key.PublicKey, key.Method.Alg(), key.KeyID)
+			if err != nil {
+				return JWKSet{}, err
+			}
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+
+	return set, nil
+}
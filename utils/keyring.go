@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Keyring holds every key that may verify a token and the single key that
+// signs new ones. Keys are looked up by the kid token header. The static key
+// comes from the environment and keeps verifying tokens issued before the
+// first rotation.
+type Keyring struct {
+	mu           sync.RWMutex
+	keys         map[string]*SigningKey
+	signingKeyID string
+}
+
+var keyring = &Keyring{keys: map[string]*SigningKey{}}
+
+// InstallKeys replaces the rotated keys of the keyring. signingKeyID must be
+// one of the given keys, or empty to sign with the static key.
+func InstallKeys(keys []*SigningKey, signingKeyID string) error {
+	installed := make(map[string]*SigningKey, len(keys))
+	for _, key := range keys {
+		installed[key.KeyID] = key
+	}
+
+	if _, ok := installed[signingKeyID]; signingKeyID != "" && !ok {
+		return fmt.Errorf("signing key %q is not part of the keyring", signingKeyID)
+	}
+
+	keyring.mu.Lock()
+	defer keyring.mu.Unlock()
+
+	keyring.keys = installed
+	keyring.signingKeyID = signingKeyID
+	return nil
+}
+
+func (k *Keyring) signingKey() (*SigningKey, error) {
+	k.mu.RLock()
+	key, ok := k.keys[k.signingKeyID]
+	k.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	return getSigningKey()
+}
+
+func (k *Keyring) verificationKey(keyID string) (*SigningKey, error) {
+	k.mu.RLock()
+	key, ok := k.keys[keyID]
+	k.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	static, err := getSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	if static.KeyID != keyID {
+		return nil, errors.New("unknown signing key")
+	}
+	return static, nil
+}
+
+func (k *Keyring) verificationKeys() ([]*SigningKey, error) {
+	static, err := getSigningKey()
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := []*SigningKey{}
+	for _, key := range k.keys {
+		keys = append(keys, key)
+	}
+	if _, ok := k.keys[static.KeyID]; !ok {
+		keys = append(keys, static)
+	}
+	return keys, nil
+}
+
+// SupportsKeyRotation reports whether keys of alg can be rotated. A rotated
+// HS256 secret would be unknown to every service verifying with JWT_SECRET.
+func SupportsKeyRotation(alg string) bool {
+	return alg != jwt.SigningMethodHS256.Alg()
+}
+
+// GenerateSigningKey creates a fresh key for alg and returns it together with
+// its PEM encoded form, which DecodeSigningKey turns back into the same key.
+func GenerateSigningKey(alg string) (*SigningKey, []byte, error) {
+	var privateKey interface{}
+	var err error
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodES256.Alg():
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwt.SigningMethodEdDSA.Alg():
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, nil, fmt.Errorf("unsupported JWT signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	key, err := ParseSigningKey(alg, encoded)
+	return key, encoded, err
+}
+
+// DecodeSigningKey rebuilds a key produced by GenerateSigningKey.
+func DecodeSigningKey(alg, keyID string, encoded []byte) (*SigningKey, error) {
+	key, err := ParseSigningKey(alg, encoded)
+	if err != nil {
+		return nil, err
+	}
+	key.KeyID = keyID
+	return key, nil
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Renan-Parise/auth/entities"
+	"github.com/Renan-Parise/auth/errors"
+)
+
+// OTPSender delivers one-time codes to phone numbers, the way SendEmail
+// delivers them to email addresses.
+type OTPSender interface {
+	Send(message entities.OTPMessage) error
+}
+
+// NewOTPSender returns the sender selected by OTP_PROVIDER.
+func NewOTPSender() OTPSender {
+	if GetOTPProvider() == "fake" {
+		return NewFakeOTPSender()
+	}
+	return NewHTTPOTPSender(GetOTPServiceURL())
+}
+
+type httpOTPSender struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPOTPSender posts every message as JSON to baseURL + "/otp/send", the
+// SMS and voice counterpart of the mail service.
+func NewHTTPOTPSender(baseURL string) OTPSender {
+	return &httpOTPSender{
+		url:    baseURL + "/otp/send",
+		client: &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+func (s *httpOTPSender) Send(message entities.OTPMessage) error {
+	jsonData, err := json.Marshal(message)
+	if err != nil {
+		return errors.NewServiceError("Failed to send OTP: " + err.Error())
+	}
+
+	req, err := http.NewRequest("POST", s.url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return errors.NewServiceError("Failed to send OTP: " + err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.NewServiceError("Failed to send OTP: " + err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.NewServiceError("Failed to send OTP, status code: " + resp.Status)
+	}
+
+	return nil
+}
+
+// FakeOTPSender keeps the messages it is given instead of sending them, for
+// tests and local development.
+type FakeOTPSender struct {
+	mu       sync.Mutex
+	messages []entities.OTPMessage
+}
+
+func NewFakeOTPSender() *FakeOTPSender {
+	return &FakeOTPSender{}
+}
+
+func (s *FakeOTPSender) Send(message entities.OTPMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, message)
+	GetLogger().Infof("OTP for %s by %s: %s", message.PhoneNumber, message.Channel, message.Code)
+	return nil
+}
+
+// Last returns the latest message sent to phoneNumber.
+func (s *FakeOTPSender) Last(phoneNumber string) (entities.OTPMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].PhoneNumber == phoneNumber {
+			return s.messages[i], true
+		}
+	}
+	return entities.OTPMessage{}, false
+}
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Renan-Parise/auth/errors"
+)
+
+// RateLimitStore keeps the request counters of the rate limiter. The memory
+// store only limits requests to one instance; the Redis store shares the
+// counters between instances.
+type RateLimitStore interface {
+	// Increment adds one to the counter at key, which is created to expire
+	// after ttl, and returns the new count.
+	Increment(key string, ttl time.Duration) (int64, error)
+	// Get returns the counter at key, or zero when there is none.
+	Get(key string) (int64, error)
+}
+
+// NewRateLimitStore returns the store selected by RATE_LIMIT_STORE. It falls
+// back to the memory store when the Redis URL is invalid.
+func NewRateLimitStore() RateLimitStore {
+	if GetRateLimitStore() == "redis" {
+		store, err := NewRedisRateLimitStore(GetRateLimitRedisURL())
+		if err == nil {
+			return store
+		}
+		GetLogger().WithError(err).Error("Failed to configure Redis rate limit store, using memory: ", err)
+	}
+	return NewMemoryRateLimitStore()
+}
+
+type memoryCounter struct {
+	count     int64
+	expiresAt time.Time
+}
+
+type memoryRateLimitStore struct {
+	mu         sync.Mutex
+	counters   map[string]memoryCounter
+	increments int
+}
+
+// memorySweepInterval is how many increments pass between removals of the
+// expired counters.
+const memorySweepInterval = 1000
+
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &memoryRateLimitStore{counters: make(map[string]memoryCounter)}
+}
+
+func (s *memoryRateLimitStore) Increment(key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	s.increments++
+	if s.increments%memorySweepInterval == 0 {
+		for k, counter := range s.counters {
+			if !now.Before(counter.expiresAt) {
+				delete(s.counters, k)
+			}
+		}
+	}
+
+	counter, exists := s.counters[key]
+	if !exists || !now.Before(counter.expiresAt) {
+		counter = memoryCounter{expiresAt: now.Add(ttl)}
+	}
+	counter.count++
+	s.counters[key] = counter
+
+	return counter.count, nil
+}
+
+func (s *memoryRateLimitStore) Get(key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, exists := s.counters[key]
+	if !exists || !time.Now().Before(counter.expiresAt) {
+		return 0, nil
+	}
+	return counter.count, nil
+}
+
+type redisRateLimitStore struct {
+	client *redisClient
+}
+
+// NewRedisRateLimitStore keeps the counters in the Redis compatible server
+// at rawURL, such as redis://:password@localhost:6379/0.
+func NewRedisRateLimitStore(rawURL string) (RateLimitStore, error) {
+	client, err := newRedisClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &redisRateLimitStore{client: client}, nil
+}
+
+// Increment creates the counter with its expiry first, so that it never
+// exists without one, and then increments it, which keeps the expiry.
+func (s *redisRateLimitStore) Increment(key string, ttl time.Duration) (int64, error) {
+	_, err := s.client.Do("SET", key, "0", "PX", strconv.FormatInt(ttl.Milliseconds(), 10), "NX")
+	if err != nil {
+		return 0, err
+	}
+
+	reply, err := s.client.Do("INCR", key)
+	if err != nil {
+		return 0, err
+	}
+
+	count, ok := reply.(int64)
+	if !ok {
+		return 0, errors.NewServiceError("unexpected reply to INCR from Redis")
+	}
+	return count, nil
+}
+
+func (s *redisRateLimitStore) Get(key string) (int64, error) {
+	reply, err := s.client.Do("GET", key)
+	if err != nil {
+		return 0, err
+	}
+	if reply == nil {
+		return 0, nil
+	}
+
+	value, ok := reply.(string)
+	if !ok {
+		return 0, errors.NewServiceError("unexpected reply to GET from Redis")
+	}
+
+	count, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errors.NewServiceError("invalid counter in Redis: " + value)
+	}
+	return count, nil
+}
+
+// RateLimitPolicy allows Limit requests per Window for each key. A Limit of
+// zero disables it.
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+// RateLimitResult describes the state of a key after a request, for the
+// RateLimit headers.
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+type RateLimiter struct {
+	store RateLimitStore
+}
+
+func NewRateLimiter(store RateLimitStore) *RateLimiter {
+	return &RateLimiter{store: store}
+}
+
+// Allow counts rejected requests too, so clients that keep retrying stay limited.
+func (l *RateLimiter) Allow(policy RateLimitPolicy, key string) (RateLimitResult, error) {
+	if policy.Limit == 0 {
+		return RateLimitResult{Allowed: true}, nil
+	}
+
+	now := time.Now()
+	index := now.UnixNano() / int64(policy.Window)
+	elapsed := time.Duration(now.UnixNano() - index*int64(policy.Window))
+	prefix := "ratelimit:" + policy.Name + ":" + key + ":"
+
+	current, err := l.store.Increment(prefix+strconv.FormatInt(index, 10), 2*policy.Window)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	previous, err := l.store.Get(prefix + strconv.FormatInt(index-1, 10))
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	overlap := 1 - float64(elapsed)/float64(policy.Window)
+	estimate := float64(previous)*overlap + float64(current)
+	limit := float64(policy.Limit)
+
+	result := RateLimitResult{
+		Allowed:   estimate <= limit,
+		Remaining: max(0, policy.Limit-int(math.Ceil(estimate))),
+		Reset:     policy.Window - elapsed,
+	}
+
+	if !result.Allowed {
+		// The estimate drops below the limit once enough of the previous
+		// window slid out or, when the current one alone exceeds it, once
+		// enough of the current one did after it ended.
+		if float64(current) < limit {
+			slid := time.Duration((1 - (limit-float64(current))/float64(previous)) * float64(policy.Window))
+			result.RetryAfter = slid - elapsed
+		} else {
+			slid := time.Duration((1 - limit/float64(current)) * float64(policy.Window))
+			result.RetryAfter = result.Reset + slid
+		}
+	}
+
+	return result, nil
+}
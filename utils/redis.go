@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Renan-Parise/auth/errors"
+)
+
+// redisClient speaks just enough of the Redis protocol (RESP) for shared
+// counters, so any Redis compatible server can back them without another
+// dependency. It keeps one connection and reconnects after errors.
+type redisClient struct {
+	mu       sync.Mutex
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+	conn     net.Conn
+	reader   *bufio.Reader
+}
+
+// newRedisClient parses a URL such as redis://:password@localhost:6379/0.
+func newRedisClient(rawURL string) (*redisClient, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme != "redis" || parsed.Host == "" {
+		return nil, errors.NewServiceError("invalid Redis URL: " + rawURL)
+	}
+
+	client := &redisClient{addr: parsed.Host, timeout: 2 * time.Second}
+	if password, ok := parsed.User.Password(); ok {
+		client.password = password
+	}
+	if path := strings.TrimPrefix(parsed.Path, "/"); path != "" {
+		if client.db, err = strconv.Atoi(path); err != nil {
+			return nil, errors.NewServiceError("invalid Redis database: " + path)
+		}
+	}
+
+	return client, nil
+}
+
+// Do sends one command and returns its reply: a string, an int64, nil for a
+// missing value or a []interface{} of those.
+func (r *redisClient) Do(args ...string) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		if err := r.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := r.roundTrip(args)
+	if err != nil {
+		if _, isReply := err.(*redisError); !isReply {
+			r.conn.Close()
+			r.conn = nil
+		}
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (r *redisClient) connect() error {
+	conn, err := net.DialTimeout("tcp", r.addr, r.timeout)
+	if err != nil {
+		return errors.NewServiceError("failed to connect to Redis: " + err.Error())
+	}
+	r.conn = conn
+	r.reader = bufio.NewReader(conn)
+
+	if r.password != "" {
+		if _, err := r.roundTrip([]string{"AUTH", r.password}); err != nil {
+			r.conn.Close()
+			r.conn = nil
+			return err
+		}
+	}
+	if r.db != 0 {
+		if _, err := r.roundTrip([]string{"SELECT", strconv.Itoa(r.db)}); err != nil {
+			r.conn.Close()
+			r.conn = nil
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *redisClient) roundTrip(args []string) (interface{}, error) {
+	r.conn.SetDeadline(time.Now().Add(r.timeout))
+
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := io.WriteString(r.conn, command.String()); err != nil {
+		return nil, errors.NewServiceError("failed to write to Redis: " + err.Error())
+	}
+
+	return readRedisReply(r.reader)
+}
+
+// redisError is an error reply. The connection is still usable after one.
+type redisError struct {
+	message string
+}
+
+func (e *redisError) Error() string {
+	return "Redis error: " + e.message
+}
+
+func readRedisReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, errors.NewServiceError("failed to read from Redis: " + err.Error())
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.NewServiceError("empty reply from Redis")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, &redisError{message: line[1:]}
+	case ':':
+		value, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, errors.NewServiceError("invalid integer from Redis: " + line)
+		}
+		return value, nil
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errors.NewServiceError("invalid bulk length from Redis: " + line)
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		buffer := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, buffer); err != nil {
+			return nil, errors.NewServiceError("failed to read from Redis: " + err.Error())
+		}
+		return string(buffer[:length]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errors.NewServiceError("invalid array length from Redis: " + line)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, count)
+		for i := range values {
+			if values[i], err = readRedisReply(reader); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, errors.NewServiceError("unexpected reply from Redis: " + line)
+	}
+}
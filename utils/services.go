@@ -5,3 +5,17 @@ import "os"
 func GetMailServiceURL() string {
 	return os.Getenv("MAIL_SERVICE_URL")
 }
+
+func GetOTPServiceURL() string {
+	return os.Getenv("OTP_SERVICE_URL")
+}
+
+// GetOAuthTokenURL is the token endpoint used to obtain tokens for calls to
+// other services. It defaults to this service's own endpoint.
+func GetOAuthTokenURL() string {
+	tokenURL := os.Getenv("OAUTH_TOKEN_URL")
+	if tokenURL == "" {
+		return "http://127.0.0.1:8181/oauth/token"
+	}
+	return tokenURL
+}
@@ -2,15 +2,19 @@ package utils
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
-	"math/rand"
+	"math/big"
 	"net/http"
-	"os"
+	"strconv"
 	"time"
 
 	"github.com/Renan-Parise/auth/entities"
 	"github.com/Renan-Parise/auth/errors"
-	"github.com/golang-jwt/jwt"
 )
 
 func Contains[T comparable](slice []T, value T) bool {
@@ -22,14 +26,43 @@ func Contains[T comparable](slice []T, value T) bool {
 	return false
 }
 
-func GenerateCode(length int) string {
+// GenerateCode returns a code of length digits and upper case letters, each
+// drawn uniformly from crypto/rand.
+func GenerateCode(length int) (string, error) {
 	const charset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	var seededRand = rand.New(rand.NewSource(time.Now().UnixNano()))
 	code := make([]byte, length)
 	for i := range code {
-		code[i] = charset[seededRand.Intn(len(charset))]
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+		if err != nil {
+			return "", errors.NewServiceError("Failed to generate code: " + err.Error())
+		}
+		code[i] = charset[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// GenerateSecureToken returns a URL-safe random string built from n bytes of
+// crypto/rand output.
+func GenerateSecureToken(n int) (string, error) {
+	buffer := make([]byte, n)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", errors.NewServiceError("Failed to generate secure token: " + err.Error())
 	}
-	return string(code)
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+// HashToken returns the hex encoded SHA-256 of an opaque token, which is the
+// only form in which tokens are persisted.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashCode binds a verification code to its user and purpose with VERIFICATION_CODE_SECRET.
+func HashCode(userID int, purpose, code string) string {
+	mac := hmac.New(sha256.New, GetVerificationCodeSecret())
+	mac.Write([]byte(strconv.Itoa(userID) + ":" + purpose + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
 func SendEmail(email entities.Email) error {
@@ -60,18 +93,3 @@ func SendEmail(email entities.Email) error {
 
 	return nil
 }
-
-func GenerateServiceToken() (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return "", errors.NewServiceError("Failed to generate token: JWT")
-	}
-
-	claims := jwt.MapClaims{
-		"service": "auth",
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
-}